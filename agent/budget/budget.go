@@ -0,0 +1,105 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// ErrContextExceeded is returned when a prompt cannot fit in the model's
+// context window.
+var ErrContextExceeded = errors.New("context window exceeded")
+
+// warnRatio is the share of the usable window at which a warning is logged
+const warnRatio = 0.8
+
+// Budget tracks the token budget of a model's context window.
+type Budget struct {
+	Model  string
+	Window int
+	// Reserve is held back from the window for the model's response.
+	Reserve int
+}
+
+// New creates a Budget for model, reserving an eighth of the window for
+// the model's response.
+func New(model string, window int) Budget {
+	return Budget{
+		Model:   model,
+		Window:  window,
+		Reserve: window / 8,
+	}
+}
+
+// Available is the number of tokens usable by prompts and history.
+func (b Budget) Available() int {
+	return b.Window - b.Reserve
+}
+
+// MaxToolOutput is the largest tool result, in tokens, that is passed to the
+// model unmodified. Larger results are truncated.
+func (b Budget) MaxToolOutput() int {
+	return b.Window / 4
+}
+
+// Check estimates the tokens used by the texts making up a prompt. It warns
+// as the prompt approaches the available budget and fails clearly when it
+// cannot fit at all.
+func (b Budget) Check(name string, texts ...string) error {
+	tokens := 0
+	for _, text := range texts {
+		tokens += EstimateTokens(text)
+	}
+
+	if tokens > b.Available() {
+		return fmt.Errorf("%s is about %d tokens, which exceeds the %d tokens available for model %s (window %d): %w",
+			name, tokens, b.Available(), b.Model, b.Window, ErrContextExceeded)
+	}
+
+	if float64(tokens) >= warnRatio*float64(b.Available()) {
+		slog.Warn("budget.near_limit", "name", name, "tokens", tokens, "available", b.Available(), "model", b.Model)
+	} else {
+		slog.Debug("budget.check", "name", name, "tokens", tokens, "available", b.Available(), "model", b.Model)
+	}
+
+	return nil
+}
+
+// LimitToolOutputs wraps tools so that results larger than maxTokens are
+// truncated before they reach the model.
+func LimitToolOutputs(tools []agent.Tool, maxTokens int) []agent.Tool {
+	limited := make([]agent.Tool, 0, len(tools))
+
+	for _, tool := range tools {
+		limited = append(limited, LimitToolOutput(tool, maxTokens))
+	}
+
+	return limited
+}
+
+// LimitToolOutput wraps tool so that results larger than maxTokens are
+// truncated before they reach the model.
+func LimitToolOutput(tool agent.Tool, maxTokens int) agent.Tool {
+	next := tool.Func
+
+	tool.Func = func(ctx context.Context, params map[string]any) (any, error) {
+		value, err := next(ctx, params)
+		if err != nil {
+			return value, err
+		}
+
+		// Match how the agent renders tool results into messages
+		content := fmt.Sprintf("%s", value)
+		if tokens := EstimateTokens(content); tokens > maxTokens {
+			slog.Warn("budget.tool_output_truncated", "tool", tool.Name, "tokens", tokens, "max_tokens", maxTokens)
+			return Truncate(content, maxTokens), nil
+		}
+
+		return value, nil
+	}
+
+	return tool
+}
@@ -0,0 +1,51 @@
+package budget_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+)
+
+func TestBudgetCheck(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	limit := budget.New("qwen3", 800)
+	assert.Expect(limit.Available()).To(Equal(700))
+	assert.Expect(limit.MaxToolOutput()).To(Equal(200))
+
+	err := limit.Check("execute prompt", strings.Repeat("a", 1000), strings.Repeat("b", 1000))
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	err = limit.Check("execute prompt", strings.Repeat("a", 2000), strings.Repeat("b", 1000))
+	assert.Expect(err).To(HaveOccurred())
+	assert.Expect(errors.Is(err, budget.ErrContextExceeded)).To(BeTrue())
+	assert.Expect(err.Error()).To(ContainSubstring("execute prompt is about 750 tokens"))
+}
+
+func TestLimitToolOutput(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tool := agent.Tool{
+		Name: "run_in_terminal",
+		Func: func(ctx context.Context, params map[string]any) (any, error) {
+			return map[string]any{"stdout": strings.Repeat("line\n", int(params["lines"].(float64)))}, nil
+		},
+	}
+
+	limited := budget.LimitToolOutputs([]agent.Tool{tool}, 100)[0]
+	assert.Expect(limited.Name).To(Equal("run_in_terminal"))
+
+	value, err := limited.Func(context.Background(), map[string]any{"lines": float64(2)})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(Equal(map[string]any{"stdout": "line\nline\n"}))
+
+	value, err = limited.Func(context.Background(), map[string]any{"lines": float64(1000)})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(BeAssignableToTypeOf(""))
+	assert.Expect(value).To(ContainSubstring("truncated"))
+}
@@ -0,0 +1,54 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// messageOverheadTokens approximates the tokens a chat template adds around
+// each message for its role and separators.
+const messageOverheadTokens = 4
+
+// EstimateTokens approximates the number of tokens in text, using the common
+// heuristic of four characters per token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// EstimateMessages approximates the number of tokens a conversation uses,
+// including tool call arguments.
+func EstimateMessages(messages agent.Messages) int {
+	total := 0
+
+	for _, message := range messages {
+		total += messageOverheadTokens + EstimateTokens(message.Content)
+
+		for _, part := range message.MultiContent {
+			total += EstimateTokens(part.Text)
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			total += EstimateTokens(toolCall.Function.Name) + EstimateTokens(toolCall.Function.Arguments)
+		}
+	}
+
+	return total
+}
+
+// Truncate shortens text to roughly maxTokens, keeping its beginning and end
+// since errors and summaries tend to appear at either side of long output.
+func Truncate(text string, maxTokens int) string {
+	total := EstimateTokens(text)
+	if maxTokens <= 0 || total <= maxTokens {
+		return text
+	}
+
+	keep := maxTokens * 4 / 2
+	// Drop any multi-byte characters split by the cut
+	head := strings.ToValidUTF8(text[:keep], "")
+	tail := strings.ToValidUTF8(text[len(text)-keep:], "")
+
+	return fmt.Sprintf("%s\n\n... [truncated: output was about %d tokens, showing the first and last %d] ...\n\n%s", head, total, maxTokens/2, tail)
+}
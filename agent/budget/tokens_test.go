@@ -0,0 +1,51 @@
+package budget_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(budget.EstimateTokens("")).To(Equal(0))
+	assert.Expect(budget.EstimateTokens("abcd")).To(Equal(1))
+	assert.Expect(budget.EstimateTokens("abcde")).To(Equal(2))
+}
+
+func TestEstimateMessages(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tokens := budget.EstimateMessages(agent.Messages{
+		{Role: "user", Content: strings.Repeat("a", 40)},
+		{Role: "assistant", ToolCalls: []openai.ToolCall{{
+			Function: openai.FunctionCall{Name: "read_file", Arguments: strings.Repeat("b", 80)},
+		}}},
+	})
+
+	// 2 messages of overhead, 10 tokens of content, 3 for the name and 20 for arguments
+	assert.Expect(tokens).To(Equal(8 + 10 + 3 + 20))
+}
+
+func TestTruncate(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	short := "short output"
+	assert.Expect(budget.Truncate(short, 100)).To(Equal(short))
+
+	long := "BEGIN" + strings.Repeat("x", 10_000) + "END"
+	truncated := budget.Truncate(long, 100)
+
+	assert.Expect(truncated).To(HavePrefix("BEGIN"))
+	assert.Expect(truncated).To(HaveSuffix("END"))
+	assert.Expect(truncated).To(ContainSubstring("truncated: output was about 2502 tokens"))
+	assert.Expect(budget.EstimateTokens(truncated)).To(BeNumerically("<", 150))
+
+	multiByte := strings.Repeat("é", 1_000)
+	assert.Expect(budget.Truncate(multiByte, 11)).NotTo(ContainSubstring("�"))
+}
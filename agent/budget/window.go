@@ -0,0 +1,151 @@
+package budget
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultContextWindow is used when nothing is known about a model.
+const DefaultContextWindow = 8192
+
+// knownContextWindows are conservative context windows for common model
+// families, matched by model name prefix.
+var knownContextWindows = []struct {
+	prefix string
+	window int
+}{
+	{"qwen3", 40960},
+	{"qwen2.5", 32768},
+	{"phi4-mini", 131072},
+	{"phi4", 32768},
+	{"llama3.1", 131072},
+	{"llama3.2", 131072},
+	{"llama3.3", 131072},
+	{"llama3", 8192},
+	{"gemma3", 131072},
+	{"mistral", 32768},
+	{"deepseek-r1", 131072},
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini", 1048576},
+}
+
+// Resolver determines the context window of a model.
+type Resolver struct {
+	// Configured holds windows set in configuration, keyed by model name.
+	Configured func(model string) int
+	// Ollama reports whether endpoint is an Ollama server, which is probed
+	// for the model's context length.
+	Ollama bool
+	// HTTPClient is used to probe endpoints, defaults to a client with a short timeout.
+	HTTPClient *http.Client
+}
+
+// Window returns the context window for model served at endpoint. An
+// explicit override wins, followed by configuration, probing an Ollama
+// endpoint, the table of known models and finally DefaultContextWindow.
+func (r Resolver) Window(ctx context.Context, endpoint, model string, override int) int {
+	if override > 0 {
+		return override
+	}
+
+	if r.Configured != nil {
+		if window := r.Configured(model); window > 0 {
+			return window
+		}
+	}
+
+	if r.Ollama {
+		window, err := r.ProbeOllama(ctx, endpoint, model)
+		if err == nil && window > 0 {
+			slog.Debug("budget.probe", "model", model, "context_window", window)
+			return window
+		}
+		slog.Debug("budget.probe.failed", "model", model, "endpoint", endpoint, "error", err)
+	}
+
+	if window := KnownContextWindow(model); window > 0 {
+		return window
+	}
+
+	return DefaultContextWindow
+}
+
+// KnownContextWindow looks model up in the table of known model families,
+// returning zero when it is not recognized.
+func KnownContextWindow(model string) int {
+	name := strings.ToLower(model)
+	if index := strings.LastIndex(name, "/"); index != -1 {
+		name = name[index+1:]
+	}
+
+	for _, known := range knownContextWindows {
+		if strings.HasPrefix(name, known.prefix) {
+			return known.window
+		}
+	}
+
+	return 0
+}
+
+// ProbeOllama asks an Ollama server for the context length a model was
+// trained with, using the /api/show endpoint next to its OpenAI compatible
+// /v1 endpoint. Ollama runs models with a smaller context unless requests
+// set num_ctx, see provider.WithContextWindow.
+func (r Resolver) ProbeOllama(ctx context.Context, endpoint, model string) (int, error) {
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	baseURL := strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/v1")
+
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode probe request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/show", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create probe request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe %s: %w", baseURL, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to probe %s: status %d", baseURL, response.StatusCode)
+	}
+
+	var payload struct {
+		ModelInfo map[string]any `json:"model_info"`
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode probe response: %w", err)
+	}
+
+	for key, value := range payload.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			if length, ok := value.(float64); ok {
+				return int(length), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("model %s did not report a context length", model)
+}
@@ -0,0 +1,60 @@
+package budget_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/budget"
+	. "github.com/onsi/gomega"
+)
+
+func TestResolverWindow(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		if r.URL.Path != "/api/show" || request["model"] != "qwen3:32b" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"model_info": {"general.architecture": "qwen3", "qwen3.context_length": 32768}}`))
+	}))
+	defer server.Close()
+
+	resolver := budget.Resolver{
+		Configured: func(model string) int {
+			if model == "configured" {
+				return 1234
+			}
+			return 0
+		},
+		Ollama: true,
+	}
+
+	ctx := context.Background()
+
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "qwen3:32b", 999)).To(Equal(999))
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "configured", 0)).To(Equal(1234))
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "qwen3:32b", 0)).To(Equal(32768))
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "claude-sonnet-4", 0)).To(Equal(200000))
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "something-new", 0)).To(Equal(budget.DefaultContextWindow))
+
+	// Only Ollama endpoints are probed
+	resolver.Ollama = false
+	assert.Expect(resolver.Window(ctx, server.URL+"/v1", "qwen3:32b", 0)).To(Equal(40960))
+}
+
+func TestKnownContextWindow(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(budget.KnownContextWindow("phi4-reasoning:latest")).To(Equal(32768))
+	assert.Expect(budget.KnownContextWindow("phi4-mini-reasoning")).To(Equal(131072))
+	assert.Expect(budget.KnownContextWindow("openai/gpt-4o-mini")).To(Equal(128000))
+	assert.Expect(budget.KnownContextWindow("unknown")).To(Equal(0))
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds settings that do not fit on the command line, loaded from
+// YAML files such as ~/.config/agent/config.yaml and .agent/config.yaml.
+type Config struct {
+	// Models holds per model settings, keyed by model name (e.g. "qwen3:32b").
+	Models map[string]Model `yaml:"models"`
+	// Profiles holds named sets of run settings, selected with --profile.
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Logging holds settings for the debug logs.
+	Logging Logging `yaml:"logging"`
+	// MCPServers holds Model Context Protocol servers whose tools are
+	// offered to the executing agent, keyed by a name that prefixes each
+	// tool's name.
+	MCPServers map[string]MCPServer `yaml:"mcp_servers"`
+	// Prompts holds settings for the prompt templates.
+	Prompts Prompts `yaml:"prompts"`
+}
+
+// Prompts customizes the prompt templates.
+type Prompts struct {
+	// Variables are available to every template as .Vars, e.g.
+	// {{ .Vars.team }}.
+	Variables map[string]any `yaml:"variables"`
+}
+
+// MCPServer is an MCP server started as a child process, talking over
+// stdio.
+type MCPServer struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env is added to the agent's environment, with $VAR references
+	// expanded to keep secrets out of config files.
+	Env map[string]string `yaml:"env"`
+}
+
+// Environ returns the server's environment as KEY=value pairs.
+func (s MCPServer) Environ() []string {
+	environ := make([]string, 0, len(s.Env))
+	for key, value := range s.Env {
+		environ = append(environ, key+"="+os.ExpandEnv(value))
+	}
+
+	return environ
+}
+
+// Logging controls what is written to the logs.
+type Logging struct {
+	// Redact lists regular expressions for secrets to mask in logged
+	// prompts and tool outputs, in addition to API tokens.
+	Redact []string `yaml:"redact"`
+}
+
+// DefaultProfile is used when no profile is selected.
+const DefaultProfile = "default"
+
+// Profile is a named set of settings for how a run behaves.
+type Profile struct {
+	Compaction Compaction `yaml:"compaction"`
+	// Verify lists shell commands, such as "go test ./...", that must pass
+	// after execution.
+	Verify []string `yaml:"verify"`
+	// Retry controls how failed model requests are retried.
+	Retry Retry `yaml:"retry"`
+	// Fallbacks lists the endpoints to try, in order, when an agent's
+	// configured endpoint keeps failing.
+	Fallbacks Fallbacks `yaml:"fallbacks"`
+}
+
+// Retry controls how failed requests to each endpoint are retried with
+// exponential backoff.
+type Retry struct {
+	// MaxAttempts is the number of requests sent to each endpoint.
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff is the wait before the first retry, doubling each retry.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// Timeout limits each request.
+	Timeout time.Duration `yaml:"timeout"`
+	// StatusCodes are the HTTP statuses that are retried.
+	StatusCodes []int `yaml:"status_codes"`
+}
+
+// Fallbacks lists fallback endpoints for each agent.
+type Fallbacks struct {
+	Planning  []Endpoint `yaml:"planning"`
+	Executing []Endpoint `yaml:"executing"`
+}
+
+// Endpoint is a model served by a provider.
+type Endpoint struct {
+	// Provider is the API protocol: openai, ollama or anthropic.
+	Provider string `yaml:"provider"`
+	Endpoint string `yaml:"endpoint"`
+	Model    string `yaml:"model"`
+	Token    string `yaml:"token"`
+	// TokenEnv names an environment variable holding the token, to keep
+	// secrets out of config files.
+	TokenEnv string `yaml:"token_env"`
+}
+
+// APIToken returns the token, reading TokenEnv when set.
+func (e Endpoint) APIToken() string {
+	if e.TokenEnv != "" {
+		return os.Getenv(e.TokenEnv)
+	}
+
+	return e.Token
+}
+
+// Compaction controls how the executing agent's history is summarized as it
+// approaches the model's context window.
+type Compaction struct {
+	// Disabled turns compaction off, letting history grow until the model fails.
+	Disabled bool `yaml:"disabled"`
+	// Threshold is the share of the context window that triggers compaction.
+	Threshold float64 `yaml:"threshold"`
+	// KeepRecent is the number of most recent messages kept verbatim.
+	KeepRecent int `yaml:"keep_recent"`
+}
+
+// Model describes the capabilities of a model.
+type Model struct {
+	// ContextWindow is the number of tokens the model accepts in a request.
+	ContextWindow int `yaml:"context_window"`
+	// Price is what the model costs, used to account for the cost of a run.
+	Price Price `yaml:"price"`
+}
+
+// Price is in dollars per million tokens.
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+	// CachedInput is charged for prompt tokens read from the provider's
+	// cache, defaulting to the input price.
+	CachedInput float64 `yaml:"cached_input"`
+}
+
+// Load reads each existing file in paths in order, with later files
+// overriding the settings of earlier ones. Missing files are skipped.
+func Load(paths ...string) (*Config, error) {
+	cfg := &Config{
+		Models:   map[string]Model{},
+		Profiles: map[string]Profile{},
+	}
+
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+
+		err = yaml.Unmarshal(contents, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Tokens returns the API tokens of every configured fallback endpoint.
+func (c *Config) Tokens() []string {
+	tokens := []string{}
+
+	for _, profile := range c.Profiles {
+		for _, endpoint := range append(profile.Fallbacks.Planning, profile.Fallbacks.Executing...) {
+			if token := endpoint.APIToken(); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens
+}
+
+// ContextWindow returns the configured context window for model, or zero if
+// none is configured.
+func (c *Config) ContextWindow(model string) int {
+	return c.Models[model].ContextWindow
+}
+
+// Profile returns the named profile with defaults applied to unset values.
+// An unknown name is an error, except for the default profile which always exists.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok && name != DefaultProfile {
+		return Profile{}, fmt.Errorf("profile %q is not defined in the config", name)
+	}
+
+	if profile.Compaction.Threshold <= 0 || profile.Compaction.Threshold > 1 {
+		profile.Compaction.Threshold = 0.75
+	}
+
+	if profile.Compaction.KeepRecent <= 0 {
+		profile.Compaction.KeepRecent = 6
+	}
+
+	if profile.Retry.MaxAttempts <= 0 {
+		profile.Retry.MaxAttempts = 3
+	}
+
+	if profile.Retry.InitialBackoff <= 0 {
+		profile.Retry.InitialBackoff = time.Second
+	}
+
+	if profile.Retry.MaxBackoff <= 0 {
+		profile.Retry.MaxBackoff = 30 * time.Second
+	}
+
+	if profile.Retry.Timeout <= 0 {
+		profile.Retry.Timeout = 10 * time.Minute
+	}
+
+	if len(profile.Retry.StatusCodes) == 0 {
+		// Request timeouts, rate limits and server errors, including
+		// Anthropic's overloaded status
+		profile.Retry.StatusCodes = []int{408, 429, 500, 502, 503, 504, 529}
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,142 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/config"
+	. "github.com/onsi/gomega"
+)
+
+func TestLoad(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+
+	userConfig := filepath.Join(dir, "user.yaml")
+	err := os.WriteFile(userConfig, []byte("models:\n  qwen3:32b:\n    context_window: 40960\n  phi4-reasoning:latest:\n    context_window: 32768\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	repoConfig := filepath.Join(dir, "repo.yaml")
+	err = os.WriteFile(repoConfig, []byte("models:\n  qwen3:32b:\n    context_window: 16384\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := config.Load(userConfig, filepath.Join(dir, "missing.yaml"), repoConfig)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(cfg.ContextWindow("qwen3:32b")).To(Equal(16384))
+	assert.Expect(cfg.ContextWindow("phi4-reasoning:latest")).To(Equal(32768))
+	assert.Expect(cfg.ContextWindow("unknown")).To(Equal(0))
+}
+
+func TestLoadInvalid(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("models: [not, a, map"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = config.Load(path)
+	assert.Expect(err).To(HaveOccurred())
+}
+
+func TestProfile(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("profiles:\n  local:\n    compaction:\n      threshold: 0.5\n  off:\n    compaction:\n      disabled: true\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := config.Load(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	profile, err := cfg.Profile("")
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(profile.Compaction).To(Equal(config.Compaction{Threshold: 0.75, KeepRecent: 6}))
+
+	profile, err = cfg.Profile("local")
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(profile.Compaction).To(Equal(config.Compaction{Threshold: 0.5, KeepRecent: 6}))
+
+	profile, err = cfg.Profile("off")
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(profile.Compaction.Disabled).To(BeTrue())
+
+	_, err = cfg.Profile("missing")
+	assert.Expect(err).To(HaveOccurred())
+}
+
+func TestProfileRetryAndFallbacks(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	t.Setenv("TEST_REMOTE_TOKEN", "from-env")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`profiles:
+  default:
+    retry:
+      max_attempts: 5
+      initial_backoff: 250ms
+    fallbacks:
+      executing:
+        - provider: openai
+          endpoint: https://openrouter.ai/api/v1
+          model: qwen/qwen3-235b-a22b
+          token_env: TEST_REMOTE_TOKEN
+`), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := config.Load(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	profile, err := cfg.Profile("")
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(profile.Retry.MaxAttempts).To(Equal(5))
+	assert.Expect(profile.Retry.InitialBackoff).To(Equal(250 * time.Millisecond))
+	assert.Expect(profile.Retry.MaxBackoff).To(Equal(30 * time.Second))
+	assert.Expect(profile.Retry.StatusCodes).To(ContainElements(429, 503))
+
+	assert.Expect(profile.Fallbacks.Planning).To(BeEmpty())
+	assert.Expect(profile.Fallbacks.Executing).To(HaveLen(1))
+	assert.Expect(profile.Fallbacks.Executing[0].Model).To(Equal("qwen/qwen3-235b-a22b"))
+	assert.Expect(profile.Fallbacks.Executing[0].APIToken()).To(Equal("from-env"))
+	assert.Expect(cfg.Tokens()).To(Equal([]string{"from-env"}))
+}
+
+func TestLogging(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`logging:
+  redact:
+    - 'internal-[0-9]+'
+`), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := config.Load(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(cfg.Logging.Redact).To(Equal([]string{"internal-[0-9]+"}))
+}
+
+func TestMCPServers(t *testing.T) {
+	assert := NewGomegaWithT(t)
+	t.Setenv("GITHUB_TOKEN", "from-env")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`mcp_servers:
+  github:
+    command: github-mcp-server
+    args: [stdio]
+    env:
+      GITHUB_PERSONAL_ACCESS_TOKEN: $GITHUB_TOKEN
+`), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := config.Load(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(cfg.MCPServers).To(HaveKey("github"))
+	assert.Expect(cfg.MCPServers["github"].Args).To(Equal([]string{"stdio"}))
+	assert.Expect(cfg.MCPServers["github"].Environ()).To(Equal([]string{"GITHUB_PERSONAL_ACCESS_TOKEN=from-env"}))
+}
@@ -0,0 +1,103 @@
+package contextbuilder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-enry/go-enry/v2"
+	"github.com/jtarchie/agent/agent/budget"
+)
+
+// DefaultTokenBudget is the number of tokens of file contents packed into a
+// planning message when no budget is configured.
+const DefaultTokenBudget = 8000
+
+// File describes a file selected for the run
+type File struct {
+	Filename string // Relative to the builder's root
+	Language string
+	Size     int
+}
+
+// Builder packs the contents of files into a context document for an agent.
+// Files are included in full while they fit in the token budget, after that
+// only an outline of their symbols is included. When there are no files a
+// compact map of the repository is produced instead.
+type Builder struct {
+	Root        string
+	TokenBudget int
+}
+
+// New creates a Builder for root with the given token budget.
+func New(root string, tokenBudget int) *Builder {
+	if tokenBudget <= 0 {
+		tokenBudget = DefaultTokenBudget
+	}
+
+	return &Builder{
+		Root:        root,
+		TokenBudget: tokenBudget,
+	}
+}
+
+// Build renders the context document for files.
+func (b *Builder) Build(files []File) (string, error) {
+	if len(files) == 0 {
+		repoMap, err := BuildRepoMap(b.Root, b.TokenBudget)
+		if err != nil {
+			return "", err
+		}
+
+		return "Files: Working from current directory (no specific files provided)\n\n" + repoMap, nil
+	}
+
+	var contents, outlines strings.Builder
+	remaining := b.TokenBudget
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(b.Root, file.Filename))
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", file.Filename, err)
+		}
+
+		if enry.IsBinary(data) {
+			fmt.Fprintf(&outlines, "- %s: language %q, size %d (binary, contents omitted)\n", file.Filename, file.Language, file.Size)
+			continue
+		}
+
+		section := fmt.Sprintf("### %s\n\nLanguage %q, size %d\n\n````%s\n%s\n````\n\n",
+			file.Filename, file.Language, file.Size, strings.ToLower(file.Language), strings.TrimRight(string(data), "\n"))
+
+		if tokens := budget.EstimateTokens(section); tokens <= remaining {
+			contents.WriteString(section)
+			remaining -= tokens
+			continue
+		}
+
+		outline := fmt.Sprintf("- %s: language %q, size %d\n", file.Filename, file.Language, file.Size)
+		for _, symbol := range Outline(file.Language, string(data)) {
+			outline += "  - " + symbol + "\n"
+		}
+
+		if tokens := budget.EstimateTokens(outline); tokens <= remaining {
+			outlines.WriteString(outline)
+			remaining -= tokens
+			continue
+		}
+
+		fmt.Fprintf(&outlines, "- %s: language %q, size %d (outline omitted, over budget)\n", file.Filename, file.Language, file.Size)
+	}
+
+	var document strings.Builder
+	document.WriteString("Files:\n\n")
+	document.WriteString(contents.String())
+
+	if outlines.Len() > 0 {
+		document.WriteString("Outlines (file contents exceeded the context budget, use tools to read them):\n\n")
+		document.WriteString(outlines.String())
+	}
+
+	return strings.TrimRight(document.String(), "\n") + "\n", nil
+}
@@ -0,0 +1,74 @@
+package contextbuilder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/contextbuilder"
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuildIncludesContents(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "main.go", "package main\n\nfunc main() {}\n")
+	testutil.WriteFile(t, root, "lib/util.go", "package lib\n\nfunc Util() string {\n\treturn \"util\"\n}\n")
+
+	builder := contextbuilder.New(root, 1000)
+	document, err := builder.Build([]contextbuilder.File{
+		{Filename: "main.go", Language: "Go", Size: 29},
+		{Filename: "lib/util.go", Language: "Go", Size: 50},
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(document).To(ContainSubstring("### main.go"))
+	assert.Expect(document).To(ContainSubstring("func main() {}"))
+	assert.Expect(document).To(ContainSubstring("### lib/util.go"))
+	assert.Expect(document).To(ContainSubstring(`return "util"`))
+	assert.Expect(document).NotTo(ContainSubstring("Outlines"))
+}
+
+func TestBuildFallsBackToOutlines(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "small.go", "package main\n\nfunc Small() {}\n")
+	testutil.WriteFile(t, root, "big.go", "package main\n\ntype Server struct{}\n\nfunc (s *Server) Start() error {\n"+strings.Repeat("\t// filler line\n", 200)+"\treturn nil\n}\n")
+
+	builder := contextbuilder.New(root, 100)
+	document, err := builder.Build([]contextbuilder.File{
+		{Filename: "small.go", Language: "Go", Size: 30},
+		{Filename: "big.go", Language: "Go", Size: 3000},
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(document).To(ContainSubstring("func Small() {}"))
+	assert.Expect(document).To(ContainSubstring("Outlines"))
+	assert.Expect(document).To(ContainSubstring("- big.go"))
+	assert.Expect(document).To(ContainSubstring("  - type Server struct"))
+	assert.Expect(document).To(ContainSubstring("  - func (s *Server) Start() error"))
+	assert.Expect(document).NotTo(ContainSubstring("filler line"))
+}
+
+func TestBuildWithoutFilesRendersRepoMap(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "go.mod", "module example\n")
+	testutil.WriteFile(t, root, "README.md", "# example\n")
+	testutil.WriteFile(t, root, "cmd/server/main.go", "package main\n")
+	testutil.WriteFile(t, root, "cmd/server/routes.go", "package main\n")
+	testutil.WriteFile(t, root, "node_modules/pkg/index.js", "")
+	testutil.WriteFile(t, root, ".git/config", "")
+
+	document, err := contextbuilder.New(root, 1000).Build(nil)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(document).To(ContainSubstring("Repository map"))
+	assert.Expect(document).To(ContainSubstring("- ./ (2 files): README.md, go.mod"))
+	assert.Expect(document).To(ContainSubstring("- cmd/server/ (2 files): main.go"))
+	assert.Expect(document).NotTo(ContainSubstring("node_modules"))
+	assert.Expect(document).NotTo(ContainSubstring(".git"))
+}
@@ -0,0 +1,461 @@
+package contextbuilder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jtarchie/agent/agent/budget"
+	"gopkg.in/yaml.v3"
+)
+
+// guidePatterns identify the files a repository keeps about how to work on
+// it, in the order they are included.
+var guidePatterns = []string{
+	"AGENTS.md",
+	"CONTRIBUTING*",
+	".github/CONTRIBUTING*",
+	"docs/CONTRIBUTING*",
+	".editorconfig",
+	".golangci.*",
+	"eslint.config.*",
+	".eslintrc*",
+	".prettierrc*",
+	".rubocop.yml",
+	"ruff.toml",
+	".ruff.toml",
+	"rustfmt.toml",
+	".rustfmt.toml",
+	"Taskfile.yml",
+	"Taskfile.yaml",
+	"Makefile",
+}
+
+// scriptKinds maps the names of tasks, make targets and package.json scripts
+// to the kind of fact they state.
+var scriptKinds = []struct{ name, kind string }{
+	{"test", "test"},
+	{"lint", "lint"},
+	{"fmt", "format"},
+	{"format", "format"},
+	{"build", "build"},
+	{"typecheck", "typecheck"},
+}
+
+// makeTarget matches a target in a Makefile, but not a variable assignment
+var makeTarget = regexp.MustCompile(`(?m)^([A-Za-z][\w.-]*)\s*:(?:[^=]|$)`)
+
+// Fact is something a repository states about how to work on it, such as
+// the command that runs its tests.
+type Fact struct {
+	// Kind is "test", "lint", "format", "build", "typecheck" or "indent".
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Guide is a file describing the repository's conventions, such as AGENTS.md.
+type Guide struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Conventions are how a repository expects to be worked on, derived from the
+// files it keeps about itself.
+type Conventions struct {
+	Facts  []Fact  `json:"facts"`
+	Guides []Guide `json:"guides"`
+	// Omitted lists guides that did not fit in the token budget.
+	Omitted []string `json:"omitted"`
+}
+
+// Empty reports whether nothing was found.
+func (c Conventions) Empty() bool {
+	return len(c.Facts) == 0 && len(c.Guides) == 0 && len(c.Omitted) == 0
+}
+
+// DiscoverConventions finds the guides, task runners and tool configs in
+// dirs, such as the working directory and the repository root, the most
+// specific first. Paths are relative to the first directory. Guides are
+// included in full while they fit in tokenBudget, after that only their paths
+// are listed. A budget of zero leaves the guides out.
+//
+// A kind of fact stated in one directory is not taken from the ones after
+// it. Within a directory, facts from task runners take precedence over those
+// from tool configs, which take precedence over the defaults of the
+// project's language.
+func DiscoverConventions(dirs []string, tokenBudget int) (Conventions, error) {
+	conventions := Conventions{
+		Facts:   []Fact{},
+		Guides:  []Guide{},
+		Omitted: []string{},
+	}
+
+	if len(dirs) == 0 {
+		return conventions, nil
+	}
+
+	base := dirs[0]
+
+	for _, dir := range dirs {
+		stated := map[string]bool{}
+		for _, fact := range conventions.Facts {
+			stated[fact.Kind] = true
+		}
+
+		facts, err := discoverFacts(dir)
+		if err != nil {
+			return Conventions{}, err
+		}
+
+		for _, fact := range facts {
+			if stated[fact.Kind] {
+				continue
+			}
+
+			fact.Source = relativePath(base, filepath.Join(dir, fact.Source))
+			conventions.Facts = append(conventions.Facts, fact)
+		}
+	}
+
+	if tokenBudget <= 0 {
+		return conventions, nil
+	}
+
+	remaining := tokenBudget
+
+	for _, dir := range dirs {
+		for _, path := range guidePaths(dir) {
+			contents, err := os.ReadFile(filepath.Join(dir, path))
+			if err != nil {
+				return Conventions{}, fmt.Errorf("failed to read guide %s: %w", path, err)
+			}
+
+			path = relativePath(base, filepath.Join(dir, path))
+
+			content := strings.TrimSpace(string(contents))
+			if content == "" {
+				continue
+			}
+
+			if tokens := budget.EstimateTokens(content); tokens <= remaining {
+				conventions.Guides = append(conventions.Guides, Guide{Path: path, Content: content})
+				remaining -= tokens
+				continue
+			}
+
+			conventions.Omitted = append(conventions.Omitted, path)
+		}
+	}
+
+	return conventions, nil
+}
+
+// discoverFacts finds the facts stated in dir, with sources relative to it.
+func discoverFacts(dir string) ([]Fact, error) {
+	discovered := []Fact{}
+
+	tiers := [][]func(string) ([]Fact, error){
+		{taskfileFacts, makefileFacts, packageJSONFacts},
+		{toolFacts, editorconfigFacts},
+		{languageFacts},
+	}
+
+	for _, tier := range tiers {
+		earlier := map[string]bool{}
+		for _, fact := range discovered {
+			earlier[fact.Kind] = true
+		}
+
+		found := []Fact{}
+
+		for _, discover := range tier {
+			facts, err := discover(dir)
+			if err != nil {
+				return nil, err
+			}
+
+			found = append(found, facts...)
+		}
+
+		for _, fact := range found {
+			duplicate := slices.ContainsFunc(discovered, func(existing Fact) bool {
+				return existing.Kind == fact.Kind && existing.Value == fact.Value
+			})
+
+			if earlier[fact.Kind] || duplicate {
+				continue
+			}
+
+			discovered = append(discovered, fact)
+		}
+	}
+
+	return discovered, nil
+}
+
+// relativePath returns path relative to base, with forward slashes.
+func relativePath(base, path string) string {
+	relative, err := filepath.Rel(base, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+// guidePaths lists the guides in root, relative to it.
+func guidePaths(root string) []string {
+	paths := []string{}
+
+	for _, pattern := range guidePatterns {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			path, _ := filepath.Rel(root, match)
+			if !slices.Contains(paths, filepath.ToSlash(path)) {
+				paths = append(paths, filepath.ToSlash(path))
+			}
+		}
+	}
+
+	return paths
+}
+
+func taskfileFacts(root string) ([]Fact, error) {
+	for _, name := range []string{"Taskfile.yml", "Taskfile.yaml"} {
+		contents, err := readOptional(root, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if contents == nil {
+			continue
+		}
+
+		var taskfile struct {
+			Tasks map[string]any `yaml:"tasks"`
+		}
+
+		if yaml.Unmarshal(contents, &taskfile) != nil {
+			return nil, nil
+		}
+
+		return scriptFacts(name, "task ", taskfile.Tasks), nil
+	}
+
+	return nil, nil
+}
+
+func makefileFacts(root string) ([]Fact, error) {
+	contents, err := readOptional(root, "Makefile")
+	if err != nil || contents == nil {
+		return nil, err
+	}
+
+	targets := map[string]any{}
+	for _, match := range makeTarget.FindAllSubmatch(contents, -1) {
+		targets[string(match[1])] = true
+	}
+
+	return scriptFacts("Makefile", "make ", targets), nil
+}
+
+func packageJSONFacts(root string) ([]Fact, error) {
+	contents, err := readOptional(root, "package.json")
+	if err != nil || contents == nil {
+		return nil, err
+	}
+
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+
+	if json.Unmarshal(contents, &pkg) != nil {
+		return nil, nil
+	}
+
+	scripts := map[string]any{}
+	for name, script := range pkg.Scripts {
+		if name == "test" && strings.TrimSpace(script) == npmDefaultTestScript {
+			continue
+		}
+
+		scripts[name] = script
+	}
+
+	// Run scripts with the package manager the lock file belongs to
+	runner := "npm"
+	for _, lock := range []struct{ file, runner string }{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"bun.lockb", "bun"},
+	} {
+		if fileExists(root, lock.file) {
+			runner = lock.runner
+			break
+		}
+	}
+
+	return scriptFacts("package.json", runner+" run ", scripts), nil
+}
+
+// npmDefaultTestScript is the placeholder `npm init` writes, which always fails
+const npmDefaultTestScript = `echo "Error: no test specified" && exit 1`
+
+// scriptFacts states a fact for each script with a known kind, in the order
+// of the kinds.
+func scriptFacts(source, prefix string, scripts map[string]any) []Fact {
+	facts := []Fact{}
+
+	for _, script := range scriptKinds {
+		if _, ok := scripts[script.name]; ok {
+			facts = append(facts, Fact{Kind: script.kind, Value: prefix + script.name, Source: source})
+		}
+	}
+
+	return facts
+}
+
+// toolConfigs maps the config files of linters and formatters to the facts
+// their presence states.
+var toolConfigs = []struct {
+	pattern string
+	kind    string
+	command string
+}{
+	{".golangci.*", "lint", "golangci-lint run"},
+	{"eslint.config.*", "lint", "npx eslint ."},
+	{".eslintrc*", "lint", "npx eslint ."},
+	{".prettierrc*", "format", "npx prettier --write ."},
+	{".rubocop.yml", "lint", "bundle exec rubocop"},
+	{"ruff.toml", "lint", "ruff check ."},
+	{".ruff.toml", "lint", "ruff check ."},
+	{"rustfmt.toml", "format", "cargo fmt"},
+	{".rustfmt.toml", "format", "cargo fmt"},
+	{"clippy.toml", "lint", "cargo clippy"},
+}
+
+func toolFacts(root string) ([]Fact, error) {
+	facts := []Fact{}
+
+	for _, config := range toolConfigs {
+		matches, _ := filepath.Glob(filepath.Join(root, config.pattern))
+		if len(matches) > 0 {
+			facts = append(facts, Fact{Kind: config.kind, Value: config.command, Source: filepath.Base(matches[0])})
+		}
+	}
+
+	contents, err := readOptional(root, "pyproject.toml")
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(string(contents), "[tool.ruff") {
+		facts = append(facts, Fact{Kind: "lint", Value: "ruff check .", Source: "pyproject.toml"})
+	}
+
+	return facts, nil
+}
+
+// editorconfigFacts states the indentation of the editorconfig's section for
+// all files.
+func editorconfigFacts(root string) ([]Fact, error) {
+	contents, err := readOptional(root, ".editorconfig")
+	if err != nil || contents == nil {
+		return nil, err
+	}
+
+	settings := map[string]string{}
+	section := ""
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			section = strings.Trim(line, "[]")
+		case section == "*":
+			key, value, ok := strings.Cut(line, "=")
+			if ok {
+				settings[strings.ToLower(strings.TrimSpace(key))] = strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+	}
+
+	var indent string
+
+	switch settings["indent_style"] {
+	case "tab":
+		indent = "tabs"
+	case "space":
+		indent = "spaces"
+		if size := settings["indent_size"]; size != "" && size != "tab" {
+			indent = size + " spaces"
+		}
+	default:
+		return nil, nil
+	}
+
+	return []Fact{{Kind: "indent", Value: indent, Source: ".editorconfig"}}, nil
+}
+
+// languageMarkers maps the files that mark a project's language to the facts
+// its tooling states by default.
+var languageMarkers = []struct {
+	file  string
+	facts []Fact
+}{
+	{"go.mod", []Fact{{Kind: "test", Value: "go test ./..."}, {Kind: "lint", Value: "go vet ./..."}, {Kind: "format", Value: "gofmt -w ."}}},
+	{"Cargo.toml", []Fact{{Kind: "test", Value: "cargo test"}, {Kind: "lint", Value: "cargo clippy"}, {Kind: "format", Value: "cargo fmt"}}},
+	{"pytest.ini", []Fact{{Kind: "test", Value: "python -m pytest"}}},
+	{"pyproject.toml", []Fact{{Kind: "test", Value: "python -m pytest"}}},
+	{"Rakefile", []Fact{{Kind: "test", Value: "bundle exec rake test"}}},
+}
+
+func languageFacts(root string) ([]Fact, error) {
+	facts := []Fact{}
+
+	for _, marker := range languageMarkers {
+		if !fileExists(root, marker.file) {
+			continue
+		}
+
+		for _, fact := range marker.facts {
+			fact.Source = marker.file
+			facts = append(facts, fact)
+		}
+	}
+
+	return facts, nil
+}
+
+// readOptional reads a file in root, returning nil when it does not exist.
+func readOptional(root, name string) ([]byte, error) {
+	contents, err := os.ReadFile(filepath.Join(root, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return contents, nil
+}
+
+func fileExists(root, name string) bool {
+	_, err := os.Stat(filepath.Join(root, name))
+	return err == nil
+}
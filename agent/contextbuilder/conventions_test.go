@@ -0,0 +1,92 @@
+package contextbuilder_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/contextbuilder"
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	. "github.com/onsi/gomega"
+)
+
+func TestDiscoverConventions(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "go.mod", "module example\n")
+	testutil.WriteFile(t, root, "Taskfile.yml", "version: '3'\ntasks:\n  test:\n    cmds: [go test ./...]\n  fmt:\n    cmds: [gofmt -w .]\n")
+	testutil.WriteFile(t, root, "Makefile", "GO := go\n\ntest:\n\t$(GO) test ./...\n")
+	testutil.WriteFile(t, root, ".golangci.yml", "linters:\n  enable: [revive]\n")
+	testutil.WriteFile(t, root, ".editorconfig", "root = true\n\n[*]\nindent_style = space\nindent_size = 2\n\n[Makefile]\nindent_style = tab\n")
+	testutil.WriteFile(t, root, "AGENTS.md", "Keep functions short.\n")
+	testutil.WriteFile(t, root, ".github/CONTRIBUTING.md", strings.Repeat("Be kind. ", 200))
+
+	conventions, err := contextbuilder.DiscoverConventions([]string{root}, 100)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// Task runners take precedence over tool configs and language defaults
+	assert.Expect(conventions.Facts).To(Equal([]contextbuilder.Fact{
+		{Kind: "test", Value: "task test", Source: "Taskfile.yml"},
+		{Kind: "format", Value: "task fmt", Source: "Taskfile.yml"},
+		{Kind: "test", Value: "make test", Source: "Makefile"},
+		{Kind: "lint", Value: "golangci-lint run", Source: ".golangci.yml"},
+		{Kind: "indent", Value: "2 spaces", Source: ".editorconfig"},
+	}))
+
+	// Guides are included until the budget runs out
+	assert.Expect(conventions.Guides).To(ContainElement(contextbuilder.Guide{Path: "AGENTS.md", Content: "Keep functions short."}))
+	assert.Expect(conventions.Omitted).To(ContainElement(".github/CONTRIBUTING.md"))
+
+	conventions, err = contextbuilder.DiscoverConventions([]string{root}, 0)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(conventions.Facts).NotTo(BeEmpty())
+	assert.Expect(conventions.Guides).To(BeEmpty())
+}
+
+func TestDiscoverConventionsPackageJSON(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "package.json", `{"scripts": {"test": "echo \"Error: no test specified\" && exit 1", "lint": "eslint .", "typecheck": "tsc --noEmit"}}`)
+	testutil.WriteFile(t, root, "pnpm-lock.yaml", "")
+	testutil.WriteFile(t, root, "eslint.config.js", "export default [];\n")
+	testutil.WriteFile(t, root, ".prettierrc", "{}\n")
+
+	conventions, err := contextbuilder.DiscoverConventions([]string{root}, 1000)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(conventions.Facts).To(Equal([]contextbuilder.Fact{
+		{Kind: "lint", Value: "pnpm run lint", Source: "package.json"},
+		{Kind: "typecheck", Value: "pnpm run typecheck", Source: "package.json"},
+		{Kind: "format", Value: "npx prettier --write .", Source: ".prettierrc"},
+	}))
+
+	conventions, err = contextbuilder.DiscoverConventions([]string{t.TempDir()}, 1000)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(conventions.Empty()).To(BeTrue())
+}
+
+func TestDiscoverConventionsFromSubdirectory(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	testutil.WriteFile(t, root, "Makefile", "test:\n\tgo test ./...\n\nlint:\n\tgolangci-lint run\n")
+	testutil.WriteFile(t, root, "AGENTS.md", "Keep functions short.\n")
+	testutil.WriteFile(t, root, "web/package.json", `{"scripts": {"test": "vitest"}}`)
+	testutil.WriteFile(t, root, "web/AGENTS.md", "Use hooks.\n")
+
+	conventions, err := contextbuilder.DiscoverConventions([]string{filepath.Join(root, "web"), root}, 1000)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// The working directory's facts take precedence over the root's
+	assert.Expect(conventions.Facts).To(Equal([]contextbuilder.Fact{
+		{Kind: "test", Value: "npm run test", Source: "package.json"},
+		{Kind: "lint", Value: "make lint", Source: "../Makefile"},
+	}))
+	assert.Expect(conventions.Guides).To(HaveExactElements(
+		contextbuilder.Guide{Path: "AGENTS.md", Content: "Use hooks."},
+		contextbuilder.Guide{Path: "../AGENTS.md", Content: "Keep functions short."},
+		HaveField("Path", "../Makefile"),
+	))
+}
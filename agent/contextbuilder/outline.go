@@ -0,0 +1,50 @@
+package contextbuilder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxOutlineSymbols caps the number of symbols listed for a single file
+const maxOutlineSymbols = 50
+
+// outlinePatterns match top level declarations for common languages, keyed by
+// the language names reported by go-enry.
+var outlinePatterns = map[string]*regexp.Regexp{
+	"Go":         regexp.MustCompile(`^(?:func|type)\s+(?:\([^)]*\)\s*)?[A-Za-z_]\w*.*?(?:\{|$)`),
+	"Python":     regexp.MustCompile(`^\s*(?:async\s+)?(?:def|class)\s+\w+.*:`),
+	"Ruby":       regexp.MustCompile(`^\s*(?:def|class|module)\s+\S+`),
+	"JavaScript": regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?(?:function\*?\s+\w+|class\s+\w+|(?:const|let|var)\s+\w+\s*=\s*(?:async\s*)?(?:\([^)]*\)|\w+)\s*=>)`),
+	"TypeScript": regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:async\s+)?(?:function\*?\s+\w+|(?:abstract\s+)?class\s+\w+|interface\s+\w+|type\s+\w+|enum\s+\w+|(?:const|let|var)\s+\w+\s*=\s*(?:async\s*)?(?:\([^)]*\)|\w+)\s*=>)`),
+	"Rust":       regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:fn|struct|enum|trait|impl|mod)\b.*`),
+	"Java":       regexp.MustCompile(`^\s*(?:public|protected|private)\s+.*(?:class|interface|enum|record|\w+\s*\([^)]*\)).*`),
+	"Markdown":   regexp.MustCompile(`^#{1,3}\s+\S.*`),
+}
+
+// Outline returns the declarations found in content, one per line, so a file
+// can be summarized when its full contents do not fit in the context budget.
+func Outline(language, content string) []string {
+	pattern, ok := outlinePatterns[language]
+	if !ok {
+		return nil
+	}
+
+	var symbols []string
+
+	for _, line := range strings.Split(content, "\n") {
+		if !pattern.MatchString(line) {
+			continue
+		}
+
+		symbol := strings.TrimSpace(line)
+		symbol = strings.TrimSuffix(symbol, "{")
+		symbols = append(symbols, strings.TrimSpace(symbol))
+
+		if len(symbols) == maxOutlineSymbols {
+			symbols = append(symbols, "...")
+			break
+		}
+	}
+
+	return symbols
+}
@@ -0,0 +1,31 @@
+package contextbuilder_test
+
+import (
+	"testing"
+
+	"github.com/jtarchie/agent/agent/contextbuilder"
+	. "github.com/onsi/gomega"
+)
+
+func TestOutline(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(contextbuilder.Outline("Go", "package main\n\ntype Config struct {\n\tName string\n}\n\nfunc (c Config) Validate() error {\n\treturn nil\n}\n\nfunc main() {\n}\n")).To(Equal([]string{
+		"type Config struct",
+		"func (c Config) Validate() error",
+		"func main()",
+	}))
+
+	assert.Expect(contextbuilder.Outline("Python", "import os\n\nclass Runner:\n    def run(self):\n        pass\n\nasync def main():\n    pass\n")).To(Equal([]string{
+		"class Runner:",
+		"def run(self):",
+		"async def main():",
+	}))
+
+	assert.Expect(contextbuilder.Outline("TypeScript", "export interface Props {}\nexport const handler = async (req) => {}\nconst x = 1\n")).To(Equal([]string{
+		"export interface Props {}",
+		"export const handler = async (req) => {}",
+	}))
+
+	assert.Expect(contextbuilder.Outline("Unknown", "anything")).To(BeNil())
+}
@@ -0,0 +1,147 @@
+package contextbuilder
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/jtarchie/agent/agent/budget"
+)
+
+// maxRepoMapDepth limits how deep the repository map descends
+const maxRepoMapDepth = 4
+
+// skippedDirectories are never descended into when mapping a repository
+var skippedDirectories = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"__pycache__":  true,
+}
+
+// keyFilePatterns identify files worth naming in the repository map
+var keyFilePatterns = []string{
+	"README*",
+	"AGENTS.md",
+	"CONTRIBUTING*",
+	"go.mod",
+	"package.json",
+	"Cargo.toml",
+	"pyproject.toml",
+	"requirements*.txt",
+	"Gemfile",
+	"Makefile",
+	"Taskfile.y*ml",
+	"Dockerfile",
+	"main.*",
+	"index.*",
+	"app.*",
+	"server.*",
+}
+
+type directorySummary struct {
+	path     string
+	files    int
+	keyFiles []string
+}
+
+// BuildRepoMap renders a compact map of the directories and key files under
+// root, trimmed to fit within tokenBudget.
+func BuildRepoMap(root string, tokenBudget int) (string, error) {
+	summaries := map[string]*directorySummary{}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if relativePath != "." && (strings.HasPrefix(entry.Name(), ".") || skippedDirectories[entry.Name()]) {
+				return filepath.SkipDir
+			}
+
+			if strings.Count(relativePath, string(filepath.Separator)) >= maxRepoMapDepth {
+				return filepath.SkipDir
+			}
+
+			summaries[relativePath] = &directorySummary{path: relativePath}
+			return nil
+		}
+
+		if strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+
+		summary, ok := summaries[filepath.Dir(relativePath)]
+		if !ok {
+			return nil
+		}
+
+		summary.files++
+		if isKeyFile(entry.Name()) {
+			summary.keyFiles = append(summary.keyFiles, entry.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to map repository %s: %w", root, err)
+	}
+
+	paths := make([]string, 0, len(summaries))
+	for path := range summaries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var repoMap strings.Builder
+	repoMap.WriteString("Repository map (directories with file counts and key files):\n")
+
+	remaining := tokenBudget - budget.EstimateTokens(repoMap.String())
+
+	for index, path := range paths {
+		summary := summaries[path]
+
+		name := filepath.ToSlash(path) + "/"
+		if path == "." {
+			name = "./"
+		}
+
+		line := fmt.Sprintf("- %s (%d files)", name, summary.files)
+		if len(summary.keyFiles) > 0 {
+			line += ": " + strings.Join(summary.keyFiles, ", ")
+		}
+		line += "\n"
+
+		tokens := budget.EstimateTokens(line)
+		if tokens > remaining {
+			fmt.Fprintf(&repoMap, "- ... %d more directories omitted\n", len(paths)-index)
+			break
+		}
+
+		remaining -= tokens
+		repoMap.WriteString(line)
+	}
+
+	return repoMap.String(), nil
+}
+
+func isKeyFile(name string) bool {
+	for _, pattern := range keyFilePatterns {
+		if matched, _ := doublestar.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
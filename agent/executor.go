@@ -2,53 +2,397 @@ package main
 
 import (
 	"context"
-	"embed"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"strings"
+	"slices"
+	"time"
 
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/history"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/limits"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/prompts"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/report"
+	"github.com/jtarchie/agent/agent/telemetry"
 	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/agent/agent/usage"
+	"github.com/jtarchie/agent/agent/verify"
 	"github.com/jtarchie/outrageous/agent"
 	"github.com/jtarchie/outrageous/client"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ReplanError is returned when the executing agent reports that the plan
+// cannot be followed. It carries the execution so far for the planner.
+type ReplanError struct {
+	Report        *tools.PlanInvalidError
+	Transcript    string
+	ModifiedFiles []string
+	// Remaining holds the files not yet processed in batch mode, including
+	// the one being processed when the plan was abandoned.
+	Remaining []map[string]interface{}
+}
+
+func (e *ReplanError) Error() string {
+	return e.Report.Error()
+}
+
+func (e *ReplanError) Unwrap() error {
+	return e.Report
+}
+
 // Executor orchestrates the execution phase of the agent.
 type Executor struct {
-	cli       *CLI
-	pwd       string
-	promptsFS embed.FS
+	cli     *CLI
+	pwd     string
+	prompts *prompts.Loader
+	config  *config.Config
+	llm     *client.Client
+	// customTools and mcpTools are offered alongside the built-in tools
+	customTools []agent.Tool
+	mcpTools    []agent.Tool
+
+	contextBudget *budget.Budget
+	modifiedFiles *history.ModifiedFiles
+	guard         *limits.Guard
+	// conversation is the latest run's, continued to repair its changes
+	conversation *conversation
 }
 
 // NewExecutor creates a new Executor.
-func NewExecutor(cli *CLI, pwd string, promptsFS embed.FS) *Executor {
+func NewExecutor(cli *CLI, pwd string, loader *prompts.Loader, cfg *config.Config, llm *client.Client, customTools, mcpTools []agent.Tool) *Executor {
 	return &Executor{
-		cli:       cli,
-		pwd:       pwd,
-		promptsFS: promptsFS,
+		cli:           cli,
+		pwd:           pwd,
+		prompts:       loader,
+		config:        cfg,
+		llm:           llm,
+		customTools:   customTools,
+		mcpTools:      mcpTools,
+		modifiedFiles: history.NewModifiedFiles(pwd),
+		guard: limits.NewGuard(limits.Limits{
+			MaxToolCalls: cli.MaxToolCalls,
+			PerTool:      cli.ToolLimits,
+			MaxRepeats:   cli.MaxRepeats,
+		}),
+	}
+}
+
+// budget resolves the executing model's token budget once, so batch runs
+// do not probe the endpoint for every file.
+func (e *Executor) budget(ctx context.Context) budget.Budget {
+	if e.contextBudget == nil {
+		contextBudget := newBudget(ctx, e.config, e.cli.ExecutingProvider, e.cli.ExecutingApiEndpoint, e.cli.ExecutingModel, e.cli.ExecutingContextWindow)
+		e.contextBudget = &contextBudget
 	}
+
+	return *e.contextBudget
+}
+
+// conversation is the executing agent's run over a set of files, kept so
+// verification failures can be repaired in the same conversation.
+type conversation struct {
+	agent     *agent.Agent
+	messages  agent.Messages
+	compactor *history.Compactor
+	budget    budget.Budget
 }
 
-// Run executes the execution phase for a set of files.
-func (e *Executor) Run(plan string, fileInfos []map[string]interface{}) error {
-	// Load execution prompt template using the shared loadPromptTemplate function
-	executeTmpl, err := loadPromptTemplate(e.promptsFS, "execute.md")
+// Run executes the plan for a set of files. Its changes are verified
+// separately, see Verify.
+func (e *Executor) Run(ctx context.Context, plan string, fileInfos []map[string]interface{}) (err error) {
+	ctx, span := telemetry.Start(ctx, "executor.run",
+		attribute.String("model", e.cli.ExecutingModel),
+		attribute.Int("files", len(fileInfos)),
+	)
+	defer func() { telemetry.End(span, err) }()
+
+	ctx = provider.WithContextWindow(progress.WithAgent(ctx, "executing"), e.budget(ctx).Window)
+
+	conversation, err := e.startConversation(ctx, plan, fileInfos)
+	if err != nil {
+		return err
+	}
+
+	progress.Phase(ctx, "executing")
+
+	conversation.messages, err = e.runAgent(
+		ctx,
+		conversation.agent,
+		agent.Messages{
+			agent.Message{
+				Role:    "user",
+				Content: plan,
+			},
+		},
+		conversation.compactor,
+	)
+	if err != nil {
+		return err
+	}
+
+	e.conversation = conversation
+
+	return nil
+}
+
+// Verify runs the verification commands once the plan has been executed,
+// feeding failures back to the executing agent for repair. Repairs continue
+// the conversation of a single run. After a batch, no one file's run has
+// seen the others, so repairs start a new conversation over all the files.
+func (e *Executor) Verify(ctx context.Context, plan string, fileInfos []map[string]interface{}) (err error) {
+	profile, err := e.config.Profile(e.cli.Profile)
+	if err != nil {
+		return err
+	}
+
+	commands := e.verifyCommands(ctx, profile, fileInfos)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	ctx, span := telemetry.Start(ctx, "executor.verify",
+		attribute.StringSlice("commands", commands),
+	)
+	defer func() { telemetry.End(span, err) }()
+
+	ctx = provider.WithContextWindow(ctx, e.budget(ctx).Window)
+
+	ctx = progress.WithAgent(ctx, "executing")
+
+	conversation := e.conversation
+	if e.cli.Batch {
+		conversation = nil
+	}
+
+	for round := 1; ; round++ {
+		progress.Phase(ctx, "verifying")
+
+		result := verify.Run(ctx, e.pwd, commands, e.cli.VerifyTimeout)
+		report.Verified(ctx, result)
+		if result.Passed {
+			slog.Info("verify.passed", "commands", commands, "repair_rounds", round-1)
+			return nil
+		}
+
+		if round > e.cli.VerifyRounds {
+			return fmt.Errorf("%w after %d repair rounds: %s", verify.ErrFailed, e.cli.VerifyRounds, result.Summary())
+		}
+
+		slog.Warn("verify.failed", "summary", result.Summary(), "round", round, "max_rounds", e.cli.VerifyRounds)
+
+		err := interrupt.Check(ctx)
+		if err != nil {
+			return err
+		}
+
+		if conversation == nil {
+			conversation, err = e.startConversation(ctx, plan, fileInfos)
+			if err != nil {
+				return err
+			}
+		}
+
+		repairMessage, err := e.createRepairMessage(result, round, conversation.budget)
+		if err != nil {
+			return err
+		}
+
+		// A new conversation is told the plan that was carried out first
+		if len(conversation.messages) == 0 {
+			repairMessage = plan + "\n\n" + repairMessage
+		}
+
+		progress.Phase(ctx, fmt.Sprintf("repairing (round %d of %d)", round, e.cli.VerifyRounds))
+
+		conversation.messages, err = e.runAgent(
+			ctx,
+			conversation.agent,
+			append(conversation.messages, agent.Message{
+				Role:    "user",
+				Content: repairMessage,
+			}),
+			conversation.compactor,
+		)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startConversation creates the executing agent for a set of files.
+func (e *Executor) startConversation(ctx context.Context, plan string, fileInfos []map[string]interface{}) (*conversation, error) {
+	profile, err := e.config.Profile(e.cli.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes are found by comparing the workspace with how it was before
+	// the first conversation, whichever tool or command made them
+	e.modifiedFiles.Start()
+
+	contextBudget := e.budget(ctx)
+	toolsToInclude := progress.Track(e.guard.Track(budget.LimitToolOutputs(
+		report.Track(telemetry.Track(append(tools.Select(e.pwd, e.cli.Tools, e.customTools...), e.mcpTools...))),
+		contextBudget.MaxToolOutput(),
+	)))
+
+	if e.cli.MaxReplans > 0 {
+		toolsToInclude = append(toolsToInclude, tools.MustReportPlanInvalid())
+	}
+
+	executePrompt, err := e.executePrompt(ctx, plan, fileInfos, toolsToInclude)
+	if err != nil {
+		return nil, err
+	}
+
+	err = contextBudget.Check("execute prompt and plan", executePrompt, plan)
 	if err != nil {
-		return fmt.Errorf("failed to load execute prompt: %w", err)
+		return nil, err
+	}
+
+	var compactor *history.Compactor
+	if !profile.Compaction.Disabled {
+		compactor = &history.Compactor{
+			Budget:        contextBudget,
+			BaseTokens:    budget.EstimateTokens(executePrompt),
+			Threshold:     profile.Compaction.Threshold,
+			KeepRecent:    profile.Compaction.KeepRecent,
+			ModifiedFiles: e.modifiedFiles,
+			Summarize:     e.summarize,
+		}
 	}
 
-	var customPrompt []byte
-	customPromptPath := filepath.Join(e.pwd, ".prompts", "execute.md")
-	if _, err := os.Stat(customPromptPath); err == nil {
-		customPrompt, err = os.ReadFile(customPromptPath)
+	return &conversation{
+		agent:     e.createExecutingAgent(executePrompt, toolsToInclude),
+		compactor: compactor,
+		budget:    contextBudget,
+	}, nil
+}
+
+// runAgent runs the executing agent one model turn at a time until it gives
+// a final answer, compacting the history between turns when a compactor is
+// provided. It returns the history without the system prompt.
+func (e *Executor) runAgent(ctx context.Context, executingAgent *agent.Agent, messages agent.Messages, compactor *history.Compactor) (agent.Messages, error) {
+	for step := 1; ; step++ {
+		if e.cli.MaxSteps > 0 && step > e.cli.MaxSteps {
+			slog.Warn("execution.max_steps", "max_steps", e.cli.MaxSteps)
+			return nil, &limits.Error{Reason: fmt.Sprintf("max steps of %d reached", e.cli.MaxSteps)}
+		}
+
+		err := interrupt.Check(ctx)
+		if err != nil {
+			slog.Warn("execution.interrupted", "step", step)
+			return nil, err
+		}
+
+		err = usage.Check(ctx)
+		if err != nil {
+			slog.Warn("execution.budget_exceeded", "error", err)
+			return nil, err
+		}
+
+		response, err := executingAgent.Run(ctx, messages, agent.WithMaxMessages(1))
 		if err != nil {
-			return fmt.Errorf("failed to read custom execute prompt: %w", err)
+			var invalid *tools.PlanInvalidError
+			if errors.As(err, &invalid) {
+				slog.Warn("execution.plan_invalid", "step", invalid.Step, "reason", invalid.Reason)
+
+				return nil, &ReplanError{
+					Report:        invalid,
+					Transcript:    history.Transcript(messages),
+					ModifiedFiles: e.modifiedFiles.List(),
+				}
+			}
+
+			if errors.Is(err, limits.ErrExceeded) {
+				slog.Warn("execution.limit_exceeded", "step", step, "tool_calls", e.guard.ToolCalls(), "error", err)
+			}
+
+			return nil, fmt.Errorf("failed to run executing agent: %w", err)
+		}
+
+		// The agent prepends its system prompt on every run
+		messages = response.Messages[1:]
+
+		if isFinalAnswer(response) {
+			break
+		}
+
+		if compactor != nil {
+			messages, err = compactor.Compact(ctx, messages)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	toolsToInclude := tools.Select(e.pwd, e.cli.Tools)
+	slog.Debug("execution.agent", "response", messages[len(messages)-1].Content)
+	return messages, nil
+}
+
+// Changes returns the files changed in the workspace during execution with
+// how many lines were added and deleted.
+func (e *Executor) Changes() []history.Change {
+	return e.modifiedFiles.Changes()
+}
+
+// Diff returns a unified diff of the files changed in the workspace during
+// execution.
+func (e *Executor) Diff() string {
+	return e.modifiedFiles.Diff()
+}
+
+// verifyCommands determines the verification commands from the CLI, then the
+// profile, then auto-detection when enabled. Auto-detection falls back to the
+// language packs of the files when the project has no test task.
+func (e *Executor) verifyCommands(ctx context.Context, profile config.Profile, fileInfos []map[string]interface{}) []string {
+	if len(e.cli.Verify) > 0 {
+		return e.cli.Verify
+	}
+
+	if len(profile.Verify) > 0 {
+		return profile.Verify
+	}
+
+	if e.cli.VerifyAuto {
+		commands := verify.Detect(conventionDirs(ctx, e.pwd))
+		if len(commands) == 0 {
+			commands = e.languageVerifyCommands(ctx, fileInfos)
+		}
+
+		slog.Debug("verify.detected", "commands", commands)
+		return commands
+	}
+
+	return nil
+}
 
+// languageVerifyCommands returns the verification commands of the language
+// packs for the files' languages.
+func (e *Executor) languageVerifyCommands(ctx context.Context, fileInfos []map[string]interface{}) []string {
+	packs, err := e.prompts.Packs(detectLanguages(ctx, e.pwd, fileInfos))
+	if err != nil {
+		slog.Warn("verify.language_packs_failed", "error", err)
+		return []string{}
+	}
+
+	commands := []string{}
+	for _, pack := range packs {
+		if pack.Verify != "" && !slices.Contains(commands, pack.Verify) {
+			commands = append(commands, pack.Verify)
+		}
+	}
+
+	return commands
+}
+
+// executePrompt renders the execution prompt for a set of files.
+func (e *Executor) executePrompt(ctx context.Context, plan string, fileInfos []map[string]interface{}, toolsToInclude []agent.Tool) (string, error) {
 	isBatchSingleFile := e.cli.Batch && len(fileInfos) == 1
 
 	var currentFile interface{}
@@ -58,47 +402,89 @@ func (e *Executor) Run(plan string, fileInfos []map[string]interface{}) error {
 		currentFile = "" // Explicitly set to empty string if no files
 	}
 
-	// Execute template for execution agent
-	var executePromptBuf strings.Builder
-	err = executeTmpl.Execute(&executePromptBuf, map[string]interface{}{
+	packs, err := e.prompts.Packs(detectLanguages(ctx, e.pwd, fileInfos))
+	if err != nil {
+		return "", err
+	}
+
+	conventions, err := discoverConventions(ctx, e.pwd, e.cli.ConventionsTokens)
+	if err != nil {
+		return "", err
+	}
+
+	prompt, err := e.prompts.Render("execute.md", map[string]interface{}{
 		"Plan":             plan,
 		"Files":            fileInfos,
 		"Tools":            toolsToInclude,
-		"CustomPrompt":     string(customPrompt),
+		"Languages":        packs,
+		"Conventions":      conventions,
 		"BatchMode":        isBatchSingleFile,
 		"CurrentFile":      currentFile,
 		"WorkingDirectory": e.pwd,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to execute execute prompt template: %w", err)
+		return "", fmt.Errorf("failed to render execute prompt: %w", err)
+	}
+
+	return prompt, nil
+}
+
+// createRepairMessage renders the failed verification output for the executing agent.
+func (e *Executor) createRepairMessage(report verify.Report, round int, contextBudget budget.Budget) (string, error) {
+	failures := report.Failures()
+	for index := range failures {
+		failures[index].Output = budget.Truncate(failures[index].Output, contextBudget.MaxToolOutput()/len(failures))
+	}
+
+	verifyPrompt, err := e.prompts.Render("verify.md", map[string]interface{}{
+		"Failures":  failures,
+		"Round":     round,
+		"MaxRounds": e.cli.VerifyRounds,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render verify prompt: %w", err)
+	}
+
+	return verifyPrompt, nil
+}
+
+// summarize condenses earlier execution history using the executing model.
+func (e *Executor) summarize(ctx context.Context, transcript string) (string, error) {
+	summarizePrompt, err := e.prompts.Render("summarize.md", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to render summarize prompt: %w", err)
 	}
 
-	executingAgent := e.createExecutingAgent(executePromptBuf.String(), toolsToInclude)
+	summarizingAgent := agent.New(
+		"Summarizing Agent",
+		summarizePrompt,
+		agent.WithClient(e.llm),
+	)
 
-	response, err := executingAgent.Run(
-		context.Background(),
+	response, err := summarizingAgent.Run(
+		progress.WithAgent(ctx, "summarizer"),
 		agent.Messages{
 			agent.Message{
 				Role:    "user",
-				Content: plan,
+				Content: transcript,
 			},
 		},
+		agent.WithMaxMessages(1),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to run executing agent: %w", err)
+		return "", fmt.Errorf("failed to run summarizing agent: %w", err)
 	}
 
-	slog.Debug("execution.agent", "response", response.Messages[len(response.Messages)-1].Content)
-	return nil
+	return cleanResponse(response.Messages[len(response.Messages)-1].Content), nil
 }
 
 // RunBatch executes the plan for each file individually.
-func (e *Executor) RunBatch(plan string, allFileInfos []map[string]interface{}) error {
+func (e *Executor) RunBatch(ctx context.Context, plan string, allFileInfos []map[string]interface{}) error {
 	slog.Info("batch.start", "plan", plan)
 
 	if len(allFileInfos) == 0 {
 		slog.Info("batch.iter", "working_directory", e.pwd, "index", 1, "total", 1)
-		err := e.Run(plan, allFileInfos) // Use empty slice for fileInfos
+		err := e.Run(ctx, plan, allFileInfos) // Use empty slice for fileInfos
 		if err != nil {
 			return fmt.Errorf("execution failed for current directory: %w", err)
 		}
@@ -109,9 +495,39 @@ func (e *Executor) RunBatch(plan string, allFileInfos []map[string]interface{})
 	for i, fileInfo := range allFileInfos {
 		singleFileInfo := []map[string]interface{}{fileInfo}
 		fileName := fileInfo["filename"].(string)
+		err := interrupt.Check(ctx)
+		if err != nil {
+			return fmt.Errorf("stopped before file %s: %w", fileName, err)
+		}
+
 		slog.Info("batch.iter", "file", fileName, "index", i+1, "total", len(allFileInfos))
-		err := e.Run(plan, singleFileInfo)
+		progress.Emit(ctx, progress.Event{Kind: progress.FileStarted, File: fileName, Index: i + 1, Total: len(allFileInfos)})
+
+		started := time.Now()
+		fileCtx, span := telemetry.Start(ctx, "batch.file",
+			attribute.String("file", fileName),
+			attribute.Int("index", i+1),
+			attribute.Int("total", len(allFileInfos)),
+		)
+		err = e.Run(usage.WithFile(fileCtx, fileName), plan, singleFileInfo)
+		telemetry.End(span, err)
+		done := progress.Event{
+			Kind:       progress.FileDone,
+			File:       fileName,
+			Index:      i + 1,
+			Total:      len(allFileInfos),
+			DurationMS: time.Since(started).Milliseconds(),
+		}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		progress.Emit(ctx, done)
+
 		if err != nil {
+			var replan *ReplanError
+			if errors.As(err, &replan) {
+				replan.Remaining = allFileInfos[i:]
+			}
 			return fmt.Errorf("execution failed for file %s: %w", fileName, err)
 		}
 		slog.Info("batch.completed", "file", fileName)
@@ -126,11 +542,7 @@ func (e *Executor) createExecutingAgent(prompt string, toolsToUse []agent.Tool)
 	executingAgent := agent.New(
 		"Executing Agent",
 		prompt,
-		agent.WithClient(client.New(
-			e.cli.ExecutingApiEndpoint,
-			e.cli.ExecutingApiToken,
-			e.cli.ExecutingModel,
-		)),
+		agent.WithClient(e.llm),
 	)
 
 	toolNames := []string{}
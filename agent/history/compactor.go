@@ -0,0 +1,121 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// SummaryPrefix starts the message that replaces compacted history, so
+// a later compaction can fold the previous summary into the new one.
+const SummaryPrefix = "Summary of earlier progress (older tool calls and results were compacted):"
+
+// transcriptToolResultTokens caps each tool result shown to the summarizer
+const transcriptToolResultTokens = 500
+
+// Summarizer condenses a transcript of earlier work into a short summary.
+type Summarizer func(ctx context.Context, transcript string) (string, error)
+
+// Compactor keeps a conversation within its token budget by replacing older
+// tool calls and results with a model generated summary. The first message
+// (the plan), the record of modified files and the most recent messages are
+// always kept intact. The system prompt is not part of the history and is
+// accounted for with BaseTokens.
+type Compactor struct {
+	Budget budget.Budget
+	// BaseTokens are used by the system prompt sent with every request.
+	BaseTokens int
+	// Threshold is the share of the available budget that triggers compaction.
+	Threshold float64
+	// KeepRecent is the number of most recent messages kept verbatim.
+	KeepRecent int
+	// ModifiedFiles, if set, is pinned into the summary message.
+	ModifiedFiles *ModifiedFiles
+	Summarize     Summarizer
+}
+
+// NeedsCompaction reports whether messages have grown past the threshold.
+func (c Compactor) NeedsCompaction(messages agent.Messages) bool {
+	tokens := c.BaseTokens + budget.EstimateMessages(messages)
+	return float64(tokens) >= c.Threshold*float64(c.Budget.Available())
+}
+
+// Compact returns messages with older history summarized when the
+// conversation is near its budget, otherwise messages are returned as is.
+func (c Compactor) Compact(ctx context.Context, messages agent.Messages) (agent.Messages, error) {
+	if !c.NeedsCompaction(messages) {
+		return messages, nil
+	}
+
+	// messages[0] is the pinned plan, optionally followed by a previous summary
+	start := 1
+	previousSummary := ""
+	if len(messages) > 1 && messages[1].Role == "user" && strings.HasPrefix(messages[1].Content, SummaryPrefix) {
+		previousSummary = messages[1].Content
+		start = 2
+	}
+
+	// Never split a tool call from its result, so the kept history must not start with a tool result
+	cut := max(len(messages)-c.KeepRecent, start)
+	for cut < len(messages) && messages[cut].Role == "tool" {
+		cut++
+	}
+
+	if cut <= start {
+		slog.Warn("history.compaction_skipped", "reason", "nothing older than the recent messages", "messages", len(messages))
+		return messages, nil
+	}
+
+	transcript := previousSummary + "\n\n" + Transcript(messages[start:cut])
+	transcript = budget.Truncate(strings.TrimSpace(transcript), c.Budget.Available()/2)
+
+	summary, err := c.Summarize(ctx, transcript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize history: %w", err)
+	}
+
+	content := SummaryPrefix + "\n\n" + strings.TrimSpace(summary)
+	if c.ModifiedFiles != nil {
+		content += "\n\n" + c.ModifiedFiles.String()
+	}
+
+	compacted := agent.Messages{messages[0], {Role: "user", Content: content}}
+	compacted = append(compacted, messages[cut:]...)
+
+	slog.Info("history.compacted",
+		"messages_before", len(messages),
+		"messages_after", len(compacted),
+		"tokens_before", budget.EstimateMessages(messages),
+		"tokens_after", budget.EstimateMessages(compacted),
+	)
+
+	return compacted, nil
+}
+
+// Transcript renders messages as plain text for summarization, shortening
+// long tool results.
+func Transcript(messages agent.Messages) string {
+	var transcript strings.Builder
+
+	for _, message := range messages {
+		switch {
+		case message.Role == "tool":
+			fmt.Fprintf(&transcript, "[tool result: %s]\n%s\n\n", message.Name, budget.Truncate(message.Content, transcriptToolResultTokens))
+		case len(message.ToolCalls) > 0:
+			if message.Content != "" {
+				fmt.Fprintf(&transcript, "[%s]\n%s\n", message.Role, message.Content)
+			}
+			for _, toolCall := range message.ToolCalls {
+				fmt.Fprintf(&transcript, "[tool call: %s] %s\n\n", toolCall.Function.Name, toolCall.Function.Arguments)
+			}
+		default:
+			fmt.Fprintf(&transcript, "[%s]\n%s\n\n", message.Role, message.Content)
+		}
+	}
+
+	return strings.TrimSpace(transcript.String())
+}
@@ -0,0 +1,119 @@
+package history_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/agent/agent/history"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	"github.com/sashabaranov/go-openai"
+)
+
+// conversation builds a plan followed by count tool call and result pairs
+func conversation(count int) agent.Messages {
+	messages := agent.Messages{{Role: "user", Content: "PLAN: 1. read files 2. edit files"}}
+
+	for i := range count {
+		id := fmt.Sprintf("call_%d", i)
+		messages = append(messages,
+			agent.Message{Role: "assistant", ToolCalls: []openai.ToolCall{{
+				ID:       id,
+				Function: openai.FunctionCall{Name: "read_file", Arguments: fmt.Sprintf(`{"filePath": "file%d.go"}`, i)},
+			}}},
+			agent.Message{Role: "tool", ToolCallID: id, Name: "read_file", Content: strings.Repeat("x", 400)},
+		)
+	}
+
+	return messages
+}
+
+func TestCompactorLeavesSmallHistory(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	compactor := history.Compactor{
+		Budget:     budget.New("model", 100_000),
+		Threshold:  0.75,
+		KeepRecent: 4,
+		Summarize: func(ctx context.Context, transcript string) (string, error) {
+			return "", errors.New("should not be called")
+		},
+	}
+
+	messages := conversation(3)
+	compacted, err := compactor.Compact(context.Background(), messages)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(compacted).To(Equal(messages))
+}
+
+func TestCompactorSummarizesOlderMessages(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	modified := history.NewModifiedFiles(root)
+	modified.Start()
+	assert.Expect(os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0o600)).To(Succeed())
+
+	var transcripts []string
+	compactor := history.Compactor{
+		Budget:        budget.New("model", 1000),
+		BaseTokens:    100,
+		Threshold:     0.75,
+		KeepRecent:    3,
+		ModifiedFiles: modified,
+		Summarize: func(ctx context.Context, transcript string) (string, error) {
+			transcripts = append(transcripts, transcript)
+			return fmt.Sprintf("summary %d", len(transcripts)), nil
+		},
+	}
+
+	messages := conversation(10)
+	compacted, err := compactor.Compact(context.Background(), messages)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// The plan is pinned, followed by the summary and the recent messages
+	assert.Expect(compacted[0]).To(Equal(messages[0]))
+	assert.Expect(compacted[1].Role).To(Equal("user"))
+	assert.Expect(compacted[1].Content).To(HavePrefix(history.SummaryPrefix))
+	assert.Expect(compacted[1].Content).To(ContainSubstring("summary 1"))
+	assert.Expect(compacted[1].Content).To(ContainSubstring("Files modified so far:\n- main.go"))
+
+	// A tool result is never separated from its call
+	assert.Expect(compacted[2].Role).To(Equal("assistant"))
+	assert.Expect(compacted[2:]).To(Equal(messages[len(messages)-2:]))
+
+	assert.Expect(transcripts[0]).To(ContainSubstring(`[tool call: read_file] {"filePath": "file0.go"}`))
+	assert.Expect(transcripts[0]).To(ContainSubstring("[tool result: read_file]"))
+	assert.Expect(transcripts[0]).NotTo(ContainSubstring("file9.go"))
+
+	// Compacting again folds the previous summary into the new one
+	compacted = append(compacted, conversation(10)[1:]...)
+	compacted, err = compactor.Compact(context.Background(), compacted)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(transcripts[1]).To(ContainSubstring("summary 1"))
+	assert.Expect(compacted[1].Content).To(ContainSubstring("summary 2"))
+	assert.Expect(compacted[1].Content).NotTo(ContainSubstring("summary 1"))
+}
+
+func TestCompactorSummarizerError(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	compactor := history.Compactor{
+		Budget:     budget.New("model", 1000),
+		Threshold:  0.5,
+		KeepRecent: 2,
+		Summarize: func(ctx context.Context, transcript string) (string, error) {
+			return "", errors.New("model unavailable")
+		},
+	}
+
+	_, err := compactor.Compact(context.Background(), conversation(10))
+	assert.Expect(err).To(MatchError(ContainSubstring("model unavailable")))
+}
@@ -0,0 +1,224 @@
+package history
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each change in a diff.
+const contextLines = 3
+
+// maxDiffCells bounds the memory used to diff two files. Files that differ
+// too much are reported as replaced.
+const maxDiffCells = 4_000_000
+
+type editKind int
+
+const (
+	equal editKind = iota
+	inserted
+	deleted
+)
+
+type edit struct {
+	kind editKind
+	line string
+	// before and after are the 0-based line numbers in each version.
+	before int
+	after  int
+}
+
+// diffLines finds the shortest edit script from before to after with
+// Myers' algorithm.
+func diffLines(before, after []string) []edit {
+	n, m := len(before), len(after)
+	width := n + m
+	offset := width + 1
+	frontier := make([]int, 2*width+3)
+
+	var trace [][]int
+
+	for d := 0; d <= width; d++ {
+		if (d+1)*len(frontier) > maxDiffCells {
+			return replaced(before, after)
+		}
+
+		trace = append(trace, append([]int(nil), frontier...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && frontier[offset+k-1] < frontier[offset+k+1]) {
+				x = frontier[offset+k+1]
+			} else {
+				x = frontier[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && before[x] == after[y] {
+				x++
+				y++
+			}
+
+			frontier[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, before, after, offset)
+			}
+		}
+	}
+
+	return replaced(before, after)
+}
+
+// backtrack walks the recorded frontiers from the end to recover the edits.
+func backtrack(trace [][]int, before, after []string, offset int) []edit {
+	var edits []edit
+
+	x, y := len(before), len(after)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		frontier := trace[d]
+		k := x - y
+
+		var previousK int
+		if k == -d || (k != d && frontier[offset+k-1] < frontier[offset+k+1]) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+
+		previousX := frontier[offset+previousK]
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			x--
+			y--
+			edits = append(edits, edit{kind: equal, line: before[x], before: x, after: y})
+		}
+
+		if d > 0 {
+			if x == previousX {
+				edits = append(edits, edit{kind: inserted, line: after[previousY], before: x, after: previousY})
+			} else {
+				edits = append(edits, edit{kind: deleted, line: before[previousX], before: previousX, after: y})
+			}
+		}
+
+		x, y = previousX, previousY
+	}
+
+	for left, right := 0, len(edits)-1; left < right; left, right = left+1, right-1 {
+		edits[left], edits[right] = edits[right], edits[left]
+	}
+
+	return edits
+}
+
+// replaced deletes every line of before and inserts every line of after.
+func replaced(before, after []string) []edit {
+	edits := make([]edit, 0, len(before)+len(after))
+	for index, line := range before {
+		edits = append(edits, edit{kind: deleted, line: line, before: index})
+	}
+	for index, line := range after {
+		edits = append(edits, edit{kind: inserted, line: line, before: len(before), after: index})
+	}
+
+	return edits
+}
+
+// lineChanges counts the lines added and deleted between two versions.
+func lineChanges(before, after string) (int, int) {
+	added, removed := 0, 0
+
+	for _, change := range diffLines(splitLines(before), splitLines(after)) {
+		switch change.kind {
+		case inserted:
+			added++
+		case deleted:
+			removed++
+		}
+	}
+
+	return added, removed
+}
+
+// unifiedDiff renders the changes to path in unified diff format, or an
+// empty string when there are none. A nil before is a created file, and a nil
+// after is a removed one.
+func unifiedDiff(path string, before, after []byte) string {
+	edits := diffLines(splitLines(string(before)), splitLines(string(after)))
+
+	var changed []int
+	for index, change := range edits {
+		if change.kind != equal {
+			changed = append(changed, index)
+		}
+	}
+
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+
+	switch {
+	case before == nil:
+		fmt.Fprintf(&out, "--- /dev/null\n+++ b/%s\n", path)
+	case after == nil:
+		fmt.Fprintf(&out, "--- a/%s\n+++ /dev/null\n", path)
+	default:
+		fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+	}
+
+	for start := 0; start < len(changed); {
+		// Group changes whose context overlaps into one hunk
+		end := start
+		for end+1 < len(changed) && changed[end+1]-changed[end] <= 2*contextLines {
+			end++
+		}
+
+		first := max(changed[start]-contextLines, 0)
+		last := min(changed[end]+contextLines, len(edits)-1)
+		writeHunk(&out, edits[first:last+1])
+
+		start = end + 1
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []edit) {
+	beforeCount, afterCount := 0, 0
+	for _, change := range edits {
+		if change.kind != inserted {
+			beforeCount++
+		}
+		if change.kind != deleted {
+			afterCount++
+		}
+	}
+
+	beforeStart, afterStart := edits[0].before+1, edits[0].after+1
+	if beforeCount == 0 {
+		beforeStart--
+	}
+	if afterCount == 0 {
+		afterStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", beforeStart, beforeCount, afterStart, afterCount)
+
+	prefixes := map[editKind]string{equal: " ", inserted: "+", deleted: "-"}
+	for _, change := range edits {
+		out.WriteString(prefixes[change.kind] + change.line + "\n")
+	}
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,233 @@
+package history
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDiffedFileSize is the size above which a file's contents are not kept
+// for diffs. Larger files are compared by hash and listed without line counts.
+const maxDiffedFileSize = 1 << 20
+
+// skippedDirectories hold version control data, installed dependencies and
+// build output, which are not part of a change.
+var skippedDirectories = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	".venv":        true,
+	"__pycache__":  true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+}
+
+// ModifiedFiles finds the files changed during a run by comparing the
+// workspace with a snapshot taken before it, so changes made by any tool,
+// command or script are found.
+type ModifiedFiles struct {
+	mu     sync.Mutex
+	root   string
+	before map[string]fileState
+	// latest is the most recent snapshot, so files that have not changed
+	// since are not read again.
+	latest map[string]fileState
+}
+
+// Change is how many lines were added to and deleted from a file.
+type Change struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Created bool   `json:"created,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// fileState is a file's content at the time of a snapshot.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	hash    [sha256.Size]byte
+	// contents is nil for files larger than maxDiffedFileSize.
+	contents []byte
+}
+
+// NewModifiedFiles creates a record of modified files, reported relative to root.
+func NewModifiedFiles(root string) *ModifiedFiles {
+	return &ModifiedFiles{root: root}
+}
+
+// Start snapshots the workspace before the run changes it. Only the first
+// call takes a snapshot, so repeated executions compare against the original.
+func (m *ModifiedFiles) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.before != nil {
+		return
+	}
+
+	m.before = snapshot(m.root, nil)
+	m.latest = m.before
+}
+
+// compare snapshots the workspace again, returning the sorted paths whose
+// contents differ from the snapshot taken by Start, including created and
+// removed files.
+func (m *ModifiedFiles) compare() ([]string, map[string]fileState) {
+	if m.before == nil {
+		return nil, nil
+	}
+
+	current := snapshot(m.root, m.latest)
+	m.latest = current
+
+	paths := []string{}
+	for path, state := range current {
+		if before, ok := m.before[path]; !ok || before.hash != state.hash {
+			paths = append(paths, path)
+		}
+	}
+	for path := range m.before {
+		if _, ok := current[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	return paths, current
+}
+
+// Changes compares each modified file with its content before the run.
+func (m *ModifiedFiles) Changes() []Change {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths, current := m.compare()
+	changes := make([]Change, 0, len(paths))
+
+	for _, path := range paths {
+		before, existed := m.before[path]
+		after, exists := current[path]
+
+		added, deleted := lineChanges(string(before.contents), string(after.contents))
+		changes = append(changes, Change{
+			Path:    path,
+			Added:   added,
+			Deleted: deleted,
+			Created: !existed,
+			Removed: !exists,
+		})
+	}
+
+	return changes
+}
+
+// Diff returns a unified diff of each modified file against its content
+// before the run.
+func (m *ModifiedFiles) Diff() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths, current := m.compare()
+
+	var diff strings.Builder
+
+	for _, path := range paths {
+		before, existed := m.before[path]
+		after, exists := current[path]
+
+		if (existed && before.contents == nil) || (exists && after.contents == nil) {
+			fmt.Fprintf(&diff, "Files a/%s and b/%s differ\n", path, path)
+			continue
+		}
+
+		diff.WriteString(unifiedDiff(path, before.contents, after.contents))
+	}
+
+	return diff.String()
+}
+
+// List returns the modified files in path order.
+func (m *ModifiedFiles) List() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths, _ := m.compare()
+	return paths
+}
+
+// String renders the record for inclusion in the conversation.
+func (m *ModifiedFiles) String() string {
+	files := m.List()
+	if len(files) == 0 {
+		return "Files modified so far: none"
+	}
+
+	return "Files modified so far:\n- " + strings.Join(files, "\n- ")
+}
+
+// snapshot reads the regular files under root, keyed by their path relative
+// to it. Files whose size and modification time match previous are not read
+// again.
+func snapshot(root string, previous map[string]fileState) map[string]fileState {
+	files := map[string]fileState{}
+
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		// Unreadable entries are left out rather than failing the run
+		if err != nil {
+			return nil
+		}
+
+		if entry.IsDir() {
+			if path != root && skippedDirectories[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+
+		if state, ok := previous[relativePath]; ok && state.size == info.Size() && state.modTime.Equal(info.ModTime()) {
+			files[relativePath] = state
+			return nil
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		state := fileState{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			hash:    sha256.Sum256(contents),
+		}
+		if len(contents) <= maxDiffedFileSize {
+			state.contents = contents
+		}
+
+		files[relativePath] = state
+		return nil
+	})
+
+	return files
+}
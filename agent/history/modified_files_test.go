@@ -0,0 +1,72 @@
+package history_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/history"
+	. "github.com/onsi/gomega"
+)
+
+func TestModifiedFiles(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		assert.Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		assert.Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	write("main.go", "one\ntwo\nthree\n")
+	write("same.go", "same\n")
+	write("gone.go", "bye\n")
+	write("node_modules/dep/index.js", "dep\n")
+
+	modified := history.NewModifiedFiles(root)
+	assert.Expect(modified.String()).To(Equal("Files modified so far: none"))
+
+	modified.Start()
+	assert.Expect(modified.Changes()).To(BeEmpty())
+
+	// Changes are found however they were made, and rewriting a file with
+	// the same content is not a change
+	write("main.go", "one\n2\nthree\n")
+	write("main.go", "one\n2\nthree\nfour\n")
+	write("same.go", "same\n")
+	write("lib/new.go", "a\nb\n")
+	write("node_modules/dep/index.js", "changed\n")
+	assert.Expect(os.Remove(filepath.Join(root, "gone.go"))).To(Succeed())
+
+	// A later start keeps the original snapshot
+	modified.Start()
+
+	assert.Expect(modified.List()).To(Equal([]string{"gone.go", "lib/new.go", "main.go"}))
+	assert.Expect(modified.String()).To(Equal("Files modified so far:\n- gone.go\n- lib/new.go\n- main.go"))
+
+	assert.Expect(modified.Changes()).To(Equal([]history.Change{
+		{Path: "gone.go", Added: 0, Deleted: 1, Removed: true},
+		{Path: "lib/new.go", Added: 2, Deleted: 0, Created: true},
+		{Path: "main.go", Added: 2, Deleted: 1},
+	}))
+
+	assert.Expect(modified.Diff()).To(Equal(`--- a/gone.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-bye
+--- /dev/null
++++ b/lib/new.go
+@@ -0,0 +1,2 @@
++a
++b
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ one
+-two
++2
+ three
++four
+`))
+}
@@ -0,0 +1,63 @@
+// Package testutil holds the helpers shared by the packages' tests, such as
+// creating files and git repositories.
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// WriteFile writes content to name in dir, creating its directories.
+func WriteFile(t *testing.T, dir, name, content string) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+}
+
+// NewGitRepo creates a temporary repository with the files committed on
+// main. Symlinks in its path (e.g. /tmp on macOS) are resolved, so it
+// matches the paths git reports.
+func NewGitRepo(t *testing.T, files map[string]string) string {
+	assert := NewGomegaWithT(t)
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	Git(t, dir, "init", "--quiet", "--initial-branch=main")
+
+	for name, content := range files {
+		WriteFile(t, dir, name, content)
+	}
+
+	Git(t, dir, "add", ".")
+	Git(t, dir, "commit", "--quiet", "-m", "initial commit")
+
+	return dir
+}
+
+// Git runs a git command in dir as a test user, failing the test with its
+// output when it fails.
+func Git(t *testing.T, dir string, args ...string) {
+	assert := NewGomegaWithT(t)
+
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	command.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test User",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test User",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+	)
+
+	output, err := command.CombinedOutput()
+	assert.Expect(err).NotTo(HaveOccurred(), string(output))
+}
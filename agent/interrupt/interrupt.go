@@ -0,0 +1,114 @@
+package interrupt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ErrInterrupted is returned when a run stops early because a stop was
+// requested.
+var ErrInterrupted = errors.New("interrupted")
+
+// Stopper lets a run be stopped in two stages: a graceful stop, which lets
+// the current model request or tool call finish before the run ends, and an
+// abort, which cancels the run's context.
+type Stopper struct {
+	stopping chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+}
+
+type stopperKey struct{}
+
+// New returns a context that is cancelled when the run is aborted, carrying
+// the stopper for Requested and Check.
+func New(parent context.Context) (context.Context, *Stopper) {
+	ctx, cancel := context.WithCancel(parent)
+
+	stopper := &Stopper{
+		stopping: make(chan struct{}),
+		cancel:   cancel,
+	}
+
+	return context.WithValue(ctx, stopperKey{}, stopper), stopper
+}
+
+// Stop requests a graceful stop.
+func (s *Stopper) Stop() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// Abort stops the run immediately by cancelling its context.
+func (s *Stopper) Abort() {
+	s.Stop()
+	s.cancel()
+}
+
+// Stopping is closed once a stop has been requested.
+func (s *Stopper) Stopping() <-chan struct{} {
+	return s.stopping
+}
+
+// Notify stops the run on the first of signals and aborts it on the second,
+// writing what happens to w. After an abort, signals are handled by the
+// default behaviour again. The returned function stops listening.
+func (s *Stopper) Notify(w io.Writer, signals ...os.Signal) func() {
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, signals...)
+
+	done := make(chan struct{})
+	var doneOnce sync.Once
+
+	go func() {
+		defer signal.Stop(received)
+
+		for count := 1; ; count++ {
+			select {
+			case <-done:
+				return
+			case sig := <-received:
+				if count == 1 {
+					_, _ = fmt.Fprintf(w, "\nreceived %s, stopping after the current step (repeat to abort)\n", sig)
+					s.Stop()
+					continue
+				}
+
+				_, _ = fmt.Fprintf(w, "\nreceived %s again, aborting\n", sig)
+				s.Abort()
+				return
+			}
+		}
+	}()
+
+	return func() { doneOnce.Do(func() { close(done) }) }
+}
+
+// Requested reports whether a stop was requested for the run in ctx.
+func Requested(ctx context.Context) bool {
+	stopper, ok := ctx.Value(stopperKey{}).(*Stopper)
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-stopper.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check returns ErrInterrupted once a stop was requested for the run in ctx,
+// or the cause of the context's cancellation.
+func Check(ctx context.Context) error {
+	if Requested(ctx) {
+		return ErrInterrupted
+	}
+
+	return context.Cause(ctx)
+}
@@ -0,0 +1,70 @@
+package interrupt_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/interrupt"
+	. "github.com/onsi/gomega"
+)
+
+func TestStopper(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	ctx, stopper := interrupt.New(context.Background())
+	assert.Expect(interrupt.Requested(ctx)).To(BeFalse())
+	assert.Expect(interrupt.Check(ctx)).To(Succeed())
+
+	stopper.Stop()
+	stopper.Stop()
+	assert.Expect(interrupt.Requested(ctx)).To(BeTrue())
+	assert.Expect(interrupt.Check(ctx)).To(MatchError(interrupt.ErrInterrupted))
+	assert.Expect(ctx.Err()).NotTo(HaveOccurred())
+
+	stopper.Abort()
+	assert.Expect(ctx.Err()).To(MatchError(context.Canceled))
+
+	// Contexts without a stopper are never stopped
+	assert.Expect(interrupt.Check(context.Background())).To(Succeed())
+}
+
+// lockedBuffer is a bytes.Buffer that is safe to write from the signal
+// handler while the test reads it.
+type lockedBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.String()
+}
+
+func TestNotify(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	ctx, stopper := interrupt.New(context.Background())
+
+	out := &lockedBuffer{}
+	stop := stopper.Notify(out, syscall.SIGUSR1)
+	defer stop()
+
+	assert.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(Succeed())
+	assert.Eventually(stopper.Stopping()).Should(BeClosed())
+	assert.Expect(ctx.Err()).NotTo(HaveOccurred())
+	assert.Eventually(out.String).Should(ContainSubstring("stopping after the current step"))
+
+	assert.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(Succeed())
+	assert.Eventually(ctx.Done()).Should(BeClosed())
+	assert.Eventually(out.String).Should(ContainSubstring("aborting"))
+}
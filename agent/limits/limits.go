@@ -0,0 +1,156 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// ErrExceeded is wrapped by every Error, to test for any exceeded limit.
+var ErrExceeded = errors.New("limit exceeded")
+
+// Error reports which limit ended the run.
+type Error struct {
+	// Reason describes the limit, such as "max tool calls of 50 reached".
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", ErrExceeded, e.Reason)
+}
+
+func (e *Error) Unwrap() error {
+	return ErrExceeded
+}
+
+// WithTimeout returns a context that is cancelled once timeout has passed,
+// with an *Error as its cause. A zero timeout never cancels it.
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithTimeoutCause(parent, timeout, &Error{Reason: fmt.Sprintf("timeout of %s reached", timeout)})
+}
+
+// Limits caps what the executing agent may do. Zero means no limit.
+type Limits struct {
+	// MaxToolCalls caps tool calls across the run.
+	MaxToolCalls int
+	// PerTool caps the calls of individual tools across the run.
+	PerTool map[string]int
+	// MaxRepeats is how many times the same call may return the same result
+	// before the model is nudged to change course. The run ends if it keeps
+	// repeating the call as many times again.
+	MaxRepeats int
+}
+
+// Guard enforces limits on tool calls. It is safe for concurrent use.
+type Guard struct {
+	limits Limits
+
+	mu      sync.Mutex
+	calls   int
+	perTool map[string]int
+	repeats map[string]int
+}
+
+// NewGuard creates a guard for limits.
+func NewGuard(limits Limits) *Guard {
+	return &Guard{
+		limits:  limits,
+		perTool: map[string]int{},
+		repeats: map[string]int{},
+	}
+}
+
+// ToolCalls returns the number of tool calls made so far.
+func (g *Guard) ToolCalls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.calls
+}
+
+// Track wraps tools so their calls count against the limits. A call over a
+// limit fails with an *Error instead of running, and a repeated call has a
+// nudge added to its result.
+func (g *Guard) Track(tools []agent.Tool) []agent.Tool {
+	tracked := make([]agent.Tool, 0, len(tools))
+
+	for _, tool := range tools {
+		next := tool.Func
+		name := tool.Name
+
+		tool.Func = func(ctx context.Context, params map[string]any) (any, error) {
+			err := g.count(name)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := next(ctx, params)
+			if err != nil {
+				return value, err
+			}
+
+			return g.checkRepeat(name, params, value)
+		}
+
+		tracked = append(tracked, tool)
+	}
+
+	return tracked
+}
+
+// count records a call of the named tool, failing when it is over a limit.
+func (g *Guard) count(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.limits.MaxToolCalls > 0 && g.calls >= g.limits.MaxToolCalls {
+		return &Error{Reason: fmt.Sprintf("max tool calls of %d reached", g.limits.MaxToolCalls)}
+	}
+
+	if limit := g.limits.PerTool[name]; limit > 0 && g.perTool[name] >= limit {
+		return &Error{Reason: fmt.Sprintf("max calls of %s (%d) reached", name, limit)}
+	}
+
+	g.calls++
+	g.perTool[name]++
+
+	return nil
+}
+
+// checkRepeat counts identical calls with identical results. The result is
+// returned with a nudge once the call repeats too often, and the run ends if
+// the model keeps repeating it regardless.
+func (g *Guard) checkRepeat(name string, params map[string]any, value any) (any, error) {
+	if g.limits.MaxRepeats <= 0 {
+		return value, nil
+	}
+
+	// Marshalling sorts map keys, so equal arguments give equal keys
+	arguments, _ := json.Marshal(params)
+	key := fmt.Sprintf("%s\x00%s\x00%s", name, arguments, value)
+
+	g.mu.Lock()
+	g.repeats[key]++
+	count := g.repeats[key]
+	g.mu.Unlock()
+
+	switch {
+	case count >= 2*g.limits.MaxRepeats:
+		return nil, &Error{Reason: fmt.Sprintf("%s was called %d times with the same arguments and result", name, count)}
+	case count >= g.limits.MaxRepeats:
+		return fmt.Sprintf("%s\n\nNote: you have called %s with these arguments %d times and received the same result each time. "+
+			"Calling it again will not change the result. Use what you have already learned, try a different approach, or give your final answer.",
+			value, name, count), nil
+	default:
+		return value, nil
+	}
+}
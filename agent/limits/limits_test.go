@@ -0,0 +1,120 @@
+package limits_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/limits"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+)
+
+func echoTool(name string) agent.Tool {
+	return agent.Tool{
+		Name: name,
+		Func: func(_ context.Context, params map[string]any) (any, error) {
+			return params["query"], nil
+		},
+	}
+}
+
+func TestMaxToolCalls(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	guard := limits.NewGuard(limits.Limits{MaxToolCalls: 2})
+	tools := guard.Track([]agent.Tool{echoTool("search_files"), echoTool("read_file")})
+
+	_, err := tools[0].Func(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	_, err = tools[1].Func(context.Background(), map[string]any{"query": "b"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools[0].Func(context.Background(), map[string]any{"query": "c"})
+	assert.Expect(err).To(MatchError(limits.ErrExceeded))
+	assert.Expect(err).To(MatchError(ContainSubstring("max tool calls of 2 reached")))
+	assert.Expect(guard.ToolCalls()).To(Equal(2))
+}
+
+func TestPerToolLimit(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	guard := limits.NewGuard(limits.Limits{PerTool: map[string]int{"search_files": 1}})
+	tools := guard.Track([]agent.Tool{echoTool("search_files"), echoTool("read_file")})
+
+	_, err := tools[0].Func(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools[0].Func(context.Background(), map[string]any{"query": "b"})
+	assert.Expect(err).To(MatchError(ContainSubstring("max calls of search_files (1) reached")))
+
+	// Other tools are not limited
+	for range 3 {
+		_, err = tools[1].Func(context.Background(), map[string]any{"query": "c"})
+		assert.Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+func TestRepeatedCalls(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	guard := limits.NewGuard(limits.Limits{MaxRepeats: 2})
+	tools := guard.Track([]agent.Tool{echoTool("search_files")})
+	search := tools[0].Func
+
+	value, err := search(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(Equal("a"))
+
+	value, err = search(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(HavePrefix("a\n\nNote: you have called search_files with these arguments 2 times"))
+
+	// Different arguments are counted separately
+	value, err = search(context.Background(), map[string]any{"query": "b"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(Equal("b"))
+
+	_, err = search(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = search(context.Background(), map[string]any{"query": "a"})
+	assert.Expect(err).To(MatchError(limits.ErrExceeded))
+	assert.Expect(err).To(MatchError(ContainSubstring("search_files was called 4 times")))
+}
+
+func TestToolErrorsAreNotRepeats(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	failure := errors.New("no such file")
+	guard := limits.NewGuard(limits.Limits{MaxRepeats: 1})
+	tools := guard.Track([]agent.Tool{{
+		Name: "read_file",
+		Func: func(context.Context, map[string]any) (any, error) {
+			return nil, failure
+		},
+	}})
+
+	for range 3 {
+		_, err := tools[0].Func(context.Background(), map[string]any{})
+		assert.Expect(err).To(MatchError(failure))
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	ctx, cancel := limits.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	assert.Expect(interrupt.Check(ctx)).To(MatchError(limits.ErrExceeded))
+	assert.Expect(interrupt.Check(ctx)).To(MatchError(ContainSubstring("timeout of 1ms reached")))
+
+	// A zero timeout never expires
+	ctx, cancel = limits.WithTimeout(context.Background(), 0)
+	defer cancel()
+	assert.Expect(ctx.Err()).NotTo(HaveOccurred())
+}
@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Log formats.
+const (
+	Text = "text"
+	JSON = "json"
+)
+
+// Options controls how log records are written.
+type Options struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string
+	// Format is text or json.
+	Format string
+	// Redactor masks secrets in logged values, if set.
+	Redactor *Redactor
+}
+
+// New creates a logger writing records to w.
+func New(w io.Writer, options Options) (*slog.Logger, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(options.Level))
+	if err != nil {
+		return nil, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", options.Level)
+	}
+
+	handlerOptions := &slog.HandlerOptions{
+		Level: level,
+	}
+	if options.Redactor != nil {
+		handlerOptions.ReplaceAttr = options.Redactor.replaceAttr
+	}
+
+	switch options.Format {
+	case Text, "":
+		return slog.New(slog.NewTextHandler(w, handlerOptions)), nil
+	case JSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOptions)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", options.Format)
+	}
+}
+
+// Mask replaces redacted text.
+const Mask = "[REDACTED]"
+
+// DefaultPatterns match common credential formats.
+var DefaultPatterns = []string{
+	// OpenAI and Anthropic API keys
+	`sk-[A-Za-z0-9_-]{16,}`,
+	// GitHub tokens
+	`gh[pousr]_[A-Za-z0-9]{20,}`,
+	// AWS access key IDs
+	`AKIA[0-9A-Z]{16}`,
+	// Bearer tokens in headers
+	`(?i)bearer\s+[A-Za-z0-9._~+/=-]{8,}`,
+}
+
+// Redactor masks known secrets and text matching secret patterns.
+type Redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor creates a redactor for the literal secrets, such as API
+// tokens, and the regular expressions in patterns.
+func NewRedactor(secrets []string, patterns []string) (*Redactor, error) {
+	redactor := &Redactor{}
+
+	for _, secret := range secrets {
+		// Short values would mask unrelated text
+		if len(strings.TrimSpace(secret)) >= 4 {
+			redactor.secrets = append(redactor.secrets, secret)
+		}
+	}
+
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile redaction pattern %q: %w", pattern, err)
+		}
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+
+	return redactor, nil
+}
+
+// Redact returns text with every secret masked.
+func (r *Redactor) Redact(text string) string {
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, Mask)
+	}
+
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllString(text, Mask)
+	}
+
+	return text
+}
+
+// replaceAttr redacts string values, errors, and the strings within lists
+// and maps, such as tool parameters, in log records.
+func (r *Redactor) replaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.Redact(value.String()))
+	case slog.KindAny:
+		attr.Value = slog.AnyValue(r.redactValue(value.Any()))
+	}
+
+	return attr
+}
+
+// redactValue masks the secrets in a value, recursing into lists and maps.
+// Other values are returned as they are.
+func (r *Redactor) redactValue(value any) any {
+	switch typed := value.(type) {
+	case string:
+		return r.Redact(typed)
+	case error:
+		return r.Redact(typed.Error())
+	case fmt.Stringer:
+		return r.Redact(typed.String())
+	case []string:
+		redacted := make([]string, len(typed))
+		for index, text := range typed {
+			redacted[index] = r.Redact(text)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(typed))
+		for index, item := range typed {
+			redacted[index] = r.redactValue(item)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(typed))
+		for key, text := range typed {
+			redacted[key] = r.Redact(text)
+		}
+		return redacted
+	case map[string]any:
+		redacted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			redacted[key] = r.redactValue(item)
+		}
+		return redacted
+	}
+
+	return value
+}
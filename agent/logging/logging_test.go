@@ -0,0 +1,72 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/logging"
+	. "github.com/onsi/gomega"
+)
+
+func TestRedact(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	redactor, err := logging.NewRedactor(
+		[]string{"my-planning-token", "", "ab"},
+		append(logging.DefaultPatterns, `password=\S+`),
+	)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(redactor.Redact("token my-planning-token used")).To(Equal("token [REDACTED] used"))
+	assert.Expect(redactor.Redact("key sk-abcdefghijklmnopqrstuvwxyz")).To(Equal("key [REDACTED]"))
+	assert.Expect(redactor.Redact("Authorization: Bearer abc.def.ghi123")).To(Equal("Authorization: [REDACTED]"))
+	assert.Expect(redactor.Redact("url?password=hunter2 ok")).To(Equal("url?[REDACTED] ok"))
+	assert.Expect(redactor.Redact("about a cab")).To(Equal("about a cab"))
+
+	_, err = logging.NewRedactor(nil, []string{"("})
+	assert.Expect(err).To(MatchError(ContainSubstring("failed to compile redaction pattern")))
+}
+
+func TestNew(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	redactor, err := logging.NewRedactor([]string{"secret-token"}, nil)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	var out bytes.Buffer
+	logger, err := logging.New(&out, logging.Options{Level: "info", Format: logging.JSON, Redactor: redactor})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	logger.Debug("hidden")
+	logger.Info("executing.agent",
+		"prompt", "use secret-token",
+		"error", errors.New("401 for secret-token"),
+		"commands", []string{"curl -H secret-token"},
+		"params", map[string]any{"command": "curl -H secret-token", "args": []any{"secret-token", 1}},
+	)
+
+	var record map[string]any
+	assert.Expect(json.Unmarshal(out.Bytes(), &record)).To(Succeed())
+	assert.Expect(record["msg"]).To(Equal("executing.agent"))
+	assert.Expect(record["prompt"]).To(Equal("use [REDACTED]"))
+	assert.Expect(record["error"]).To(Equal("401 for [REDACTED]"))
+	assert.Expect(record["commands"]).To(Equal([]any{"curl -H [REDACTED]"}))
+	assert.Expect(record["params"]).To(Equal(map[string]any{"command": "curl -H [REDACTED]", "args": []any{"[REDACTED]", 1.0}}))
+
+	out.Reset()
+	logger, err = logging.New(&out, logging.Options{Level: "warn"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	logger.Info("quiet")
+	logger.Warn("loud", "key", "value")
+	assert.Expect(out.String()).To(ContainSubstring("level=WARN msg=loud key=value"))
+	assert.Expect(out.String()).NotTo(ContainSubstring("quiet"))
+
+	_, err = logging.New(&out, logging.Options{Level: "verbose"})
+	assert.Expect(err).To(MatchError(ContainSubstring("unknown log level")))
+
+	_, err = logging.New(&out, logging.Options{Level: "info", Format: "xml"})
+	assert.Expect(err).To(MatchError(ContainSubstring("unknown log format")))
+}
@@ -1,40 +1,127 @@
 package main
 
 import (
-	"embed"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-	"text/template"
+	"syscall"
+	"time"
 
-	"github.com/Masterminds/sprig/v3"
 	"github.com/alecthomas/kong"
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/go-enry/go-enry/v2"
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/contextbuilder"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/limits"
+	"github.com/jtarchie/agent/agent/logging"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/report"
+	"github.com/jtarchie/agent/agent/session"
+	"github.com/jtarchie/agent/agent/telemetry"
+	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/agent/agent/usage"
+	"github.com/jtarchie/agent/agent/workspace"
+	"github.com/jtarchie/outrageous/agent"
+	"github.com/jtarchie/outrageous/client"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-//go:embed prompts
-var promptsFS embed.FS
-
 func main() {
-	// Set up logging
-	setupLogging()
-
 	// Parse CLI arguments
-	cli := &CLI{}
-	ctx := kong.Parse(cli)
+	commands := &Commands{}
+	ctx := kong.Parse(commands)
 
-	// Run the command
+	// Run the command, exiting with the code of its outcome
 	err := ctx.Run()
-	ctx.FatalIfErrorf(err)
+	ctx.FatalIfErrorf(report.Exit(err))
+}
+
+// setup configures logging and tracing from the flags. The returned function
+// flushes traces and closes the log file.
+func (s *Settings) setup(cfg *config.Config) (func(), error) {
+	closeLog, err := s.setupLogging(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Options{
+		Endpoint: s.OtlpEndpoint,
+		File:     s.TraceFile,
+	})
+	if err != nil {
+		closeLog()
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			slog.Warn("telemetry.shutdown_failed", "error", err)
+		}
+
+		closeLog()
+	}, nil
+}
+
+// setupLogging configures the default logger from the flags, redacting API
+// tokens and the configured secret patterns. The returned function closes
+// the log file.
+func (s *Settings) setupLogging(cfg *config.Config) (func(), error) {
+	secrets := append([]string{s.PlanningApiToken, s.ExecutingApiToken}, cfg.Tokens()...)
+
+	redactor, err := logging.NewRedactor(secrets, append(logging.DefaultPatterns, cfg.Logging.Redact...))
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	closeLog := func() {}
+
+	if s.LogFile != "" {
+		file, err := os.OpenFile(s.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+		closeLog = func() { _ = file.Close() }
+	}
+
+	logger, err := logging.New(out, logging.Options{
+		Level:    s.LogLevel,
+		Format:   s.LogFormat,
+		Redactor: redactor,
+	})
+	if err != nil {
+		closeLog()
+		return nil, err
+	}
+
+	slog.SetDefault(logger)
+
+	return closeLog, nil
 }
 
-func setupLogging() {
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	})))
+// Commands defines the agent's commands. Without a command, the agent plans
+// and executes a change in the current directory.
+type Commands struct {
+	Run     CLI     `cmd:"" default:"withargs" help:"Plan and execute a change in the current directory."`
+	Serve   Serve   `cmd:"" help:"Serve a JSON HTTP API to queue, watch and cancel agent jobs."`
+	MCP     MCP     `cmd:"" name:"mcp" help:"Serve the tools over the Model Context Protocol on stdio or HTTP."`
+	Prompts Prompts `cmd:"" help:"Preview the prompt templates."`
 }
 
 // CLI defines the command-line interface structure
@@ -43,15 +130,69 @@ type CLI struct {
 	Message  string   `help:"Message to send to the planning agent." required:"" env:"AGENT_MESSAGE"`
 	Batch    bool     `help:"Enable batch mode for the executing agent." default:"false" env:"AGENT_BATCH"`
 
+	Changed   bool   `help:"Select files with uncommitted changes, including untracked files. Patterns filter the selection further." env:"AGENT_CHANGED"`
+	Staged    bool   `help:"Select files staged in the git index. Patterns filter the selection further." env:"AGENT_STAGED"`
+	Since     string `help:"Select files changed on the current branch since it diverged from this git ref (e.g. origin/main). Patterns filter the selection further." env:"AGENT_SINCE"`
+	FilesFrom string `help:"Read a newline-separated list of files from this path, or '-' for stdin. Patterns filter the selection further." env:"AGENT_FILES_FROM"`
+
 	Tools []string `help:"List of tools to allow the executing agent to use. Default is all." optional:"" env:"AGENT_TOOLS"`
 
-	PlanningApiToken    string `help:"API token for OpenAI compatible endpoint" env:"AGENT_PLANNING_API_TOKEN"`
-	PlanningApiEndpoint string `help:"API endpoint for OpenAI compatible endpoint" default:"http://localhost:11434/v1" env:"AGENT_PLANNING_API_ENDPOINT"`
+	Profile string `help:"Name of the config profile to use for run settings such as history compaction." default:"default" env:"AGENT_PROFILE"`
+
+	Report string `help:"Write a JSON report of the run to this path, with the plan, changed files, commands, verification results, usage and outcome." env:"AGENT_REPORT"`
+
+	Progress string `help:"Live progress on stdout: console (streamed model output and tool calls), json (one event per line), none, or auto (console on a terminal, otherwise json)." enum:"auto,console,json,none" default:"auto" env:"AGENT_PROGRESS"`
+
+	Settings `embed:""`
+}
+
+// Settings are the flags shared by runs from the command line and jobs run
+// by the server.
+type Settings struct {
+	Verify        []string      `help:"Shell command that must pass after execution, e.g. 'go test ./...'. Can be repeated. Failures are fed back to the executing agent to repair." sep:"none" env:"AGENT_VERIFY"`
+	VerifyAuto    bool          `help:"Detect the verification command from Taskfile.yml, Makefile, package.json or the project's language when none are configured." env:"AGENT_VERIFY_AUTO"`
+	VerifyRounds  int           `help:"Maximum number of repair rounds when verification fails." default:"2" env:"AGENT_VERIFY_ROUNDS"`
+	VerifyTimeout time.Duration `help:"Maximum time for each verification command." default:"10m" env:"AGENT_VERIFY_TIMEOUT"`
+
+	ConfigFiles []string `name:"config" help:"YAML configuration files to load, later files override earlier ones. Missing files are skipped." default:"~/.config/agent/config.yaml,.agent/config.yaml" env:"AGENT_CONFIG"`
+
+	PlanningProvider    string `help:"API protocol of the planning endpoint: openai (any OpenAI compatible endpoint), ollama (native /api/chat) or anthropic (Messages API)." enum:"openai,ollama,anthropic" default:"openai" env:"AGENT_PLANNING_PROVIDER"`
+	PlanningApiToken    string `help:"API token for the planning endpoint" env:"AGENT_PLANNING_API_TOKEN"`
+	PlanningApiEndpoint string `help:"API endpoint for the planning provider" default:"http://localhost:11434/v1" env:"AGENT_PLANNING_API_ENDPOINT"`
 	PlanningModel       string `help:"Model to use for the planning agent." default:"phi4-reasoning:latest" env:"AGENT_PLANNING_MODEL"`
 
-	ExecutingApiToken    string `help:"API token for OpenAI compatible endpoint" env:"AGENT_EXECUTING_API_TOKEN"`
-	ExecutingApiEndpoint string `help:"API endpoint for OpenAI compatible endpoint" default:"http://localhost:11434/v1" env:"AGENT_EXECUTING_API_ENDPOINT"`
+	PlanningTools         []string `help:"List of read-only tools to allow the planning agent to use. Tools that can modify files or run commands are never allowed. Default is all read-only tools." optional:"" env:"AGENT_PLANNING_TOOLS"`
+	PlanningMaxIterations int      `help:"Maximum number of model turns, including tool calls, the planning agent may take before it must write the plan." default:"10" env:"AGENT_PLANNING_MAX_ITERATIONS"`
+	ReviewRounds          int      `help:"Number of times the plan is reviewed before execution, revising it after each failed review but the last. Zero disables review." default:"0" env:"AGENT_REVIEW_ROUNDS"`
+	ReviewMinScore        int      `help:"Minimum critic score, from 1 to 10, for a plan to be accepted without revision." default:"7" env:"AGENT_REVIEW_MIN_SCORE"`
+	MaxReplans            int      `help:"Maximum number of times execution may hand back to the planner when the plan cannot be followed. Zero disables re-planning." default:"2" env:"AGENT_MAX_REPLANS"`
+	PlanningContextTokens int      `help:"Token budget for file contents, outlines and the repository map sent to the planning agent." default:"8000" env:"AGENT_PLANNING_CONTEXT_TOKENS"`
+	PlanningContextWindow int      `help:"Context window of the planning model in tokens. Default is from config, probing the endpoint, or known model defaults." env:"AGENT_PLANNING_CONTEXT_WINDOW"`
+	ConventionsTokens     int      `help:"Token budget for the repository's guides, such as AGENTS.md, CONTRIBUTING.md and linter configs, sent to both agents. Zero leaves them out." default:"2000" env:"AGENT_CONVENTIONS_TOKENS"`
+
+	ExecutingProvider    string `help:"API protocol of the executing endpoint: openai (any OpenAI compatible endpoint), ollama (native /api/chat) or anthropic (Messages API)." enum:"openai,ollama,anthropic" default:"openai" env:"AGENT_EXECUTING_PROVIDER"`
+	ExecutingApiToken    string `help:"API token for the executing endpoint" env:"AGENT_EXECUTING_API_TOKEN"`
+	ExecutingApiEndpoint string `help:"API endpoint for the executing provider" default:"http://localhost:11434/v1" env:"AGENT_EXECUTING_API_ENDPOINT"`
 	ExecutingModel       string `help:"Model to use for the executing agent." default:"qwen3:32b" env:"AGENT_EXECUTING_MODEL"`
+
+	ExecutingContextWindow int `help:"Context window of the executing model in tokens. Default is from config, probing the endpoint, or known model defaults." env:"AGENT_EXECUTING_CONTEXT_WINDOW"`
+
+	LogLevel  string `help:"Minimum level of log messages: debug, info, warn or error." enum:"debug,info,warn,error" default:"warn" env:"AGENT_LOG_LEVEL"`
+	LogFormat string `help:"Format of log messages: text or json." enum:"text,json" default:"text" env:"AGENT_LOG_FORMAT"`
+	LogFile   string `help:"Append log messages to this file instead of stderr." env:"AGENT_LOG_FILE"`
+
+	MaxSteps     int            `help:"Maximum number of model turns the executing agent may take for each execution and repair round. Zero means no limit." default:"100" env:"AGENT_MAX_STEPS"`
+	MaxToolCalls int            `help:"Stop once the executing agent has made this many tool calls across the run. Zero means no limit." env:"AGENT_MAX_TOOL_CALLS"`
+	ToolLimits   map[string]int `help:"Maximum number of calls of a tool across the run, e.g. search_files=20. Can be repeated." mapsep:"," env:"AGENT_TOOL_LIMITS"`
+	MaxRepeats   int            `help:"Nudge the executing agent once it repeats the same tool call with the same result this many times, and stop if it repeats it as many times again. Zero disables detection." default:"3" env:"AGENT_MAX_REPEATS"`
+	Timeout      time.Duration  `help:"Stop the run once it has taken this long, e.g. 30m. Zero means no limit." env:"AGENT_TIMEOUT"`
+
+	MaxCost    float64 `help:"Stop once the run has cost more than this many dollars, priced from the models in the config. Zero means no limit." env:"AGENT_MAX_COST"`
+	MaxTokens  int     `help:"Stop once the run has used more than this many prompt and completion tokens. Zero means no limit." env:"AGENT_MAX_TOKENS"`
+	SessionDir string  `help:"Directory to write a record of each run to, with its plan, usage and outcome. Empty disables it." default:"~/.local/state/agent/sessions" env:"AGENT_SESSION_DIR"`
+
+	OtlpEndpoint string `help:"OTLP/HTTP collector URL to export traces to, e.g. http://localhost:4318. The standard OTEL_EXPORTER_OTLP_* variables are also honoured." env:"AGENT_OTLP_ENDPOINT"`
+	TraceFile    string `help:"Append traces to this file as JSON, for inspecting runs without a collector." env:"AGENT_TRACE_FILE"`
 }
 
 // FileInfo represents information about a file in the codebase
@@ -69,32 +210,418 @@ func (cli *CLI) Run() error {
 		return fmt.Errorf("failed to get current working directory: %w", err)
 	}
 
-	// Process patterns to get actual files
-	filenames, err := expandPatterns(cli.Patterns, pwd)
+	cfg, err := config.Load(expandHome(cli.ConfigFiles)...)
 	if err != nil {
 		return err
 	}
 
+	teardown, err := cli.setup(cfg)
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	reporter, err := progress.New(cli.Progress, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	// The first Ctrl-C lets the current step finish, the second aborts
+	ctx, stopper := interrupt.New(context.Background())
+	defer stopper.Notify(os.Stderr, os.Interrupt, syscall.SIGTERM)()
+
+	result, err := cli.execute(ctx, pwd, cfg, reporter)
+
+	// Close any streamed output before the summary
+	if closer, ok := reporter.(io.Closer); ok {
+		_ = closer.Close()
+	}
+
+	if result == nil {
+		return err
+	}
+
+	fmt.Fprint(os.Stderr, result.report.Usage)
+
+	if cli.Report != "" {
+		writeErr := result.report.Write(cli.Report)
+		if writeErr != nil {
+			slog.Warn("report.write_failed", "error", writeErr)
+		}
+	}
+
+	return err
+}
+
+// runResult is what a run produced.
+type runResult struct {
+	report *report.Report
+	diff   string
+}
+
+// execute plans and executes the change in pwd, sending progress to
+// reporter. The result is nil when the run failed before planning.
+func (cli *CLI) execute(ctx context.Context, pwd string, cfg *config.Config, reporter progress.Reporter) (*runResult, error) {
+	// Fail early on a misspelled profile
+	profile, err := cfg.Profile(cli.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process selectors and patterns to get actual files
+	filenames, err := cli.selectFiles(ctx, pwd)
+	if err != nil {
+		return nil, err
+	}
+
 	// Process files
 	fileInfos, err := processFiles(filenames, pwd)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	planningClient, err := newClient(provider.Config{
+		Provider: cli.PlanningProvider,
+		Endpoint: cli.PlanningApiEndpoint,
+		Token:    cli.PlanningApiToken,
+		Model:    cli.PlanningModel,
+	}, profile.Fallbacks.Planning, profile.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create planning client: %w", err)
+	}
+
+	executingClient, err := newClient(provider.Config{
+		Provider: cli.ExecutingProvider,
+		Endpoint: cli.ExecutingApiEndpoint,
+		Token:    cli.ExecutingApiToken,
+		Model:    cli.ExecutingModel,
+	}, profile.Fallbacks.Executing, profile.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create executing client: %w", err)
+	}
+
+	// Custom tools are loaded before the run's span starts, as a bad
+	// definition ends the run before it begins
+	custom, err := customTools(pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := usage.NewTracker(prices(cfg), usage.Limits{
+		MaxCost:   cli.MaxCost,
+		MaxTokens: cli.MaxTokens,
+	})
+
+	record := session.New(pwd, cli.Message)
+	record.Files = filenames
+	record.Planning = session.Model{Provider: cli.PlanningProvider, Endpoint: cli.PlanningApiEndpoint, Model: cli.PlanningModel}
+	record.Executing = session.Model{Provider: cli.ExecutingProvider, Endpoint: cli.ExecutingApiEndpoint, Model: cli.ExecutingModel}
+
+	ctx, cancelTimeout := limits.WithTimeout(ctx, cli.Timeout)
+	defer cancelTimeout()
+
+	recorder := report.NewRecorder()
+	ctx = report.WithRecorder(usage.WithTracker(progress.WithReporter(ctx, reporter), tracker), recorder)
+
+	ctx, span := telemetry.Start(ctx, "agent.run",
+		attribute.String("session.id", record.ID),
+		attribute.Bool("batch", cli.Batch),
+		attribute.Int("files", len(filenames)),
+	)
+
+	mcpTools, stopMCPServers, err := startMCPServers(ctx, pwd, cfg.MCPServers, cli.Tools)
+	if err != nil {
+		telemetry.End(span, err)
+		return nil, err
+	}
+	defer stopMCPServers()
+
+	loader := newPrompts(ctx, cfg, pwd)
+	planner := NewPlanner(cli, pwd, loader, cfg, planningClient)
+	executor := NewExecutor(cli, pwd, loader, cfg, executingClient, custom, mcpTools)
+
+	err = cli.run(ctx, planner, executor, fileInfos, record)
+
+	changes := executor.Changes()
+	if err == nil && len(changes) == 0 {
+		err = report.ErrNoChanges
+	}
+
+	// Requests cut short by the timeout fail with the context's error
+	cause := context.Cause(ctx)
+	if err != nil && errors.Is(cause, limits.ErrExceeded) && !errors.Is(err, limits.ErrExceeded) {
+		err = fmt.Errorf("%w: %w", cause, err)
 	}
 
-	// Create and run the planning phase using Planner
-	planner := NewPlanner(cli, pwd, promptsFS)
-	plan, err := planner.Run(fileInfos)
+	summary := tracker.Summary()
+	span.SetAttributes(
+		attribute.Int("gen_ai.usage.input_tokens", summary.Session.Prompt),
+		attribute.Int("gen_ai.usage.output_tokens", summary.Session.Completion),
+		attribute.Float64("cost", summary.Session.Cost),
+	)
+	telemetry.End(span, err)
+
+	record.Finish(summary, err)
+	if cli.SessionDir != "" {
+		path, writeErr := record.Write(expandHome([]string{cli.SessionDir})[0])
+		if writeErr != nil {
+			slog.Warn("session.write_failed", "error", writeErr)
+		} else {
+			slog.Info("session.written", "path", path)
+		}
+	}
+
+	runReport := &report.Report{
+		SessionID:    record.ID,
+		StartedAt:    record.StartedAt,
+		Plan:         record.Plan,
+		Critiques:    record.Critiques,
+		Files:        changes,
+		Commands:     recorder.Commands(),
+		Verification: recorder.Verification(),
+		Usage:        summary,
+	}
+	runReport.Finish(err)
+
+	return &runResult{report: runReport, diff: executor.Diff()}, err
+}
+
+// run plans and executes, re-planning when the executing agent reports that
+// the plan cannot be followed.
+func (cli *CLI) run(ctx context.Context, planner *Planner, executor *Executor, fileInfos []map[string]interface{}, record *session.Record) error {
+	plan, err := planner.Run(ctx, fileInfos)
 	if err != nil {
 		return err // Error is already contextualized by planner.Run
 	}
+	record.Plan = plan.Text
+	record.Critiques = plan.Critiques
+	progress.Emit(ctx, progress.Event{Kind: progress.PlanReady, Text: plan.Text})
+
+	for attempt := 1; ; attempt++ {
+		if cli.Batch {
+			err = executor.RunBatch(ctx, plan.Text, fileInfos)
+		} else {
+			err = executor.Run(ctx, plan.Text, fileInfos)
+		}
+
+		// Changes are verified once, after every file in a batch
+		if err == nil {
+			err = executor.Verify(ctx, plan.Text, fileInfos)
+		}
+
+		var replan *ReplanError
+		if !errors.As(err, &replan) {
+			return err // Error is already contextualized
+		}
+
+		if attempt > cli.MaxReplans {
+			return fmt.Errorf("giving up after %d re-plans: %w", cli.MaxReplans, err)
+		}
+
+		if replan.Remaining != nil {
+			fileInfos = replan.Remaining
+		}
+
+		plan, err = planner.Replan(ctx, plan, fileInfos, replan, attempt)
+		if err != nil {
+			return err
+		}
+		record.Plan = plan.Text
+		record.Critiques = plan.Critiques
+		progress.Emit(ctx, progress.Event{Kind: progress.PlanReady, Text: plan.Text})
+	}
+}
+
+// prices returns the configured price of each model.
+func prices(cfg *config.Config) map[string]usage.Price {
+	prices := map[string]usage.Price{}
+
+	for name, model := range cfg.Models {
+		if model.Price == (config.Price{}) {
+			continue
+		}
+
+		prices[name] = usage.Price{
+			Input:       model.Price.Input,
+			Output:      model.Price.Output,
+			CachedInput: model.Price.CachedInput,
+		}
+	}
+
+	return prices
+}
+
+// expandHome replaces a leading ~ in each path with the user's home directory
+func expandHome(paths []string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return paths
+	}
+
+	expanded := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+		expanded = append(expanded, path)
+	}
+
+	return expanded
+}
 
-	// Create and run the execution phase using Executor
-	executor := NewExecutor(cli, pwd, promptsFS)
-	if cli.Batch {
-		return executor.RunBatch(plan, fileInfos) // Error is already contextualized
+// customTools creates the tools declared in the workspace's
+// .agent/tools.yaml, running their commands in root.
+func customTools(root string) ([]agent.Tool, error) {
+	declared, err := tools.LoadCustom(filepath.Join(root, ".agent", "tools.yaml"))
+	if err != nil {
+		return nil, err
 	}
 
-	return executor.Run(plan, fileInfos) // Error is already contextualized
+	created := make([]agent.Tool, 0, len(declared))
+	for _, custom := range declared {
+		tool, err := custom.Tool(root)
+		if err != nil {
+			return nil, err
+		}
+
+		created = append(created, tool)
+	}
+
+	return created, nil
+}
+
+// newClient creates a client for primary that retries failed requests and
+// then falls back to each configured endpoint in order.
+func newClient(primary provider.Config, fallbacks []config.Endpoint, retry config.Retry) (*client.Client, error) {
+	configs := []provider.Config{primary}
+	for _, fallback := range fallbacks {
+		configs = append(configs, provider.Config{
+			Provider: fallback.Provider,
+			Endpoint: fallback.Endpoint,
+			Token:    fallback.APIToken(),
+			Model:    fallback.Model,
+		})
+	}
+
+	return provider.NewChain(configs, provider.RetryPolicy{
+		MaxAttempts:    retry.MaxAttempts,
+		InitialBackoff: retry.InitialBackoff,
+		MaxBackoff:     retry.MaxBackoff,
+		Timeout:        retry.Timeout,
+		StatusCodes:    retry.StatusCodes,
+	})
+}
+
+// newBudget resolves the context window for a model and creates its token budget
+func newBudget(ctx context.Context, cfg *config.Config, providerName, endpoint, model string, override int) budget.Budget {
+	resolver := budget.Resolver{
+		Configured: cfg.ContextWindow,
+		Ollama:     providerName == provider.Ollama,
+	}
+
+	window := resolver.Window(ctx, endpoint, model, override)
+	slog.Debug("budget.window", "model", model, "context_window", window)
+
+	return budget.New(model, window)
+}
+
+// hasFileSelectors reports whether files should be selected from git or a file list
+func (cli *CLI) hasFileSelectors() bool {
+	return cli.Changed || cli.Staged || cli.Since != "" || cli.FilesFrom != ""
+}
+
+// selectFiles resolves the files to process. Without selectors the patterns
+// are expanded from disk, otherwise the union of the selected files is
+// filtered by the patterns.
+func (cli *CLI) selectFiles(ctx context.Context, pwd string) ([]string, error) {
+	if !cli.hasFileSelectors() {
+		return expandPatterns(cli.Patterns, pwd)
+	}
+
+	var candidates []string
+
+	if cli.Changed {
+		files, err := workspace.ChangedFiles(ctx, pwd)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, files...)
+	}
+
+	if cli.Staged {
+		files, err := workspace.StagedFiles(ctx, pwd)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, files...)
+	}
+
+	if cli.Since != "" {
+		files, err := workspace.FilesSince(ctx, pwd, cli.Since)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, files...)
+	}
+
+	if cli.FilesFrom != "" {
+		files, err := readFilesFrom(cli.FilesFrom)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, files...)
+	}
+
+	selected, err := workspace.Filter(candidates, cli.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	seenFiles := make(map[string]bool)
+
+	for _, filename := range selected {
+		absFilename := inDir(pwd, filename)
+
+		// Ensure file is within current working directory
+		if !strings.HasPrefix(absFilename, pwd+string(filepath.Separator)) {
+			slog.Warn("file outside working directory, skipping", "file", filename, "pwd", pwd)
+			continue
+		}
+
+		if info, err := os.Stat(absFilename); err != nil || info.IsDir() {
+			slog.Warn("selected file does not exist, skipping", "file", filename)
+			continue
+		}
+
+		// Avoid duplicates
+		if !seenFiles[absFilename] {
+			filenames = append(filenames, absFilename)
+			seenFiles[absFilename] = true
+		}
+	}
+
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files found matching the provided selectors and patterns")
+	}
+
+	slog.Debug("selected files", "patterns", cli.Patterns, "files", filenames, "count", len(filenames))
+	return filenames, nil
+}
+
+// readFilesFrom reads a newline-separated file list from path, or stdin when path is "-"
+func readFilesFrom(path string) ([]string, error) {
+	if path == "-" {
+		return workspace.ReadFileList(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file list %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return workspace.ReadFileList(file)
 }
 
 // expandPatterns expands glob patterns into actual file paths
@@ -111,7 +638,7 @@ func expandPatterns(patterns []string, pwd string) ([]string, error) {
 		// Check if pattern contains glob characters
 		if strings.ContainsAny(pattern, "*?[{") {
 			// It's a glob pattern - use doublestar to expand it
-			matches, err := doublestar.FilepathGlob(pattern, doublestar.WithFilesOnly())
+			matches, err := doublestar.FilepathGlob(inDir(pwd, pattern), doublestar.WithFilesOnly())
 			if err != nil {
 				return nil, fmt.Errorf("failed to expand pattern %s: %w", pattern, err)
 			}
@@ -121,11 +648,14 @@ func expandPatterns(patterns []string, pwd string) ([]string, error) {
 				continue
 			}
 
-			for _, match := range matches {
-				// Convert to absolute path for consistency
-				absMatch, err := filepath.Abs(match)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get absolute path for %s: %w", match, err)
+			for _, absMatch := range matches {
+				// Relative patterns keep matching relative filenames
+				match := absMatch
+				if !filepath.IsAbs(pattern) {
+					match, err = filepath.Rel(pwd, absMatch)
+					if err != nil {
+						return nil, fmt.Errorf("failed to get relative path for %s: %w", absMatch, err)
+					}
 				}
 
 				// Ensure file is within current working directory
@@ -142,16 +672,11 @@ func expandPatterns(patterns []string, pwd string) ([]string, error) {
 			}
 		} else {
 			// It's a regular filename - check if it exists
-			if _, err := os.Stat(pattern); err != nil {
+			absPattern := inDir(pwd, pattern)
+			if _, err := os.Stat(absPattern); err != nil {
 				return nil, fmt.Errorf("file %s does not exist: %w", pattern, err)
 			}
 
-			// Convert to absolute path for consistency check
-			absPattern, err := filepath.Abs(pattern)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get absolute path for %s: %w", pattern, err)
-			}
-
 			// Ensure file is within current working directory
 			if !strings.HasPrefix(absPattern, pwd) {
 				return nil, fmt.Errorf("file %s is not within the current working directory %s", pattern, pwd)
@@ -178,6 +703,16 @@ func expandPatterns(patterns []string, pwd string) ([]string, error) {
 	return filenames, nil
 }
 
+// inDir resolves a relative path against dir instead of the process's
+// working directory, which concurrent jobs do not share.
+func inDir(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(dir, path)
+}
+
 // processFiles reads and analyzes the files provided as CLI arguments
 func processFiles(filenames []string, pwd string) ([]map[string]interface{}, error) {
 	if len(filenames) == 0 {
@@ -189,17 +724,12 @@ func processFiles(filenames []string, pwd string) ([]map[string]interface{}, err
 
 	for _, filename := range filenames {
 		// Read file content
-		contents, err := os.ReadFile(filename)
+		absFilename := inDir(pwd, filename)
+		contents, err := os.ReadFile(absFilename)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
 		}
 
-		// Get absolute path
-		absFilename, err := filepath.Abs(filename)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get absolute path for file %s: %w", filename, err)
-		}
-
 		// Ensure file is within current working directory
 		if !strings.HasPrefix(absFilename, pwd) {
 			return nil, fmt.Errorf("file %s is not within the current working directory %s", filename, pwd)
@@ -219,12 +749,75 @@ func processFiles(filenames []string, pwd string) ([]map[string]interface{}, err
 	return fileInfo, nil
 }
 
-// loadPromptTemplate loads a prompt from the provided embedded filesystem and parses it as a template
-func loadPromptTemplate(fs embed.FS, name string) (*template.Template, error) {
-	content, err := fs.ReadFile(filepath.Join("prompts", name))
+// maxWorkspaceLanguages caps the languages detected from the workspace when
+// no files are selected.
+const maxWorkspaceLanguages = 3
+
+// detectLanguages returns the programming languages of the files, or of the
+// files tracked in the repository when none are selected, the most common
+// first.
+func detectLanguages(ctx context.Context, pwd string, fileInfos []map[string]interface{}) []string {
+	var languages []string
+
+	if len(fileInfos) > 0 {
+		for _, fileInfo := range fileInfos {
+			language, _ := fileInfo["language"].(string)
+			languages = append(languages, language)
+		}
+	} else {
+		files, err := workspace.TrackedFiles(ctx, pwd)
+		if err != nil {
+			slog.Debug("languages.detect_failed", "error", err)
+			return nil
+		}
+
+		for _, file := range files {
+			languages = append(languages, enry.GetLanguage(filepath.Base(file), nil))
+		}
+	}
+
+	counts := map[string]int{}
+	for _, language := range languages {
+		if language != "" && enry.GetLanguageType(language) == enry.Programming {
+			counts[language]++
+		}
+	}
+
+	detected := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(counts[b]-counts[a], strings.Compare(a, b))
+	})
+
+	if len(fileInfos) == 0 && len(detected) > maxWorkspaceLanguages {
+		detected = detected[:maxWorkspaceLanguages]
+	}
+
+	return detected
+}
+
+// conventionDirs returns pwd and the repository root above it, most specific
+// first, as the directories whose conventions apply to a run.
+func conventionDirs(ctx context.Context, pwd string) []string {
+	dirs := []string{pwd}
+
+	root, err := workspace.Root(ctx, pwd)
+	if err == nil && !sameDir(root, pwd) {
+		dirs = append(dirs, root)
+	}
+
+	return dirs
+}
+
+// discoverConventions returns the conventions of pwd and of the repository
+// root above it for the prompts, or nil when there are none.
+func discoverConventions(ctx context.Context, pwd string, tokens int) (*contextbuilder.Conventions, error) {
+	conventions, err := contextbuilder.DiscoverConventions(conventionDirs(ctx, pwd), tokens)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read prompt %s: %w", name, err)
+		return nil, fmt.Errorf("failed to discover conventions: %w", err)
+	}
+
+	if conventions.Empty() {
+		return nil, nil
 	}
 
-	return template.New(name).Funcs(sprig.FuncMap()).Parse(string(content))
+	return &conventions, nil
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/mcp"
+	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/outrageous/agent"
+	"github.com/samber/lo"
+)
+
+// MCP defines the Model Context Protocol server command
+type MCP struct {
+	Root   string   `help:"Root directory the tools are confined to." default:"." env:"AGENT_ROOT"`
+	Tools  []string `help:"List of tools to offer. Default is all." optional:"" env:"AGENT_TOOLS"`
+	Listen string   `help:"Serve the streamable HTTP transport on this address, e.g. 127.0.0.1:8090, instead of stdio." env:"AGENT_MCP_LISTEN"`
+
+	Token          string   `help:"Bearer token HTTP clients must send. Required to listen on an address other than loopback." env:"AGENT_MCP_TOKEN"`
+	AllowedOrigins []string `help:"Browser origins allowed to call the HTTP transport, besides loopback ones." env:"AGENT_MCP_ALLOWED_ORIGINS"`
+}
+
+// Run serves the tools over stdio, or over HTTP when an address is given,
+// until stdin is closed or the process is interrupted.
+func (m *MCP) Run() error {
+	root, err := filepath.Abs(m.Root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve root: %w", err)
+	}
+
+	// The tools run commands, so only this machine may call them unauthenticated
+	if m.Listen != "" && m.Token == "" {
+		host, _, err := net.SplitHostPort(m.Listen)
+		if err != nil {
+			return fmt.Errorf("invalid listen address %q: %w", m.Listen, err)
+		}
+
+		if !mcp.IsLoopback(host) {
+			return fmt.Errorf("listening on %s requires --token", m.Listen)
+		}
+	}
+
+	// Tools resolve relative paths from the working directory
+	err = os.Chdir(root)
+	if err != nil {
+		return fmt.Errorf("failed to change to root: %w", err)
+	}
+
+	custom, err := customTools(root)
+	if err != nil {
+		return err
+	}
+
+	server := mcp.NewServer(mcp.Implementation{
+		Name:    "agent",
+		Version: version(),
+	}, tools.Select(root, m.Tools, custom...))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if m.Listen == "" {
+		// Stdout carries the protocol, logs go to stderr
+		return server.ServeStdio(ctx, os.Stdin, os.Stdout)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server.Handler(mcp.HTTPOptions{
+		Token:          m.Token,
+		AllowedOrigins: m.AllowedOrigins,
+	}))
+
+	httpServer := &http.Server{
+		Addr:              m.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving MCP tools for %s on http://%s/mcp\n", root, m.Listen)
+
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+
+	return nil
+}
+
+// version returns the module version the binary was built from.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" || info.Main.Version == "(devel)" {
+		return "dev"
+	}
+
+	return info.Main.Version
+}
+
+// mcpStartTimeout bounds starting a configured server and listing its
+// tools, allowing for servers fetched on first use, e.g. with npx.
+const mcpStartTimeout = time.Minute
+
+// startMCPServers starts the configured MCP servers in pwd whose tools are
+// allowed by requested, returning their tools and a function that stops them.
+// Requested names match a server, for all of its tools, or a single
+// "<server>__<tool>".
+func startMCPServers(ctx context.Context, pwd string, servers map[string]config.MCPServer, requested []string) ([]agent.Tool, func(), error) {
+	requested = append(slices.Clone(requested), lo.Map(requested, func(name string, _ int) string {
+		return strcase.ToSnake(name)
+	})...)
+
+	allowed := func(names ...string) bool {
+		return len(requested) == 0 || lo.Some(requested, names)
+	}
+
+	var (
+		clients []*mcp.Client
+		offered []agent.Tool
+	)
+
+	stop := func() {
+		for _, client := range clients {
+			err := client.Close()
+			if err != nil {
+				slog.Warn("mcp.stop_failed", "server", client.Name(), "error", err)
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		prefix := mcp.ToolName(name, "")
+		if !allowed(name) && !lo.SomeBy(requested, func(tool string) bool { return strings.HasPrefix(tool, prefix) }) {
+			continue
+		}
+
+		tools, client, err := startMCPServer(ctx, pwd, name, servers[name])
+		if client != nil {
+			clients = append(clients, client)
+		}
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+
+		for _, tool := range tools {
+			if allowed(name, tool.Name) {
+				offered = append(offered, tool)
+			}
+		}
+	}
+
+	slices.SortFunc(offered, func(a, b agent.Tool) int { return strings.Compare(a.Name, b.Name) })
+
+	return offered, stop, nil
+}
+
+func startMCPServer(ctx context.Context, pwd, name string, server config.MCPServer) ([]agent.Tool, *mcp.Client, error) {
+	client, err := mcp.Start(name, pwd, server.Command, server.Args, server.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpStartTimeout)
+	defer cancel()
+
+	initialized, err := client.Initialize(ctx, mcp.Implementation{Name: "agent", Version: version()})
+	if err != nil {
+		return nil, client, fmt.Errorf("failed to initialize mcp server %s: %w", name, err)
+	}
+
+	tools, err := client.Tools(ctx)
+	if err != nil {
+		return nil, client, fmt.Errorf("failed to list tools of mcp server %s: %w", name, err)
+	}
+
+	slog.Info("mcp.started", "server", name, "server_name", initialized.ServerInfo.Name, "tools", len(tools))
+
+	return tools, client, nil
+}
@@ -0,0 +1,381 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtarchie/agent/agent/process"
+	"github.com/jtarchie/outrageous/agent"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// ErrServerExited is returned for requests to a server that has stopped.
+var ErrServerExited = errors.New("mcp server exited")
+
+// closeTimeout is how long a server has to exit after its input is closed
+// before it is killed.
+const closeTimeout = 5 * time.Second
+
+// Client talks to an MCP server started as a child process, exchanging
+// newline-delimited messages on its stdin and stdout.
+type Client struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	cancel context.CancelFunc
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan Response
+	done    chan struct{}
+	err     error
+}
+
+// Start runs the server's command in dir with env added to the agent's
+// environment. The server runs in its own process group, so it outlives
+// the first Ctrl-C and is stopped with Close.
+func Start(name, dir, command string, args []string, env []string) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	process.Isolate(cmd)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = &logWriter{name: name}
+	cmd.WaitDelay = closeTimeout
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open stdin of mcp server %s: %w", name, err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open stdout of mcp server %s: %w", name, err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start mcp server %s: %w", name, err)
+	}
+
+	client := &Client{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		cancel:  cancel,
+		pending: map[int64]chan Response{},
+		done:    make(chan struct{}),
+	}
+
+	go client.read(stdout)
+
+	return client, nil
+}
+
+// Name is the name the server was configured with.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Initialize starts the session, returning the server's capabilities.
+func (c *Client) Initialize(ctx context.Context, info Implementation) (InitializeResult, error) {
+	var result InitializeResult
+
+	err := c.request(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      info,
+	}, &result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, c.notify("notifications/initialized", nil)
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	tools := []Tool{}
+	cursor := ""
+
+	for {
+		var result ListToolsResult
+
+		err := c.request(ctx, "tools/list", ListToolsParams{Cursor: cursor}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool. A tool that fails returns a result with IsError
+// set rather than an error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (CallToolResult, error) {
+	var result CallToolResult
+
+	err := c.request(ctx, "tools/call", CallToolParams{Name: name, Arguments: arguments}, &result)
+
+	return result, err
+}
+
+// Tools lists the server's tools as agent tools, named "<server>__<tool>"
+// so tools from different servers cannot clash.
+func (c *Client) Tools(ctx context.Context) ([]agent.Tool, error) {
+	listed, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]agent.Tool, 0, len(listed))
+	for _, tool := range listed {
+		parameters := &jsonschema.Definition{Type: jsonschema.Object}
+		if len(tool.InputSchema) > 0 {
+			err := json.Unmarshal(tool.InputSchema, parameters)
+			if err != nil {
+				slog.Warn("mcp.invalid_schema", "server", c.name, "tool", tool.Name, "error", err)
+				parameters = &jsonschema.Definition{Type: jsonschema.Object}
+			}
+		}
+
+		tools = append(tools, agent.Tool{
+			Name:        ToolName(c.name, tool.Name),
+			Description: tool.Description,
+			Parameters:  parameters,
+			Func: func(ctx context.Context, params map[string]any) (any, error) {
+				result, err := c.CallTool(ctx, tool.Name, params)
+				if err != nil {
+					return nil, fmt.Errorf("failed to call %s on mcp server %s: %w", tool.Name, c.name, err)
+				}
+
+				if result.IsError {
+					return map[string]any{"error": result.Text()}, nil
+				}
+
+				return result.Text(), nil
+			},
+		})
+	}
+
+	return tools, nil
+}
+
+// Close closes the server's input and waits for it to exit, killing its
+// process group if it does not exit in time.
+func (c *Client) Close() error {
+	_ = c.stdin.Close()
+
+	select {
+	case <-c.done:
+	case <-time.After(closeTimeout):
+		c.cancel()
+		<-c.done
+	}
+
+	timer := time.AfterFunc(closeTimeout, c.cancel)
+	defer timer.Stop()
+	defer c.cancel()
+
+	err := c.cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to stop mcp server %s: %w", c.name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, method string, params any, result any) error {
+	responses := make(chan Response, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+
+		return err
+	}
+
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = responses
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	err := c.write(Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(strconv.FormatInt(id, 10)),
+		Method:  method,
+		Params:  encode(params),
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case response := <-responses:
+		if response.Error != nil {
+			return fmt.Errorf("%s failed: %w", method, response.Error)
+		}
+
+		err := json.Unmarshal(response.Result, result)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+
+		return nil
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		_ = c.notify("notifications/cancelled", map[string]any{"requestId": id})
+
+		return context.Cause(ctx)
+	}
+}
+
+func (c *Client) notify(method string, params any) error {
+	request := Request{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		request.Params = encode(params)
+	}
+
+	return c.write(request)
+}
+
+func (c *Client) write(message any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err := c.stdin.Write(append(encode(message), '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write to mcp server %s: %w", c.name, err)
+	}
+
+	return nil
+}
+
+// read dispatches responses to waiting requests until the server's output
+// ends, answering the few requests a server can make of the client.
+func (c *Client) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var message struct {
+			Request
+			Result json.RawMessage `json:"result,omitempty"`
+			Error  *Error          `json:"error,omitempty"`
+		}
+
+		err := json.Unmarshal(line, &message)
+		if err != nil {
+			slog.Debug("mcp.invalid_message", "server", c.name, "error", err)
+			continue
+		}
+
+		if message.Method != "" {
+			if !message.IsNotification() {
+				c.answer(message.Request)
+			}
+
+			continue
+		}
+
+		id, err := strconv.ParseInt(string(message.ID), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		responses, ok := c.pending[id]
+		c.mu.Unlock()
+
+		if ok {
+			responses <- Response{JSONRPC: "2.0", ID: message.ID, Result: message.Result, Error: message.Error}
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = ErrServerExited
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("mcp server %s: %w", c.name, err)
+	close(c.done)
+	c.mu.Unlock()
+}
+
+func (c *Client) answer(request Request) {
+	response := Response{JSONRPC: "2.0", ID: request.ID}
+
+	if request.Method == "ping" {
+		response.Result = json.RawMessage("{}")
+	} else {
+		response.Error = &Error{Code: MethodNotFound, Message: fmt.Sprintf("method %q not supported", request.Method)}
+	}
+
+	_ = c.write(response)
+}
+
+var invalidToolName = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ToolName namespaces a server's tool, keeping to the characters and
+// length model APIs accept.
+func ToolName(server, tool string) string {
+	name := invalidToolName.ReplaceAllString(server, "_") + "__" + invalidToolName.ReplaceAllString(tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// logWriter logs what a server writes to stderr.
+type logWriter struct {
+	name string
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		slog.Debug("mcp.stderr", "server", l.name, "line", line)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,81 @@
+package mcp_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/mcp"
+	. "github.com/onsi/gomega"
+)
+
+// TestMain serves the test tools over stdio when the test binary is started
+// as an MCP server by the client tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_SERVER") == "1" {
+		_ = newServer().ServeStdio(context.Background(), os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func startClient(assert *WithT) *mcp.Client {
+	client, err := mcp.Start("test server", "", os.Args[0], []string{"-test.run=^$"}, []string{"MCP_TEST_SERVER=1"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	return client
+}
+
+func TestClient(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	client := startClient(assert)
+	defer func() { assert.Expect(client.Close()).To(Succeed()) }()
+
+	ctx := context.Background()
+
+	initialized, err := client.Initialize(ctx, mcp.Implementation{Name: "test", Version: "1"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(initialized.ServerInfo.Name).To(Equal("agent"))
+
+	tools, err := client.Tools(ctx)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(tools).To(HaveLen(1))
+	assert.Expect(tools[0].Name).To(Equal("test_server__echo"))
+	assert.Expect(tools[0].Parameters.Required).To(Equal([]string{"text"}))
+
+	value, err := tools[0].Func(ctx, map[string]any{"text": "hello"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(Equal(`{"text":"hello"}`))
+
+	value, err = tools[0].Func(ctx, map[string]any{})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(Equal(map[string]any{"error": "text is required"}))
+
+	_, err = client.CallTool(ctx, "missing", nil)
+	assert.Expect(err).To(MatchError(ContainSubstring("unknown tool")))
+}
+
+func TestClientClosed(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	client := startClient(assert)
+	assert.Expect(client.Close()).To(Succeed())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := client.ListTools(ctx)
+	assert.Expect(err).To(MatchError(mcp.ErrServerExited))
+}
+
+func TestToolName(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(mcp.ToolName("github", "create_issue")).To(Equal("github__create_issue"))
+	assert.Expect(mcp.ToolName("my.server", "read file")).To(Equal("my_server__read_file"))
+	assert.Expect(mcp.ToolName("server", strings.Repeat("a", 100))).To(HaveLen(64))
+}
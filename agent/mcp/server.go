@@ -0,0 +1,324 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// maxMessageSize bounds the size of a single message from a client.
+const maxMessageSize = 16 << 20
+
+// Server offers tools to MCP clients.
+type Server struct {
+	info  Implementation
+	tools []agent.Tool
+	index map[string]agent.Tool
+}
+
+// NewServer creates a server offering tools. When several tools share a
+// name, the first is offered.
+func NewServer(info Implementation, tools []agent.Tool) *Server {
+	server := &Server{
+		info:  info,
+		index: map[string]agent.Tool{},
+	}
+
+	for _, tool := range tools {
+		if _, ok := server.index[tool.Name]; ok {
+			slog.Debug("mcp.duplicate_tool", "tool", tool.Name)
+			continue
+		}
+
+		server.index[tool.Name] = tool
+		server.tools = append(server.tools, tool)
+	}
+
+	return server
+}
+
+// Handle processes a single JSON-RPC message, returning the encoded
+// response, or nil for notifications.
+func (s *Server) Handle(ctx context.Context, message []byte) []byte {
+	var request Request
+
+	err := json.Unmarshal(message, &request)
+	if err != nil {
+		return encode(Response{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &Error{Code: ParseError, Message: fmt.Sprintf("invalid message: %s", err)},
+		})
+	}
+
+	result, rpcErr := s.dispatch(ctx, request)
+	if request.IsNotification() {
+		return nil
+	}
+
+	response := Response{JSONRPC: "2.0", ID: request.ID, Error: rpcErr}
+	if rpcErr == nil {
+		response.Result, err = json.Marshal(result)
+		if err != nil {
+			response.Error = &Error{Code: InternalError, Message: fmt.Sprintf("failed to encode result: %s", err)}
+		}
+	}
+
+	return encode(response)
+}
+
+func (s *Server) dispatch(ctx context.Context, request Request) (any, *Error) {
+	switch request.Method {
+	case "initialize":
+		var params InitializeParams
+		_ = json.Unmarshal(request.Params, &params)
+		slog.Debug("mcp.initialize", "client", params.ClientInfo.Name, "protocol_version", params.ProtocolVersion)
+
+		return InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      s.info,
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		var params CallToolParams
+
+		err := json.Unmarshal(request.Params, &params)
+		if err != nil {
+			return nil, &Error{Code: InvalidParams, Message: fmt.Sprintf("invalid tools/call params: %s", err)}
+		}
+
+		return s.callTool(ctx, params)
+	default:
+		if request.IsNotification() {
+			return nil, nil
+		}
+
+		return nil, &Error{Code: MethodNotFound, Message: fmt.Sprintf("method %q not found", request.Method)}
+	}
+}
+
+func (s *Server) listTools() ListToolsResult {
+	result := ListToolsResult{Tools: make([]Tool, 0, len(s.tools))}
+
+	for _, tool := range s.tools {
+		schema := json.RawMessage(`{"type":"object"}`)
+		if tool.Parameters != nil {
+			schema = encode(tool.Parameters)
+		}
+
+		result.Tools = append(result.Tools, Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return result
+}
+
+func (s *Server) callTool(ctx context.Context, params CallToolParams) (any, *Error) {
+	tool, ok := s.index[params.Name]
+	if !ok {
+		return nil, &Error{Code: InvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+	}
+
+	arguments := params.Arguments
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+
+	value, err := tool.Func(ctx, arguments)
+	if err != nil {
+		slog.Debug("mcp.tool_failed", "tool", params.Name, "error", err)
+
+		return CallToolResult{
+			Content: []Content{{Type: "text", Text: err.Error()}},
+			IsError: true,
+		}, nil
+	}
+
+	return CallToolResult{
+		Content: []Content{{Type: "text", Text: toText(value)}},
+	}, nil
+}
+
+// ServeStdio reads newline-delimited messages from in and writes responses
+// to out until in is closed or ctx is cancelled. Requests are handled
+// concurrently, so a slow tool does not block pings.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var (
+		mu      sync.Mutex
+		pending sync.WaitGroup
+	)
+	defer pending.Wait()
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		message := bytes.TrimSpace(scanner.Bytes())
+		if len(message) == 0 {
+			continue
+		}
+		message = bytes.Clone(message)
+
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+
+			response := s.Handle(ctx, message)
+			if response == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			_, _ = out.Write(append(response, '\n'))
+		}()
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	return nil
+}
+
+// HTTPOptions secure the streamable HTTP transport.
+type HTTPOptions struct {
+	// Token, when set, must be sent by clients as a bearer token.
+	Token string
+	// AllowedOrigins are the browser origins allowed besides loopback ones,
+	// e.g. "https://example.com".
+	AllowedOrigins []string
+}
+
+// Handler serves the streamable HTTP transport. Each POST carries one
+// message and is answered with a JSON response, or 202 Accepted for
+// notifications. Server-initiated streams are not offered.
+//
+// Requests from browser origins that are not loopback or allowed are
+// rejected, so that pages cannot reach a local server through DNS
+// rebinding.
+func (s *Server) Handler(options HTTPOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !options.allowsOrigin(r.Header.Get("Origin")) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if !options.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		message, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+		if err != nil {
+			http.Error(w, "failed to read message", http.StatusBadRequest)
+			return
+		}
+
+		response := s.Handle(r.Context(), message)
+		if response == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(response)
+	})
+}
+
+// allowsOrigin reports whether requests from origin are accepted. Clients
+// other than browsers send no origin.
+func (o HTTPOptions) allowsOrigin(origin string) bool {
+	if origin == "" || slices.Contains(o.AllowedOrigins, origin) {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return IsLoopback(parsed.Hostname())
+}
+
+func (o HTTPOptions) authorized(header string) bool {
+	if o.Token == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(o.Token)) == 1
+}
+
+// IsLoopback reports whether host, a name or an IP address, only reaches
+// this machine.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// toText renders a tool result as text, encoding structured results as
+// JSON.
+func toText(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(contents)
+}
+
+// encode marshals values that are known to encode, such as responses and
+// schemas.
+func encode(value any) json.RawMessage {
+	contents, _ := json.Marshal(value)
+	return contents
+}
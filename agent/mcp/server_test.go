@@ -0,0 +1,204 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/mcp"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+func newServer() *mcp.Server {
+	echo := agent.Tool{
+		Name:        "echo",
+		Description: "Echoes the text back.",
+		Parameters: &jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"text": {Type: jsonschema.String},
+			},
+			Required: []string{"text"},
+		},
+		Func: func(_ context.Context, params map[string]any) (any, error) {
+			text, _ := params["text"].(string)
+			if text == "" {
+				return nil, errors.New("text is required")
+			}
+
+			return map[string]any{"text": text}, nil
+		},
+	}
+
+	duplicate := echo
+	duplicate.Description = "Shadowed."
+
+	return mcp.NewServer(mcp.Implementation{Name: "agent", Version: "test"}, []agent.Tool{echo, duplicate})
+}
+
+func call(assert *WithT, server *mcp.Server, message string) mcp.Response {
+	var response mcp.Response
+	assert.Expect(json.Unmarshal(server.Handle(context.Background(), []byte(message)), &response)).To(Succeed())
+
+	return response
+}
+
+func TestHandle(t *testing.T) {
+	assert := NewGomegaWithT(t)
+	server := newServer()
+
+	response := call(assert, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","clientInfo":{"name":"test","version":"1"}}}`)
+	assert.Expect(response.Error).To(BeNil())
+	assert.Expect(string(response.ID)).To(Equal("1"))
+
+	var initialized mcp.InitializeResult
+	assert.Expect(json.Unmarshal(response.Result, &initialized)).To(Succeed())
+	assert.Expect(initialized.ProtocolVersion).To(Equal(mcp.ProtocolVersion))
+	assert.Expect(initialized.ServerInfo.Name).To(Equal("agent"))
+	assert.Expect(initialized.Capabilities).To(HaveKey("tools"))
+
+	// Notifications are not answered
+	assert.Expect(server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))).To(BeNil())
+
+	response = call(assert, server, `{"jsonrpc":"2.0","id":"list","method":"tools/list"}`)
+
+	var tools mcp.ListToolsResult
+	assert.Expect(json.Unmarshal(response.Result, &tools)).To(Succeed())
+	assert.Expect(tools.Tools).To(HaveLen(1))
+	assert.Expect(tools.Tools[0].Description).To(Equal("Echoes the text back."))
+	assert.Expect(string(tools.Tools[0].InputSchema)).To(ContainSubstring(`"required":["text"]`))
+
+	response = call(assert, server, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`)
+
+	var result mcp.CallToolResult
+	assert.Expect(json.Unmarshal(response.Result, &result)).To(Succeed())
+	assert.Expect(result.IsError).To(BeFalse())
+	assert.Expect(result.Text()).To(Equal(`{"text":"hello"}`))
+
+	// Tool failures are results the model can see, not protocol errors
+	response = call(assert, server, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{}}}`)
+	assert.Expect(response.Error).To(BeNil())
+
+	result = mcp.CallToolResult{}
+	assert.Expect(json.Unmarshal(response.Result, &result)).To(Succeed())
+	assert.Expect(result.IsError).To(BeTrue())
+	assert.Expect(result.Text()).To(Equal("text is required"))
+
+	response = call(assert, server, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"missing"}}`)
+	assert.Expect(response.Error.Code).To(Equal(mcp.InvalidParams))
+
+	response = call(assert, server, `{"jsonrpc":"2.0","id":5,"method":"resources/list"}`)
+	assert.Expect(response.Error.Code).To(Equal(mcp.MethodNotFound))
+
+	response = call(assert, server, `not json`)
+	assert.Expect(response.Error.Code).To(Equal(mcp.ParseError))
+	assert.Expect(string(response.ID)).To(Equal("null"))
+}
+
+func TestServeStdio(t *testing.T) {
+	assert := NewGomegaWithT(t)
+	server := newServer()
+
+	in := strings.NewReader(strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+		``,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}, "\n"))
+
+	reader, writer := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ServeStdio(context.Background(), in, writer)
+		_ = writer.Close()
+	}()
+
+	ids := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var response mcp.Response
+		assert.Expect(json.Unmarshal(scanner.Bytes(), &response)).To(Succeed())
+		assert.Expect(response.Error).To(BeNil())
+		ids = append(ids, string(response.ID))
+	}
+
+	assert.Expect(<-done).NotTo(HaveOccurred())
+	assert.Expect(ids).To(ConsistOf("1", "2"))
+}
+
+func TestHandler(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	api := httptest.NewServer(newServer().Handler(mcp.HTTPOptions{}))
+	defer api.Close()
+
+	response, err := http.Post(api.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = response.Body.Close() }()
+
+	assert.Expect(response.StatusCode).To(Equal(http.StatusOK))
+	assert.Expect(response.Header.Get("Content-Type")).To(Equal("application/json"))
+
+	body, err := io.ReadAll(response.Body)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(body)).To(ContainSubstring(`"name":"echo"`))
+
+	response, err = http.Post(api.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	assert.Expect(err).NotTo(HaveOccurred())
+	_ = response.Body.Close()
+	assert.Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+
+	response, err = http.Get(api.URL)
+	assert.Expect(err).NotTo(HaveOccurred())
+	_ = response.Body.Close()
+	assert.Expect(response.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+}
+
+func TestHandlerSecurity(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	api := httptest.NewServer(newServer().Handler(mcp.HTTPOptions{
+		Token:          "secret",
+		AllowedOrigins: []string{"https://example.com"},
+	}))
+	defer api.Close()
+
+	post := func(origin, token string) int {
+		request, err := http.NewRequest(http.MethodPost, api.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		assert.Expect(err).NotTo(HaveOccurred())
+
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		assert.Expect(err).NotTo(HaveOccurred())
+		_ = response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	assert.Expect(post("", "secret")).To(Equal(http.StatusOK))
+	assert.Expect(post("http://localhost:3000", "secret")).To(Equal(http.StatusOK))
+	assert.Expect(post("https://example.com", "secret")).To(Equal(http.StatusOK))
+	assert.Expect(post("http://attacker.example", "secret")).To(Equal(http.StatusForbidden))
+	assert.Expect(post("", "")).To(Equal(http.StatusUnauthorized))
+	assert.Expect(post("", "wrong")).To(Equal(http.StatusUnauthorized))
+
+	assert.Expect(mcp.IsLoopback("127.0.0.1")).To(BeTrue())
+	assert.Expect(mcp.IsLoopback("::1")).To(BeTrue())
+	assert.Expect(mcp.IsLoopback("0.0.0.0")).To(BeFalse())
+	assert.Expect(mcp.IsLoopback("")).To(BeFalse())
+}
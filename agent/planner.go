@@ -2,83 +2,181 @@ package main
 
 import (
 	"context"
-	"embed"
 	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/jtarchie/agent/agent/budget"
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/contextbuilder"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/prompts"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/review"
+	"github.com/jtarchie/agent/agent/telemetry"
+	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/agent/agent/usage"
 	"github.com/jtarchie/outrageous/agent"
 	"github.com/jtarchie/outrageous/client"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Plan is the result of the planning phase, with the reviewer's critiques
+// from each refinement round.
+type Plan struct {
+	Text      string            `json:"text"`
+	Critiques []review.Critique `json:"critiques,omitempty"`
+}
+
 // Planner orchestrates the planning phase of the agent.
 type Planner struct {
-	cli       *CLI
-	pwd       string
-	promptsFS embed.FS
+	cli     *CLI
+	pwd     string
+	prompts *prompts.Loader
+	config  *config.Config
+	llm     *client.Client
 }
 
 // NewPlanner creates a new Planner.
-func NewPlanner(cli *CLI, pwd string, promptsFS embed.FS) *Planner {
+func NewPlanner(cli *CLI, pwd string, loader *prompts.Loader, cfg *config.Config, llm *client.Client) *Planner {
 	return &Planner{
-		cli:       cli,
-		pwd:       pwd,
-		promptsFS: promptsFS,
+		cli:     cli,
+		pwd:     pwd,
+		prompts: loader,
+		config:  cfg,
+		llm:     llm,
 	}
 }
 
 // Run executes the planning phase.
-func (p *Planner) Run(fileInfos []map[string]interface{}) (string, error) {
-	// Load planning prompt template using the shared loadPromptTemplate function
-	planningTmpl, err := loadPromptTemplate(p.promptsFS, "planning.md")
+func (p *Planner) Run(ctx context.Context, fileInfos []map[string]interface{}) (_ *Plan, err error) {
+	ctx, span := telemetry.Start(ctx, "planner.run",
+		attribute.String("model", p.cli.PlanningModel),
+		attribute.Int("files", len(fileInfos)),
+	)
+	defer func() { telemetry.End(span, err) }()
+
+	ctx = progress.WithAgent(ctx, "planning")
+	progress.Phase(ctx, "planning")
+
+	prompt, toolsToInclude, contextBudget, err := p.setup(ctx, fileInfos)
 	if err != nil {
-		return "", fmt.Errorf("failed to load planning prompt: %w", err)
+		return nil, err
 	}
+	ctx = provider.WithContextWindow(ctx, contextBudget.Window)
 
-	var customPrompt []byte
-	customPromptPath := filepath.Join(p.pwd, ".prompts", "planning.md")
-	if _, err := os.Stat(customPromptPath); err == nil {
-		customPrompt, err = os.ReadFile(customPromptPath)
-		if err != nil {
-			return "", fmt.Errorf("failed to read custom planning prompt: %w", err)
-		}
+	// Create user message for planning agent
+	userMessage, err := p.createPlanningUserMessage(fileInfos, contextBudget)
+	if err != nil {
+		return nil, err
 	}
 
-	// Execute planning template
-	var planningPromptBuf strings.Builder
-	err = planningTmpl.Execute(&planningPromptBuf, map[string]interface{}{
-		"Message":      p.cli.Message,
-		"Files":        fileInfos,
-		"CustomPrompt": string(customPrompt),
-		"BatchMode":    p.cli.Batch,
-	})
+	err = contextBudget.Check("planning prompt and message", prompt, userMessage)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute planning prompt template: %w", err)
+		return nil, err
 	}
 
-	// Create planning agent
-	planningAgent := agent.New(
-		"Planning Agent",
-		planningPromptBuf.String(),
-		agent.WithClient(client.New(
-			p.cli.PlanningApiEndpoint,
-			p.cli.PlanningApiToken,
-			p.cli.PlanningModel,
-		)),
+	return p.plan(ctx, prompt, toolsToInclude, fileInfos, userMessage)
+}
+
+// Replan revises the plan after the executing agent reported that it cannot
+// be followed, using what was done and learned during execution.
+func (p *Planner) Replan(ctx context.Context, previous *Plan, fileInfos []map[string]interface{}, replan *ReplanError, attempt int) (_ *Plan, err error) {
+	ctx, span := telemetry.Start(ctx, "planner.replan",
+		attribute.String("model", p.cli.PlanningModel),
+		attribute.Int("files", len(fileInfos)),
+		attribute.Int("attempt", attempt),
 	)
+	defer func() { telemetry.End(span, err) }()
 
-	// Create user message for planning agent
-	userMessage := p.createPlanningUserMessage(fileInfos)
+	ctx = progress.WithAgent(ctx, "planning")
+	progress.Phase(ctx, fmt.Sprintf("re-planning (%d of %d)", attempt, p.cli.MaxReplans))
+
+	prompt, toolsToInclude, contextBudget, err := p.setup(ctx, fileInfos)
+	if err != nil {
+		return nil, err
+	}
+	ctx = provider.WithContextWindow(ctx, contextBudget.Window)
+
+	userMessage, err := p.createPlanningUserMessage(fileInfos, contextBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	replanMessage, err := p.createReplanMessage(previous, replan, attempt, contextBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	userMessage += "\n\n" + replanMessage
+
+	err = contextBudget.Check("re-planning prompt and message", prompt, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("planning.replan", "attempt", attempt, "max_replans", p.cli.MaxReplans, "reason", replan.Report.Reason)
+
+	return p.plan(ctx, prompt, toolsToInclude, fileInfos, userMessage)
+}
+
+// setup renders the planning prompt and selects the planning tools.
+func (p *Planner) setup(ctx context.Context, fileInfos []map[string]interface{}) (string, []agent.Tool, budget.Budget, error) {
+	contextBudget := newBudget(ctx, p.config, p.cli.PlanningProvider, p.cli.PlanningApiEndpoint, p.cli.PlanningModel, p.cli.PlanningContextWindow)
+
+	toolsToInclude := progress.Track(budget.LimitToolOutputs(
+		telemetry.Track(tools.SelectReadOnly(p.pwd, p.cli.PlanningTools)),
+		contextBudget.MaxToolOutput(),
+	))
+
+	prompt, err := p.planningPrompt(ctx, fileInfos, toolsToInclude)
+	if err != nil {
+		return "", nil, contextBudget, err
+	}
+
+	return prompt, toolsToInclude, contextBudget, nil
+}
+
+// planningPrompt renders the planning prompt.
+func (p *Planner) planningPrompt(ctx context.Context, fileInfos []map[string]interface{}, toolsToInclude []agent.Tool) (string, error) {
+	packs, err := p.prompts.Packs(detectLanguages(ctx, p.pwd, fileInfos))
+	if err != nil {
+		return "", err
+	}
+
+	conventions, err := discoverConventions(ctx, p.pwd, p.cli.ConventionsTokens)
+	if err != nil {
+		return "", err
+	}
+
+	prompt, err := p.prompts.Render("planning.md", map[string]interface{}{
+		"Message":     p.cli.Message,
+		"Files":       fileInfos,
+		"Tools":       toolsToInclude,
+		"Languages":   packs,
+		"Conventions": conventions,
+		"BatchMode":   p.cli.Batch,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render planning prompt: %w", err)
+	}
+
+	return prompt, nil
+}
+
+// plan runs the planning agent and then critiques and refines its plan.
+func (p *Planner) plan(ctx context.Context, prompt string, toolsToInclude []agent.Tool, fileInfos []map[string]interface{}, userMessage string) (*Plan, error) {
 	if p.cli.Batch {
 		userMessage += "\n\nNote: Your plan will be executed in batch mode, processing each file individually."
 	}
 
 	// Run planning agent
-	response, err := planningAgent.Run(
-		context.Background(),
+	response, err := p.runPlanningAgent(
+		ctx,
+		prompt,
+		toolsToInclude,
 		agent.Messages{
 			agent.Message{
 				Role:    "user",
@@ -87,38 +185,265 @@ func (p *Planner) Run(fileInfos []map[string]interface{}) (string, error) {
 		},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to run planning agent: %w", err)
+		return nil, err
 	}
 
 	// Process the plan
-	plan := p.extractAndCleanPlanFromResponse(response)
+	plan := &Plan{
+		Text: p.extractAndCleanPlanFromResponse(response),
+	}
+
+	// Critique and refine the plan before it is executed
+	for round := 1; round <= p.cli.ReviewRounds; round++ {
+		err = interrupt.Check(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = usage.Check(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		progress.Phase(ctx, fmt.Sprintf("reviewing plan (round %d of %d)", round, p.cli.ReviewRounds))
+
+		critique, err := p.review(ctx, plan.Text, fileInfos, round)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Critiques = append(plan.Critiques, critique)
+		slog.Info("planning.review", "round", round, "score", critique.Score, "approved", critique.Approved, "issues", len(critique.Issues), "missing_files", critique.MissingFiles)
+
+		if critique.Passes(p.cli.ReviewMinScore) {
+			break
+		}
+
+		// A revision in the last round would be executed without review, so
+		// the plan is kept and the critic's objections are reported instead
+		if round == p.cli.ReviewRounds {
+			slog.Warn("planning.review_unresolved", "round", round, "score", critique.Score, "issues", critique.Issues, "missing_files", critique.MissingFiles)
+			break
+		}
+
+		revisionMessage, err := p.createRevisionMessage(critique)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err = p.runPlanningAgent(
+			ctx,
+			prompt,
+			toolsToInclude,
+			append(response.Messages[1:], agent.Message{
+				Role:    "user",
+				Content: revisionMessage,
+			}),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Text = p.extractAndCleanPlanFromResponse(response)
+	}
 
-	slog.Debug("planning.agent", "plan", plan, "batch_mode", p.cli.Batch)
+	slog.Debug("planning.agent", "plan", plan.Text, "batch_mode", p.cli.Batch, "review_rounds", len(plan.Critiques))
 	return plan, nil
 }
 
-// createPlanningUserMessage creates the user message for the planning agent.
-func (p *Planner) createPlanningUserMessage(fileInfos []map[string]interface{}) string {
-	var filesList string
-	if len(fileInfos) == 0 {
-		filesList = "Files: Working from current directory (no specific files provided)\n"
-	} else {
-		filesList = "Files: \n"
-		for _, file := range fileInfos {
-			filesList += fmt.Sprintf("- %s: language %q, size %d\n",
-				file["filename"], file["language"], file["size"])
+// runPlanningAgent runs the planning agent until it answers. If the
+// iteration cap is reached while it is still exploring, it is asked for the
+// plan without tools.
+func (p *Planner) runPlanningAgent(ctx context.Context, prompt string, toolsToUse []agent.Tool, messages agent.Messages) (*agent.Response, error) {
+	response, err := p.createPlanningAgent(prompt, toolsToUse).Run(
+		ctx,
+		messages,
+		agent.WithMaxMessages(p.cli.PlanningMaxIterations),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run planning agent: %w", err)
+	}
+
+	if isFinalAnswer(response) {
+		return response, nil
+	}
+
+	slog.Warn("planning.max_iterations", "max_iterations", p.cli.PlanningMaxIterations)
+
+	response, err = p.createPlanningAgent(prompt, nil).Run(
+		ctx,
+		append(withoutToolCalls(response.Messages[1:]), agent.Message{
+			Role:    "user",
+			Content: "You have reached the limit for exploring the codebase. Write the plan now using what you have learned.",
+		}),
+		agent.WithMaxMessages(1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run planning agent: %w", err)
+	}
+
+	return response, nil
+}
+
+// withoutToolCalls rewrites tool calls and their results as plain messages,
+// since many backends reject them in a request that declares no tools.
+func withoutToolCalls(messages agent.Messages) agent.Messages {
+	rewritten := make(agent.Messages, 0, len(messages))
+
+	for _, message := range messages {
+		switch {
+		case len(message.ToolCalls) > 0:
+			lines := []string{}
+			if message.Content != "" {
+				lines = append(lines, message.Content)
+			}
+			for _, call := range message.ToolCalls {
+				lines = append(lines, fmt.Sprintf("Called %s with %s", call.Function.Name, call.Function.Arguments))
+			}
+
+			rewritten = append(rewritten, agent.Message{Role: "assistant", Content: strings.Join(lines, "\n")})
+		case message.Role == "tool":
+			rewritten = append(rewritten, agent.Message{Role: "user", Content: fmt.Sprintf("Result of %s:\n%s", message.Name, message.Content)})
+		default:
+			rewritten = append(rewritten, message)
 		}
 	}
-	return "User Messages:\n" + p.cli.Message + "\n\n" + filesList
+
+	return rewritten
+}
+
+// review asks a critic to score the plan against the user's message and
+// checks that the files it references exist in the workspace.
+func (p *Planner) review(ctx context.Context, plan string, fileInfos []map[string]interface{}, round int) (review.Critique, error) {
+	missingFiles := review.MissingFiles(p.pwd, review.ReferencedFiles(plan))
+
+	reviewPrompt, err := p.prompts.Render("review.md", map[string]interface{}{
+		"Message":      p.cli.Message,
+		"Plan":         plan,
+		"Files":        fileInfos,
+		"MissingFiles": missingFiles,
+		"BatchMode":    p.cli.Batch,
+	})
+	if err != nil {
+		return review.Critique{}, fmt.Errorf("failed to render review prompt: %w", err)
+	}
+
+	reviewingAgent := agent.New(
+		"Plan Reviewer",
+		reviewPrompt,
+		agent.WithClient(p.llm),
+	)
+
+	response, err := reviewingAgent.Run(
+		progress.WithAgent(ctx, "reviewer"),
+		agent.Messages{
+			agent.Message{
+				Role:    "user",
+				Content: "Review the plan.",
+			},
+		},
+		agent.WithMaxMessages(1),
+	)
+	if err != nil {
+		return review.Critique{}, fmt.Errorf("failed to run plan reviewer: %w", err)
+	}
+
+	critique := review.ParseCritique(cleanResponse(response.Messages[len(response.Messages)-1].Content))
+	critique.Round = round
+	critique.MissingFiles = missingFiles
+
+	return critique, nil
+}
+
+// createRevisionMessage asks the planner to address a critique.
+func (p *Planner) createRevisionMessage(critique review.Critique) (string, error) {
+	revisePrompt, err := p.prompts.Render("revise.md", map[string]interface{}{
+		"Critique": critique.String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render revise prompt: %w", err)
+	}
+
+	return revisePrompt, nil
+}
+
+// createReplanMessage describes the failed plan and the execution so far.
+// The transcript is truncated to a quarter of the available context.
+func (p *Planner) createReplanMessage(previous *Plan, replan *ReplanError, attempt int, contextBudget budget.Budget) (string, error) {
+	replanPrompt, err := p.prompts.Render("replan.md", map[string]interface{}{
+		"Plan":          previous.Text,
+		"Report":        replan.Report.String(),
+		"Transcript":    budget.Truncate(replan.Transcript, contextBudget.Available()/4),
+		"ModifiedFiles": replan.ModifiedFiles,
+		"Attempt":       attempt,
+		"MaxReplans":    p.cli.MaxReplans,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render replan prompt: %w", err)
+	}
+
+	return replanPrompt, nil
+}
+
+// createPlanningAgent creates and configures the planning agent with read-only tools.
+func (p *Planner) createPlanningAgent(prompt string, toolsToUse []agent.Tool) *agent.Agent {
+	planningAgent := agent.New(
+		"Planning Agent",
+		prompt,
+		agent.WithClient(p.llm),
+	)
+
+	toolNames := []string{}
+	for _, tool := range toolsToUse {
+		planningAgent.Tools.Add(tool)
+		toolNames = append(toolNames, tool.Name)
+	}
+
+	slog.Debug("planning.agent", "tools", toolNames, "max_iterations", p.cli.PlanningMaxIterations)
+	return planningAgent
+}
+
+// isFinalAnswer reports whether the agent finished with an answer rather
+// than stopping at the iteration cap in the middle of tool calls.
+func isFinalAnswer(response *agent.Response) bool {
+	lastMessage := response.Messages[len(response.Messages)-1]
+	return lastMessage.Role == "assistant" && len(lastMessage.ToolCalls) == 0
+}
+
+// createPlanningUserMessage creates the user message for the planning agent,
+// packing in file contents (or a repository map) up to the context budget.
+// The file contents never take more than half of the model's available window.
+func (p *Planner) createPlanningUserMessage(fileInfos []map[string]interface{}, contextBudget budget.Budget) (string, error) {
+	files := make([]contextbuilder.File, 0, len(fileInfos))
+	for _, file := range fileInfos {
+		files = append(files, contextbuilder.File{
+			Filename: file["filename"].(string),
+			Language: file["language"].(string),
+			Size:     file["size"].(int),
+		})
+	}
+
+	tokens := min(p.cli.PlanningContextTokens, contextBudget.Available()/2)
+
+	filesContext, err := contextbuilder.New(p.pwd, tokens).Build(files)
+	if err != nil {
+		return "", fmt.Errorf("failed to build planning context: %w", err)
+	}
+
+	return "User Messages:\n" + p.cli.Message + "\n\n" + filesContext, nil
 }
 
 // extractAndCleanPlanFromResponse extracts and cleans the plan from the agent's response.
 func (p *Planner) extractAndCleanPlanFromResponse(response *agent.Response) string {
-	plan := response.Messages[len(response.Messages)-1].Content
+	return cleanResponse(response.Messages[len(response.Messages)-1].Content)
+}
 
-	cleanupPlan := regexp.MustCompile(`</(?:\w+)>`)
-	if loc := cleanupPlan.FindStringIndex(plan); loc != nil {
-		plan = plan[loc[1]:]
+// cleanResponse removes any reasoning that precedes the first closing tag
+// (e.g. </think>) from a model's response.
+func cleanResponse(content string) string {
+	cleanup := regexp.MustCompile(`</(?:\w+)>`)
+	if loc := cleanup.FindStringIndex(content); loc != nil {
+		content = content[loc[1]:]
 	}
-	return strings.TrimSpace(plan)
+	return strings.TrimSpace(content)
 }
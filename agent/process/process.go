@@ -0,0 +1,3 @@
+// Package process configures child processes so they can be stopped
+// together with everything they started.
+package process
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package process
+
+import "os/exec"
+
+// Isolate is a no-op where process groups are not supported; cancelling
+// the context kills only the command itself.
+func Isolate(cmd *exec.Cmd) {}
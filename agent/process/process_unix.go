@@ -0,0 +1,24 @@
+//go:build unix
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Isolate runs cmd in its own process group. Signals sent to the agent's
+// terminal, such as Ctrl-C, do not reach it, and cancelling its context
+// kills the whole group so no grandchildren are orphaned.
+func Isolate(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+
+		return err
+	}
+}
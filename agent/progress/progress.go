@@ -0,0 +1,152 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Kind identifies what an event reports.
+type Kind string
+
+const (
+	// PhaseStarted is reported when the run enters a phase such as planning.
+	PhaseStarted Kind = "phase"
+	// PlanReady carries the plan, and any revised plan, before execution.
+	PlanReady Kind = "plan"
+	// FileStarted and FileDone bracket each file in batch mode.
+	FileStarted Kind = "file.start"
+	FileDone    Kind = "file.done"
+	// Token carries text streamed from a model.
+	Token Kind = "token"
+	// ToolStarted and ToolDone bracket each tool call.
+	ToolStarted Kind = "tool.start"
+	ToolDone    Kind = "tool.done"
+)
+
+// Event is a single progress update.
+type Event struct {
+	Kind        Kind      `json:"kind"`
+	Time        time.Time `json:"time"`
+	Agent       string    `json:"agent,omitempty"`
+	Phase       string    `json:"phase,omitempty"`
+	File        string    `json:"file,omitempty"`
+	Index       int       `json:"index,omitempty"`
+	Total       int       `json:"total,omitempty"`
+	Tool        string    `json:"tool,omitempty"`
+	Explanation string    `json:"explanation,omitempty"`
+	Summary     string    `json:"summary,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	DurationMS  int64     `json:"duration_ms,omitempty"`
+}
+
+// Reporter receives progress events. Implementations must be safe for
+// concurrent use.
+type Reporter interface {
+	Report(event Event)
+}
+
+// Discard ignores every event.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Report(Event) {}
+
+// Output modes for New.
+const (
+	Auto    = "auto"
+	Console = "console"
+	JSON    = "json"
+	None    = "none"
+)
+
+// New creates a reporter writing to out. Auto renders for humans when out
+// is a terminal and as newline-delimited JSON otherwise.
+func New(mode string, out *os.File) (Reporter, error) {
+	switch mode {
+	case Auto, "":
+		if isTerminal(out) {
+			return NewConsole(out), nil
+		}
+		return NewJSON(out), nil
+	case Console:
+		return NewConsole(out), nil
+	case JSON:
+		return NewJSON(out), nil
+	case None:
+		return Discard, nil
+	default:
+		return nil, fmt.Errorf("unknown progress mode %q", mode)
+	}
+}
+
+// isTerminal reports whether file is a character device, such as a TTY.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+type reporterKey struct{}
+
+type agentKey struct{}
+
+// WithReporter returns a context whose events are sent to reporter.
+func WithReporter(ctx context.Context, reporter Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, reporter)
+}
+
+// WithAgent returns a context whose events are attributed to the named agent.
+func WithAgent(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, agentKey{}, name)
+}
+
+// Agent returns the name of the agent the context is attributed to.
+func Agent(ctx context.Context) string {
+	name, _ := ctx.Value(agentKey{}).(string)
+	return name
+}
+
+// FromContext returns the context's reporter, or Discard.
+func FromContext(ctx context.Context) Reporter {
+	if reporter, ok := ctx.Value(reporterKey{}).(Reporter); ok && reporter != nil {
+		return reporter
+	}
+
+	return Discard
+}
+
+// Enabled reports whether events sent with ctx are observed, so callers can
+// skip work such as streaming when nobody is watching.
+func Enabled(ctx context.Context) bool {
+	return FromContext(ctx) != Discard
+}
+
+// Emit reports event to the context's reporter, stamping its time and agent.
+func Emit(ctx context.Context, event Event) {
+	reporter := FromContext(ctx)
+	if reporter == Discard {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if event.Agent == "" {
+		event.Agent = Agent(ctx)
+	}
+
+	reporter.Report(event)
+}
+
+// Phase reports that the run entered the named phase.
+func Phase(ctx context.Context, phase string) {
+	Emit(ctx, Event{Kind: PhaseStarted, Phase: phase})
+}
@@ -0,0 +1,101 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+)
+
+func TestEmit(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(progress.Enabled(context.Background())).To(BeFalse())
+	progress.Emit(context.Background(), progress.Event{Kind: progress.Token, Text: "ignored"})
+
+	output := &bytes.Buffer{}
+	ctx := progress.WithAgent(progress.WithReporter(context.Background(), progress.NewJSON(output)), "planning")
+	assert.Expect(progress.Enabled(ctx)).To(BeTrue())
+
+	progress.Phase(ctx, "planning")
+	progress.Emit(ctx, progress.Event{Kind: progress.Token, Text: "Hello"})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Expect(lines).To(HaveLen(2))
+
+	var event progress.Event
+	err := json.Unmarshal([]byte(lines[1]), &event)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(event.Kind).To(Equal(progress.Token))
+	assert.Expect(event.Agent).To(Equal("planning"))
+	assert.Expect(event.Text).To(Equal("Hello"))
+	assert.Expect(event.Time.IsZero()).To(BeFalse())
+}
+
+func TestConsole(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	output := &bytes.Buffer{}
+	console := progress.NewConsole(output)
+
+	console.Report(progress.Event{Kind: progress.FileStarted, File: "main.go", Index: 1, Total: 2})
+	console.Report(progress.Event{Kind: progress.Token, Text: "Reading "})
+	console.Report(progress.Event{Kind: progress.Token, Text: "the file"})
+	console.Report(progress.Event{Kind: progress.ToolStarted, Tool: "read_file", Explanation: "inspect main"})
+	console.Report(progress.Event{Kind: progress.ToolDone, Tool: "read_file", Summary: "package main", DurationMS: 12})
+	console.Report(progress.Event{Kind: progress.ToolDone, Tool: "run_in_terminal", Error: "exit status 1"})
+
+	rendered := output.String()
+	assert.Expect(rendered).To(ContainSubstring("[1/2] main.go"))
+	assert.Expect(rendered).To(ContainSubstring("Reading the file\x1b[0m\n"))
+	assert.Expect(rendered).To(ContainSubstring("-> read_file: inspect main\n"))
+	assert.Expect(rendered).To(ContainSubstring("read_file (12ms) package main"))
+	assert.Expect(rendered).To(ContainSubstring("run_in_terminal (0s): exit status 1"))
+}
+
+func TestTrack(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	output := &bytes.Buffer{}
+	ctx := progress.WithReporter(context.Background(), progress.NewJSON(output))
+
+	tracked := progress.Track([]agent.Tool{
+		{Name: "ok", Func: func(ctx context.Context, params map[string]any) (any, error) {
+			return "first line\nsecond line", nil
+		}},
+		{Name: "fails", Func: func(ctx context.Context, params map[string]any) (any, error) {
+			return nil, errors.New("boom")
+		}},
+	})
+
+	_, err := tracked[0].Func(ctx, map[string]any{"explanation": "look around"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tracked[1].Func(ctx, map[string]any{})
+	assert.Expect(err).To(MatchError("boom"))
+
+	events := []progress.Event{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var event progress.Event
+		assert.Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+		events = append(events, event)
+	}
+
+	assert.Expect(events).To(HaveLen(4))
+	assert.Expect(events[0].Explanation).To(Equal("look around"))
+	assert.Expect(events[1].Summary).To(Equal("first line (2 lines)"))
+	assert.Expect(events[3].Error).To(Equal("boom"))
+}
+
+func TestSummarize(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(progress.Summarize(nil)).To(Equal(""))
+	assert.Expect(progress.Summarize(strings.Repeat("a", 150))).To(Equal(strings.Repeat("a", 100) + "..."))
+}
@@ -0,0 +1,129 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONReporter writes each event as a line of JSON.
+type JSONReporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSON creates a reporter writing newline-delimited JSON to w.
+func NewJSON(w io.Writer) *JSONReporter {
+	return &JSONReporter{encoder: json.NewEncoder(w)}
+}
+
+func (r *JSONReporter) Report(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_ = r.encoder.Encode(event)
+}
+
+// ConsoleReporter renders events for a person watching a terminal, with
+// model output streamed inline and tool calls on their own lines.
+type ConsoleReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// streaming is set while model text is being written, so the next
+	// non-token event starts on a new line.
+	streaming bool
+}
+
+// NewConsole creates a reporter rendering events for humans to w.
+func NewConsole(w io.Writer) *ConsoleReporter {
+	return &ConsoleReporter{w: w}
+}
+
+func (r *ConsoleReporter) Report(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Kind == Token {
+		if !r.streaming {
+			_, _ = fmt.Fprint(r.w, "\x1b[2m")
+			r.streaming = true
+		}
+		_, _ = fmt.Fprint(r.w, event.Text)
+		return
+	}
+
+	if r.streaming {
+		_, _ = fmt.Fprint(r.w, "\x1b[0m\n")
+		r.streaming = false
+	}
+
+	switch event.Kind {
+	case PhaseStarted:
+		_, _ = fmt.Fprintf(r.w, "\x1b[1m==> %s\x1b[0m\n", event.Phase)
+	case FileStarted:
+		_, _ = fmt.Fprintf(r.w, "\x1b[1m[%d/%d] %s\x1b[0m\n", event.Index, event.Total, event.File)
+	case FileDone:
+		_, _ = fmt.Fprintf(r.w, "[%d/%d] %s done in %s\n", event.Index, event.Total, event.File, duration(event.DurationMS))
+	case ToolStarted:
+		line := "  -> " + event.Tool
+		if event.Explanation != "" {
+			line += ": " + event.Explanation
+		}
+		_, _ = fmt.Fprintln(r.w, line)
+	case ToolDone:
+		if event.Error != "" {
+			_, _ = fmt.Fprintf(r.w, "  \x1b[31mx %s (%s): %s\x1b[0m\n", event.Tool, duration(event.DurationMS), event.Error)
+			return
+		}
+		_, _ = fmt.Fprintf(r.w, "  \x1b[32mok\x1b[0m %s (%s) %s\n", event.Tool, duration(event.DurationMS), event.Summary)
+	}
+}
+
+// Close ends model output left streaming when the run finishes.
+func (r *ConsoleReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.streaming {
+		_, _ = fmt.Fprint(r.w, "\x1b[0m\n")
+		r.streaming = false
+	}
+
+	return nil
+}
+
+func duration(milliseconds int64) string {
+	return (time.Duration(milliseconds) * time.Millisecond).String()
+}
+
+// maxSummary is the longest tool result summary reported.
+const maxSummary = 100
+
+// Summarize shortens a tool result to its first line, noting how much was
+// left out.
+func Summarize(value any) string {
+	if value == nil {
+		return ""
+	}
+
+	text := strings.TrimSpace(fmt.Sprintf("%s", value))
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Count(text, "\n") + 1
+	first, _, _ := strings.Cut(text, "\n")
+
+	if runes := []rune(first); len(runes) > maxSummary {
+		first = string(runes[:maxSummary]) + "..."
+	}
+
+	if lines > 1 {
+		first += fmt.Sprintf(" (%d lines)", lines)
+	}
+
+	return first
+}
@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// Track wraps tools so each call is reported to the reporter in the call's
+// context, with the tool's explanation parameter and a summary of its result.
+// The full result is logged at debug level.
+func Track(tools []agent.Tool) []agent.Tool {
+	tracked := make([]agent.Tool, 0, len(tools))
+
+	for _, tool := range tools {
+		next := tool.Func
+		name := tool.Name
+
+		tool.Func = func(ctx context.Context, params map[string]any) (any, error) {
+			explanation, _ := params["explanation"].(string)
+			Emit(ctx, Event{Kind: ToolStarted, Tool: name, Explanation: explanation})
+
+			started := time.Now()
+			value, err := next(ctx, params)
+
+			event := Event{
+				Kind:       ToolDone,
+				Tool:       name,
+				DurationMS: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				event.Error = err.Error()
+				slog.Debug("tool.failed", "tool", name, "params", params, "error", err)
+			} else {
+				event.Summary = Summarize(value)
+				slog.Debug("tool.done", "tool", name, "params", params, "output", fmt.Sprintf("%s", value))
+			}
+			Emit(ctx, event)
+
+			return value, err
+		}
+
+		tracked = append(tracked, tool)
+	}
+
+	return tracked
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/prompts"
+	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/agent/agent/verify"
+	"github.com/jtarchie/agent/agent/workspace"
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// Prompts defines the commands for working with prompt templates
+type Prompts struct {
+	Render PromptsRender `cmd:"" help:"Render a prompt as it would be sent, with every customization applied."`
+}
+
+// PromptsRender previews a prompt. Values only known during a run, such as
+// the plan, are shown as placeholders.
+type PromptsRender struct {
+	Name     string   `arg:"" help:"Prompt to render: planning, execute, review, revise, replan, verify or summarize."`
+	Patterns []string `arg:"" optional:"" help:"Files or globs to render the prompt with."`
+	Message  string   `help:"Message to render the prompt with." default:"<message>"`
+	Plan     string   `help:"File holding a plan to render the prompt with." type:"existingfile"`
+	Batch    bool     `help:"Render the prompt as used in batch mode."`
+	Tools    []string `help:"List of tools to render the prompt with. Default is all." optional:""`
+	Sources  bool     `help:"List the files that make up the prompt on stderr."`
+
+	Settings `embed:""`
+}
+
+// Run writes the rendered prompt to stdout.
+func (r *PromptsRender) Run() error {
+	name := strings.TrimSuffix(r.Name, ".md") + ".md"
+	if !slices.Contains(prompts.Names(), name) {
+		return fmt.Errorf("unknown prompt %q", r.Name)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current working directory: %w", err)
+	}
+
+	cfg, err := config.Load(expandHome(r.ConfigFiles)...)
+	if err != nil {
+		return err
+	}
+
+	cli := &CLI{
+		Patterns: r.Patterns,
+		Message:  r.Message,
+		Batch:    r.Batch,
+		Tools:    r.Tools,
+		Settings: r.Settings,
+	}
+
+	ctx := context.Background()
+
+	filenames, err := cli.selectFiles(ctx, pwd)
+	if err != nil {
+		return err
+	}
+
+	fileInfos, err := processFiles(filenames, pwd)
+	if err != nil {
+		return err
+	}
+
+	plan := "<plan>"
+	if r.Plan != "" {
+		contents, err := os.ReadFile(r.Plan)
+		if err != nil {
+			return fmt.Errorf("failed to read plan: %w", err)
+		}
+
+		plan = string(contents)
+	}
+
+	loader := newPrompts(ctx, cfg, pwd)
+	if r.Sources {
+		for _, source := range loader.Sources(name) {
+			fmt.Fprintf(os.Stderr, "%s\t%s\t%s\n", source.Layer, source.Kind, source.Path)
+		}
+	}
+
+	var prompt string
+
+	switch name {
+	case "planning.md":
+		planner := NewPlanner(cli, pwd, loader, cfg, nil)
+		prompt, err = planner.planningPrompt(ctx, fileInfos, tools.SelectReadOnly(pwd, cli.PlanningTools))
+	case "execute.md":
+		var custom []agent.Tool
+
+		custom, err = customTools(pwd)
+		if err != nil {
+			return err
+		}
+
+		executor := NewExecutor(cli, pwd, loader, cfg, nil, custom, nil)
+
+		selected := tools.Select(pwd, cli.Tools, custom...)
+		if cli.MaxReplans > 0 {
+			selected = append(selected, tools.MustReportPlanInvalid())
+		}
+
+		// Batch runs render the prompt for each file in turn
+		if cli.Batch && len(fileInfos) > 0 {
+			fileInfos = fileInfos[:1]
+		}
+
+		prompt, err = executor.executePrompt(ctx, plan, fileInfos, selected)
+	default:
+		prompt, err = loader.Render(name, map[string]any{
+			"Message":       cli.Message,
+			"Plan":          plan,
+			"Files":         fileInfos,
+			"MissingFiles":  []string{},
+			"BatchMode":     cli.Batch,
+			"Critique":      "<critique>",
+			"Report":        "<report>",
+			"Transcript":    "<transcript>",
+			"ModifiedFiles": []string{},
+			"Attempt":       1,
+			"MaxReplans":    cli.MaxReplans,
+			"Failures":      []verify.Result{{Command: "<command>", ExitCode: 1, Output: "<output>"}},
+			"Round":         1,
+			"MaxRounds":     cli.VerifyRounds,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(prompt)
+
+	return nil
+}
+
+// newPrompts layers the user's prompts in ~/.config/agent/prompts, then the
+// .prompts directories of the repository root and of pwd, over the built-in
+// templates.
+func newPrompts(ctx context.Context, cfg *config.Config, pwd string) *prompts.Loader {
+	layers := []prompts.Layer{
+		{Name: "user", Dir: expandHome([]string{"~/.config/agent/prompts"})[0]},
+	}
+
+	root, err := workspace.Root(ctx, pwd)
+	if err == nil && !sameDir(root, pwd) {
+		layers = append(layers, prompts.Layer{Name: "repository", Dir: filepath.Join(root, ".prompts")})
+	}
+
+	layers = append(layers, prompts.Layer{Name: "workspace", Dir: filepath.Join(pwd, ".prompts")})
+
+	return prompts.New(cfg.Prompts.Variables, layers...)
+}
+
+// sameDir reports whether a and b are the same directory, resolving
+// symlinks such as macOS's /tmp.
+func sameDir(a, b string) bool {
+	a, errA := filepath.EvalSymlinks(a)
+	b, errB := filepath.EvalSymlinks(b)
+
+	return errA == nil && errB == nil && a == b
+}
@@ -0,0 +1,107 @@
+package prompts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pack is guidance for working in a language, such as its idioms, test and
+// formatter commands. Packs are in "languages/<language>.md", with the
+// language in lower case and spaces as dashes, and a layer's pack replaces
+// the built-in one.
+type Pack struct {
+	Language string `yaml:"-"`
+	// Verify is the command that checks changes in the language, e.g.
+	// "go test ./...".
+	Verify   string `yaml:"verify"`
+	Guidance string `yaml:"-"`
+}
+
+// aliases maps languages to the language whose pack they share.
+var aliases = map[string]string{
+	"TSX": "TypeScript",
+	"JSX": "JavaScript",
+}
+
+var slugs = strings.NewReplacer(" ", "-", "+", "p", "#", "sharp")
+
+// Packs returns the packs for languages, as named by go-enry (e.g. "Go",
+// "TypeScript"), in order. Languages without a pack are skipped.
+func (l *Loader) Packs(languages []string) ([]Pack, error) {
+	packs := []Pack{}
+	seen := map[string]bool{}
+
+	for _, language := range languages {
+		if alias, ok := aliases[language]; ok {
+			language = alias
+		}
+
+		if language == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+
+		pack, ok, err := l.pack(language)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			packs = append(packs, pack)
+		}
+	}
+
+	return packs, nil
+}
+
+func (l *Loader) pack(language string) (Pack, bool, error) {
+	name := "languages/" + slugs.Replace(strings.ToLower(language)) + ".md"
+
+	path := name
+	contents, err := builtin.ReadFile(name)
+	found := err == nil
+
+	for _, layer := range l.layers {
+		layerPath := filepath.Join(layer.Dir, filepath.FromSlash(name))
+		if !exists(layerPath) {
+			continue
+		}
+
+		contents, err = os.ReadFile(layerPath)
+		if err != nil {
+			return Pack{}, false, fmt.Errorf("failed to read language pack %s: %w", layerPath, err)
+		}
+
+		path, found = layerPath, true
+	}
+
+	if !found {
+		return Pack{}, false, nil
+	}
+
+	pack := Pack{Language: language}
+
+	// Settings are in YAML front matter, the rest is guidance
+	body := contents
+	if rest, ok := bytes.CutPrefix(contents, []byte("---\n")); ok {
+		header, guidance, ok := bytes.Cut(rest, []byte("\n---\n"))
+		if ok {
+			err := yaml.Unmarshal(header, &pack)
+			if err != nil {
+				return Pack{}, false, fmt.Errorf("failed to parse language pack %s: %w", path, err)
+			}
+
+			body = guidance
+		}
+	}
+
+	pack.Language = language
+	pack.Guidance = strings.TrimSpace(string(body))
+
+	return pack, true, nil
+}
@@ -0,0 +1,187 @@
+// Package prompts renders the agent's prompt templates, layering
+// customizations from the user's and the workspace's prompt directories over
+// the built-in templates.
+//
+// In each layer's directory, "<name>.md" adds instructions to a template,
+// rendered into its CustomPrompt, and "<name>.replace.md" replaces the
+// template along with the instructions of the layers before it. Files in "partials/" define templates that can be included with
+// {{ template "<file name without .md>" . }}, and "languages/" holds the
+// language packs. Later layers take precedence.
+package prompts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+//go:embed *.md languages/*.md
+var builtin embed.FS
+
+// Names lists the built-in templates.
+func Names() []string {
+	entries, _ := fs.ReadDir(builtin, ".")
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names
+}
+
+// Layer is a directory of prompt customizations.
+type Layer struct {
+	// Name describes where the layer comes from, e.g. "user" or "repository".
+	Name string
+	Dir  string
+}
+
+// Loader renders templates through its layers.
+type Loader struct {
+	layers    []Layer
+	variables map[string]any
+}
+
+// New creates a loader with layers in increasing precedence. Variables are
+// available to every template as .Vars.
+func New(variables map[string]any, layers ...Layer) *Loader {
+	return &Loader{
+		layers:    layers,
+		variables: variables,
+	}
+}
+
+// Source is a file that contributes to a rendered template.
+type Source struct {
+	Layer string `json:"layer"`
+	Path  string `json:"path"`
+	// Kind is "template", "replace", "append" or "partial".
+	Kind string `json:"kind"`
+}
+
+// Sources lists the files that contribute to the named template, in the
+// order they are applied. A replacement discards the instructions added by
+// the layers below it, so it fully controls the prompt.
+func (l *Loader) Sources(name string) []Source {
+	sources := []Source{{Layer: "builtin", Path: name, Kind: "template"}}
+
+	for _, layer := range l.layers {
+		for _, kind := range []string{"replace", "append"} {
+			path := filepath.Join(layer.Dir, fileName(name, kind))
+			if !exists(path) {
+				continue
+			}
+
+			if kind == "replace" {
+				sources = slices.DeleteFunc(sources, func(source Source) bool { return source.Kind == "append" })
+			}
+
+			sources = append(sources, Source{Layer: layer.Name, Path: path, Kind: kind})
+		}
+
+		partials, _ := filepath.Glob(filepath.Join(layer.Dir, "partials", "*.md"))
+		for _, path := range partials {
+			sources = append(sources, Source{Layer: layer.Name, Path: path, Kind: "partial"})
+		}
+	}
+
+	return sources
+}
+
+// Render executes the named template, such as "planning.md", with data.
+func (l *Loader) Render(name string, data map[string]any) (string, error) {
+	contents, err := builtin.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt %s: %w", name, err)
+	}
+
+	base := template.New(name).Funcs(sprig.FuncMap())
+	appends := []*template.Template{}
+
+	for _, source := range l.Sources(name)[1:] {
+		text, err := os.ReadFile(source.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt %s: %w", source.Path, err)
+		}
+
+		switch source.Kind {
+		case "replace":
+			contents = text
+		case "append":
+			appended, err := base.New(source.Path).Parse(string(text))
+			if err != nil {
+				return "", fmt.Errorf("failed to parse prompt %s: %w", source.Path, err)
+			}
+
+			appends = append(appends, appended)
+		case "partial":
+			// Partials are often included inline, so the file's final
+			// newline is not part of them
+			partial := strings.TrimSuffix(string(text), "\n")
+
+			_, err := base.New(strings.TrimSuffix(filepath.Base(source.Path), ".md")).Parse(partial)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse prompt %s: %w", source.Path, err)
+			}
+		}
+	}
+
+	_, err = base.Parse(string(contents))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt %s: %w", name, err)
+	}
+
+	values := maps.Clone(data)
+	if values == nil {
+		values = map[string]any{}
+	}
+	values["Vars"] = l.variables
+
+	custom := []string{}
+	for _, appended := range appends {
+		var rendered strings.Builder
+
+		err := appended.Execute(&rendered, values)
+		if err != nil {
+			return "", fmt.Errorf("failed to execute prompt %s: %w", appended.Name(), err)
+		}
+
+		custom = append(custom, strings.TrimSpace(rendered.String()))
+	}
+	values["CustomPrompt"] = strings.Join(slices.DeleteFunc(custom, func(text string) bool { return text == "" }), "\n\n")
+
+	var rendered strings.Builder
+
+	err = base.Execute(&rendered, values)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute prompt %s: %w", name, err)
+	}
+
+	return rendered.String(), nil
+}
+
+// fileName is the name of a layer's file of a kind for a template.
+func fileName(name, kind string) string {
+	if kind == "replace" {
+		return strings.TrimSuffix(name, ".md") + ".replace.md"
+	}
+
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
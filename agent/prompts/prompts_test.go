@@ -0,0 +1,135 @@
+package prompts_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/prompts"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuiltin(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(prompts.Names()).To(ContainElements("planning.md", "execute.md", "review.md"))
+
+	loader := prompts.New(nil, prompts.Layer{Name: "workspace", Dir: filepath.Join(t.TempDir(), "missing")})
+
+	rendered, err := loader.Render("revise.md", map[string]any{"Critique": "Name the files."})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(rendered).To(ContainSubstring("Name the files."))
+	assert.Expect(rendered).NotTo(ContainSubstring("custom_prompt"))
+
+	_, err = loader.Render("missing.md", nil)
+	assert.Expect(err).To(HaveOccurred())
+}
+
+func TestLayers(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	user, repository := t.TempDir(), t.TempDir()
+
+	testutil.WriteFile(t, user, "revise.md", "Follow the {{ .Vars.team }} style guide.")
+	testutil.WriteFile(t, user, "partials/style.md", "user style")
+	testutil.WriteFile(t, repository, "revise.md", "Keep changes small.")
+	testutil.WriteFile(t, repository, "partials/style.md", "{{ upper \"repository style\" }}")
+
+	loader := prompts.New(map[string]any{"team": "platform"},
+		prompts.Layer{Name: "user", Dir: user},
+		prompts.Layer{Name: "repository", Dir: repository},
+	)
+
+	// Instructions from every layer are added in order
+	rendered, err := loader.Render("revise.md", map[string]any{"Critique": "Name the files."})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(rendered).To(ContainSubstring("Name the files."))
+	assert.Expect(rendered).To(ContainSubstring("<custom_prompt>\nFollow the platform style guide.\n\nKeep changes small.\n</custom_prompt>"))
+
+	// A replacement uses the most specific partial and keeps the instructions
+	// of its own layer, but not those of the layers below it
+	testutil.WriteFile(t, repository, "revise.replace.md", "{{ template \"style\" . }}: {{ .Critique }}\n{{ .CustomPrompt }}")
+
+	rendered, err = loader.Render("revise.md", map[string]any{"Critique": "Name the files."})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(rendered).To(Equal("REPOSITORY STYLE: Name the files.\nKeep changes small."))
+
+	// The caller's data is not changed
+	data := map[string]any{"Critique": "Name the files."}
+	_, err = loader.Render("revise.md", data)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(data).To(HaveLen(1))
+
+	assert.Expect(loader.Sources("revise.md")).To(Equal([]prompts.Source{
+		{Layer: "builtin", Path: "revise.md", Kind: "template"},
+		{Layer: "user", Path: filepath.Join(user, "partials", "style.md"), Kind: "partial"},
+		{Layer: "repository", Path: filepath.Join(repository, "revise.replace.md"), Kind: "replace"},
+		{Layer: "repository", Path: filepath.Join(repository, "revise.md"), Kind: "append"},
+		{Layer: "repository", Path: filepath.Join(repository, "partials", "style.md"), Kind: "partial"},
+	}))
+
+	testutil.WriteFile(t, repository, "revise.replace.md", "{{ .Unclosed ")
+
+	_, err = loader.Render("revise.md", nil)
+	assert.Expect(err).To(MatchError(ContainSubstring("failed to parse prompt")))
+}
+
+func TestReplaceDiscardsEarlierInstructions(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	user, repository, workspace := t.TempDir(), t.TempDir(), t.TempDir()
+
+	testutil.WriteFile(t, user, "review.md", "Be thorough.")
+	testutil.WriteFile(t, repository, "review.md", "Check the tests.")
+	testutil.WriteFile(t, workspace, "review.replace.md", "Review it.\n{{ .CustomPrompt }}")
+	testutil.WriteFile(t, workspace, "review.md", "Check the docs.")
+
+	loader := prompts.New(nil,
+		prompts.Layer{Name: "user", Dir: user},
+		prompts.Layer{Name: "repository", Dir: repository},
+		prompts.Layer{Name: "workspace", Dir: workspace},
+	)
+
+	rendered, err := loader.Render("review.md", nil)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(rendered).To(Equal("Review it.\nCheck the docs."))
+
+	assert.Expect(loader.Sources("review.md")).To(Equal([]prompts.Source{
+		{Layer: "builtin", Path: "review.md", Kind: "template"},
+		{Layer: "workspace", Path: filepath.Join(workspace, "review.replace.md"), Kind: "replace"},
+		{Layer: "workspace", Path: filepath.Join(workspace, "review.md"), Kind: "append"},
+	}))
+}
+
+func TestPacks(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repository := t.TempDir()
+	loader := prompts.New(nil, prompts.Layer{Name: "repository", Dir: repository})
+
+	packs, err := loader.Packs([]string{"Go", "TSX", "TypeScript", "Brainfuck", ""})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(packs).To(HaveLen(2))
+	assert.Expect(packs[0].Language).To(Equal("Go"))
+	assert.Expect(packs[0].Verify).To(Equal("go test ./..."))
+	assert.Expect(packs[0].Guidance).To(ContainSubstring("gofmt"))
+	assert.Expect(packs[0].Guidance).NotTo(HavePrefix("---"))
+	assert.Expect(packs[1].Language).To(Equal("TypeScript"))
+
+	// A layer replaces a built-in pack, or adds one for another language
+	testutil.WriteFile(t, repository, "languages/go.md", "---\nverify: task test\n---\nUse the Taskfile.\n")
+	testutil.WriteFile(t, repository, "languages/csharp.md", "Run `dotnet format`.\n")
+	testutil.WriteFile(t, repository, "languages/cpp.md", "Run `clang-format`.\n")
+
+	packs, err = loader.Packs([]string{"Go", "C#", "C++"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(packs).To(Equal([]prompts.Pack{
+		{Language: "Go", Verify: "task test", Guidance: "Use the Taskfile."},
+		{Language: "C#", Guidance: "Run `dotnet format`."},
+		{Language: "C++", Guidance: "Run `clang-format`."},
+	}))
+
+	rendered, err := loader.Render("planning.md", map[string]any{"Languages": packs})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(rendered).To(ContainSubstring("### Go\n\nUse the Taskfile."))
+}
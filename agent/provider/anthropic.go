@@ -0,0 +1,280 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/agent/agent/progress"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// anthropicVersion is the Messages API version sent with every request.
+	anthropicVersion = "2023-06-01"
+	// defaultAnthropicMaxTokens is used when the request sets no limit, as
+	// the Messages API requires one.
+	defaultAnthropicMaxTokens = 8192
+)
+
+// anthropicTransport adapts OpenAI chat completions to the Anthropic
+// Messages API, including tool use blocks.
+type anthropicTransport struct {
+	endpoint string
+	token    string
+	next     http.RoundTripper
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicURL returns the Messages endpoint, with or without a /v1 suffix.
+func anthropicURL(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1") {
+		endpoint += "/v1"
+	}
+
+	return endpoint + "/messages"
+}
+
+func (t *anthropicTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !isChatCompletion(request) {
+		return t.next.RoundTrip(request)
+	}
+
+	chat, err := readChatRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"anthropic-version": anthropicVersion,
+	}
+	if t.token != "" {
+		headers["x-api-key"] = t.token
+	}
+
+	native := toAnthropicRequest(chat)
+	native.Stream = progress.Enabled(request.Context())
+
+	response, err := send(t.next, request, anthropicURL(t.endpoint), headers, native)
+	if err != nil {
+		return nil, err
+	}
+
+	if native.Stream && succeeded(response) {
+		defer func() { _ = response.Body.Close() }()
+
+		payload, err := readAnthropicStream(request.Context(), response.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return jsonResponse(request, http.StatusOK, fromAnthropicResponse(payload))
+	}
+
+	var payload anthropicResponse
+
+	errorResponse, err := decodeResponse(request, response, &payload, func(body []byte) string {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &failure)
+		return failure.Error.Message
+	})
+	if errorResponse != nil || err != nil {
+		return errorResponse, err
+	}
+
+	return jsonResponse(request, http.StatusOK, fromAnthropicResponse(payload))
+}
+
+func toAnthropicRequest(chat chatRequest) anthropicRequest {
+	native := anthropicRequest{
+		Model:         chat.Model,
+		Messages:      []anthropicMessage{},
+		MaxTokens:     max(chat.MaxTokens, chat.MaxCompletionTokens),
+		StopSequences: chat.Stop,
+	}
+
+	if native.MaxTokens == 0 {
+		native.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	if chat.Temperature != 0 {
+		native.Temperature = &chat.Temperature
+	}
+
+	system := []string{}
+
+	// appendBlocks adds blocks to the conversation, merging consecutive
+	// turns from the same role as the API requires alternating roles
+	appendBlocks := func(role string, blocks ...anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+
+		if last := len(native.Messages) - 1; last >= 0 && native.Messages[last].Role == role {
+			native.Messages[last].Content = append(native.Messages[last].Content, blocks...)
+			return
+		}
+
+		native.Messages = append(native.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, message := range chat.Messages {
+		text := messageText(message)
+
+		switch message.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			system = append(system, text)
+		case openai.ChatMessageRoleTool:
+			appendBlocks("user", anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: message.ToolCallID,
+				Content:   text,
+			})
+		case openai.ChatMessageRoleAssistant:
+			blocks := []anthropicBlock{}
+			if strings.TrimSpace(text) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+
+			for _, toolCall := range message.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    toolCall.ID,
+					Name:  toolCall.Function.Name,
+					Input: toolArguments(toolCall.Function.Arguments),
+				})
+			}
+
+			appendBlocks("assistant", blocks...)
+		default:
+			if strings.TrimSpace(text) != "" {
+				appendBlocks("user", anthropicBlock{Type: "text", Text: text})
+			}
+		}
+	}
+
+	native.System = strings.Join(system, "\n\n")
+
+	for _, tool := range chat.Tools {
+		if tool.Function == nil {
+			continue
+		}
+
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+
+		native.Tools = append(native.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return native
+}
+
+func fromAnthropicResponse(payload anthropicResponse) openai.ChatCompletionResponse {
+	message := openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+	}
+
+	texts := []string{}
+
+	for _, block := range payload.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(toolArguments(string(block.Input))),
+				},
+			})
+		}
+	}
+
+	message.Content = strings.Join(texts, "")
+
+	finishReason := openai.FinishReasonStop
+	switch payload.StopReason {
+	case "tool_use":
+		finishReason = openai.FinishReasonToolCalls
+	case "max_tokens":
+		finishReason = openai.FinishReasonLength
+	}
+
+	// Input tokens exclude the prompt cache, which OpenAI counts as part
+	// of the prompt
+	promptTokens := payload.Usage.InputTokens + payload.Usage.CacheReadInputTokens + payload.Usage.CacheCreationInputTokens
+
+	return completion(
+		payload.ID,
+		payload.Model,
+		time.Now().Unix(),
+		message,
+		finishReason,
+		openai.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: payload.Usage.OutputTokens,
+			TotalTokens:      promptTokens + payload.Usage.OutputTokens,
+			PromptTokensDetails: &openai.PromptTokensDetails{
+				CachedTokens: payload.Usage.CacheReadInputTokens,
+			},
+		},
+	)
+}
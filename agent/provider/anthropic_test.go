@@ -0,0 +1,114 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestAnthropicToolUse(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	requests := []map[string]any{}
+	headers := []http.Header{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var request map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+		headers = append(headers, r.Header.Clone())
+
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"msg_2","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"It is sunny in Paris."}],"stop_reason":"end_turn","usage":{"input_tokens":20,"output_tokens":7}}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{
+		Provider: provider.Anthropic,
+		Endpoint: server.URL,
+		Token:    "secret",
+		Model:    "claude-sonnet-4",
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cities := []string{}
+	weatherAgent := agent.New("Weather", "You report the weather.", agent.WithClient(llm))
+	weatherAgent.Tools.Add(weatherTool(&cities))
+
+	response, err := weatherAgent.Run(context.Background(), agent.Messages{
+		{Role: "user", Content: "What's the weather in Paris?"},
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(cities).To(Equal([]string{"Paris"}))
+	assert.Expect(response.Messages[len(response.Messages)-1].Content).To(Equal("It is sunny in Paris."))
+
+	assert.Expect(requests).To(HaveLen(2))
+	assert.Expect(headers[0].Get("x-api-key")).To(Equal("secret"))
+	assert.Expect(headers[0].Get("anthropic-version")).NotTo(BeEmpty())
+	assert.Expect(headers[0].Get("Authorization")).To(BeEmpty())
+
+	assert.Expect(requests[0]["system"]).To(Equal("You report the weather."))
+	assert.Expect(requests[0]["max_tokens"]).To(BeNumerically(">", 0))
+
+	tool := requests[0]["tools"].([]any)[0].(map[string]any)
+	assert.Expect(tool).To(HaveKeyWithValue("name", "get_weather"))
+	assert.Expect(tool).To(HaveKey("input_schema"))
+
+	messages := requests[1]["messages"].([]any)
+	assert.Expect(messages).To(HaveLen(3))
+
+	assistant := messages[1].(map[string]any)
+	assert.Expect(assistant).To(HaveKeyWithValue("role", "assistant"))
+	assert.Expect(assistant["content"]).To(ContainElement(HaveKeyWithValue("input", map[string]any{"city": "Paris"})))
+
+	result := messages[2].(map[string]any)
+	assert.Expect(result).To(HaveKeyWithValue("role", "user"))
+	assert.Expect(result["content"]).To(ConsistOf(And(
+		HaveKeyWithValue("type", "tool_result"),
+		HaveKeyWithValue("tool_use_id", "toolu_1"),
+		HaveKeyWithValue("content", "sunny"),
+	)))
+}
+
+func TestAnthropicErrors(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{
+		Provider: provider.Anthropic,
+		Endpoint: server.URL + "/v1",
+		Model:    "claude-sonnet-4",
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = llm.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    llm.ModelName(),
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+
+	var apiError *openai.APIError
+	assert.Expect(err).To(BeAssignableToTypeOf(apiError))
+	assert.Expect(err.(*openai.APIError).HTTPStatusCode).To(Equal(529))
+	assert.Expect(err.Error()).To(ContainSubstring("Overloaded"))
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/usage"
+	openai "github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// meter records the token usage of a chat completion response against the
+// request context's usage tracker, attributed to model.
+func meter(request *http.Request, response *http.Response, model string) (*http.Response, error) {
+	ctx := request.Context()
+	if !isChatCompletion(request) || (usage.FromContext(ctx) == nil && !trace.SpanFromContext(ctx).IsRecording()) {
+		return response, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	var completion openai.ChatCompletionResponse
+
+	// Responses that cannot be decoded are left for the client to report
+	if json.Unmarshal(body, &completion) == nil {
+		tokens := usage.Tokens{
+			Requests:   1,
+			Prompt:     completion.Usage.PromptTokens,
+			Completion: completion.Usage.CompletionTokens,
+		}
+		if details := completion.Usage.PromptTokensDetails; details != nil {
+			tokens.Cached = details.CachedTokens
+		}
+
+		usage.Record(ctx, progress.Agent(ctx), model, tokens)
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", tokens.Prompt),
+			attribute.Int("gen_ai.usage.output_tokens", tokens.Completion),
+			attribute.Int("gen_ai.usage.cached_tokens", tokens.Cached),
+		)
+	}
+
+	return response, nil
+}
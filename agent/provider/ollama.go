@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/agent/agent/progress"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ollamaTransport adapts OpenAI chat completions to Ollama's /api/chat.
+type ollamaTransport struct {
+	endpoint string
+	next     http.RoundTripper
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openai.Tool   `json:"tools,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+type contextWindowKey struct{}
+
+// WithContextWindow returns a context whose requests to Ollama ask for a
+// context of window tokens. Ollama otherwise runs models with its default
+// context and silently truncates longer prompts.
+func WithContextWindow(ctx context.Context, window int) context.Context {
+	return context.WithValue(ctx, contextWindowKey{}, window)
+}
+
+// ollamaURL returns the native chat endpoint next to an optional /v1 suffix.
+func ollamaURL(endpoint string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/v1") + "/api/chat"
+}
+
+func (t *ollamaTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !isChatCompletion(request) {
+		return t.next.RoundTrip(request)
+	}
+
+	chat, err := readChatRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	native := toOllamaRequest(chat)
+	native.Stream = progress.Enabled(request.Context())
+
+	if window, ok := request.Context().Value(contextWindowKey{}).(int); ok && window > 0 {
+		native.Options["num_ctx"] = window
+	}
+
+	response, err := send(t.next, request, ollamaURL(t.endpoint), nil, native)
+	if err != nil {
+		return nil, err
+	}
+
+	if native.Stream && succeeded(response) {
+		defer func() { _ = response.Body.Close() }()
+
+		payload, err := readOllamaStream(request.Context(), response.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return jsonResponse(request, http.StatusOK, fromOllamaResponse(payload))
+	}
+
+	var payload ollamaResponse
+
+	errorResponse, err := decodeResponse(request, response, &payload, func(body []byte) string {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &failure)
+		return failure.Error
+	})
+	if errorResponse != nil || err != nil {
+		return errorResponse, err
+	}
+
+	return jsonResponse(request, http.StatusOK, fromOllamaResponse(payload))
+}
+
+func toOllamaRequest(chat chatRequest) ollamaRequest {
+	native := ollamaRequest{
+		Model:    chat.Model,
+		Messages: []ollamaMessage{},
+		Tools:    chat.Tools,
+		Options:  map[string]any{},
+	}
+
+	// Ollama identifies tool results by name rather than call ID
+	toolNames := map[string]string{}
+
+	for _, message := range chat.Messages {
+		converted := ollamaMessage{
+			Role:    message.Role,
+			Content: messageText(message),
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			toolNames[toolCall.ID] = toolCall.Function.Name
+
+			var call ollamaToolCall
+			call.Function.Name = toolCall.Function.Name
+			call.Function.Arguments = toolArguments(toolCall.Function.Arguments)
+			converted.ToolCalls = append(converted.ToolCalls, call)
+		}
+
+		if message.Role == openai.ChatMessageRoleTool {
+			converted.ToolName = toolNames[message.ToolCallID]
+		}
+
+		native.Messages = append(native.Messages, converted)
+	}
+
+	if format := chat.ResponseFormat; format != nil {
+		switch {
+		case format.JSONSchema != nil && len(format.JSONSchema.Schema) > 0:
+			native.Format = format.JSONSchema.Schema
+		case format.Type == string(openai.ChatCompletionResponseFormatTypeJSONObject):
+			native.Format = json.RawMessage(`"json"`)
+		}
+	}
+
+	if chat.Temperature != 0 {
+		native.Options["temperature"] = chat.Temperature
+	}
+
+	if maxTokens := max(chat.MaxTokens, chat.MaxCompletionTokens); maxTokens > 0 {
+		native.Options["num_predict"] = maxTokens
+	}
+
+	if len(chat.Stop) > 0 {
+		native.Options["stop"] = chat.Stop
+	}
+
+	return native
+}
+
+func fromOllamaResponse(payload ollamaResponse) openai.ChatCompletionResponse {
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: payload.Message.Content,
+	}
+
+	for index, toolCall := range payload.Message.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("call_%d", index),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      toolCall.Function.Name,
+				Arguments: string(toolArguments(string(toolCall.Function.Arguments))),
+			},
+		})
+	}
+
+	finishReason := openai.FinishReasonStop
+	switch {
+	case len(message.ToolCalls) > 0:
+		finishReason = openai.FinishReasonToolCalls
+	case payload.DoneReason == "length":
+		finishReason = openai.FinishReasonLength
+	}
+
+	return completion(
+		"ollama-"+payload.CreatedAt.Format("20060102150405.000000000"),
+		payload.Model,
+		payload.CreatedAt.Unix(),
+		message,
+		finishReason,
+		openai.Usage{
+			PromptTokens:     payload.PromptEvalCount,
+			CompletionTokens: payload.EvalCount,
+			TotalTokens:      payload.PromptEvalCount + payload.EvalCount,
+		},
+	)
+}
@@ -0,0 +1,130 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// weatherTool is a tool that records the city it was called with.
+func weatherTool(cities *[]string) agent.Tool {
+	return agent.Tool{
+		Name:        "get_weather",
+		Description: "Get the weather for a city.",
+		Parameters: &jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"city": {Type: jsonschema.String},
+			},
+			Required: []string{"city"},
+		},
+		Func: func(ctx context.Context, params map[string]any) (any, error) {
+			*cities = append(*cities, params["city"].(string))
+			return "sunny", nil
+		},
+	}
+}
+
+func TestOllamaToolCalling(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	requests := []map[string]any{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var request map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"model":"qwen3","created_at":"2025-01-01T00:00:00Z","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":5}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"model":"qwen3","created_at":"2025-01-01T00:00:01Z","message":{"role":"assistant","content":"It is sunny in Paris."},"done":true,"done_reason":"stop","prompt_eval_count":20,"eval_count":7}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{
+		Provider: provider.Ollama,
+		Endpoint: server.URL + "/v1",
+		Model:    "qwen3",
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	cities := []string{}
+	weatherAgent := agent.New("Weather", "You report the weather.", agent.WithClient(llm))
+	weatherAgent.Tools.Add(weatherTool(&cities))
+
+	ctx := provider.WithContextWindow(context.Background(), 40960)
+
+	response, err := weatherAgent.Run(ctx, agent.Messages{
+		{Role: "user", Content: "What's the weather in Paris?"},
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(cities).To(Equal([]string{"Paris"}))
+	assert.Expect(response.Messages[len(response.Messages)-1].Content).To(Equal("It is sunny in Paris."))
+
+	assert.Expect(requests).To(HaveLen(2))
+	assert.Expect(requests[0]["model"]).To(Equal("qwen3"))
+	assert.Expect(requests[0]["stream"]).To(BeFalse())
+	assert.Expect(requests[0]["tools"]).To(HaveLen(1))
+	assert.Expect(requests[0]["options"]).To(HaveKeyWithValue("num_ctx", BeEquivalentTo(40960)))
+
+	messages := requests[1]["messages"].([]any)
+	assert.Expect(messages).To(HaveLen(4))
+
+	toolCall := messages[2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	assert.Expect(toolCall["function"]).To(HaveKeyWithValue("arguments", map[string]any{"city": "Paris"}))
+
+	toolResult := messages[3].(map[string]any)
+	assert.Expect(toolResult).To(HaveKeyWithValue("role", "tool"))
+	assert.Expect(toolResult).To(HaveKeyWithValue("tool_name", "get_weather"))
+	assert.Expect(toolResult).To(HaveKeyWithValue("content", "sunny"))
+}
+
+func TestOllamaErrors(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"model \"missing\" not found, try pulling it first"}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{
+		Provider: provider.Ollama,
+		Endpoint: server.URL,
+		Model:    "missing",
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = llm.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    llm.ModelName(),
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+
+	var apiError *openai.APIError
+	assert.Expect(err).To(BeAssignableToTypeOf(apiError))
+	assert.Expect(err.(*openai.APIError).HTTPStatusCode).To(Equal(http.StatusNotFound))
+	assert.Expect(err.Error()).To(ContainSubstring("not found, try pulling it first"))
+}
+
+func TestUnknownProvider(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	_, err := provider.New(provider.Config{Provider: "bedrock"})
+	assert.Expect(err).To(MatchError(ContainSubstring(`unknown provider "bedrock"`)))
+}
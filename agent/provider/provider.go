@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jtarchie/outrageous/client"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Supported providers.
+const (
+	OpenAI    = "openai"
+	Ollama    = "ollama"
+	Anthropic = "anthropic"
+)
+
+// Names lists the supported providers.
+var Names = []string{OpenAI, Ollama, Anthropic}
+
+// Config describes how to reach a model.
+type Config struct {
+	Provider string
+	Endpoint string
+	Token    string
+	Model    string
+	// Transport sends the HTTP requests, defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// New creates a client for the configured provider. The agent only speaks
+// the OpenAI chat completions protocol, so native providers are adapted by
+// translating requests and responses in the HTTP transport.
+func New(cfg Config) (*client.Client, error) {
+	transport, err := NewTransport(cfg.Provider, cfg.Endpoint, cfg.Token, cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	llm := client.New(cfg.Endpoint, cfg.Token, cfg.Model)
+
+	config := openai.DefaultConfig(cfg.Token)
+	config.BaseURL = cfg.Endpoint
+	config.HTTPClient = &http.Client{Transport: transport}
+	llm.Client = openai.NewClientWithConfig(config)
+
+	return llm, nil
+}
+
+// NewTransport returns a transport that speaks the provider's native API for
+// chat completion requests sent by an OpenAI client.
+func NewTransport(provider, endpoint, token string, next http.RoundTripper) (http.RoundTripper, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	switch provider {
+	case OpenAI, "":
+		return &openaiTransport{next: next}, nil
+	case Ollama:
+		return &ollamaTransport{endpoint: endpoint, next: next}, nil
+	case Anthropic:
+		return &anthropicTransport{endpoint: endpoint, token: token, next: next}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q, expected one of %s", provider, strings.Join(Names, ", "))
+	}
+}
+
+// chatRequest is the subset of an OpenAI chat completion request the native
+// adapters translate. Response format schemas are kept raw.
+type chatRequest struct {
+	Model               string                         `json:"model"`
+	Messages            []openai.ChatCompletionMessage `json:"messages"`
+	Tools               []openai.Tool                  `json:"tools,omitempty"`
+	MaxTokens           int                            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                            `json:"max_completion_tokens,omitempty"`
+	Temperature         float32                        `json:"temperature,omitempty"`
+	Stop                []string                       `json:"stop,omitempty"`
+	Stream              bool                           `json:"stream,omitempty"`
+	ResponseFormat      *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema,omitempty"`
+	} `json:"response_format,omitempty"`
+}
+
+// isChatCompletion reports whether request is an OpenAI chat completion call.
+func isChatCompletion(request *http.Request) bool {
+	return request.Method == http.MethodPost && strings.HasSuffix(request.URL.Path, "/chat/completions")
+}
+
+// readChatRequest decodes the OpenAI request body.
+func readChatRequest(request *http.Request) (chatRequest, error) {
+	var chat chatRequest
+
+	defer func() { _ = request.Body.Close() }()
+
+	err := json.NewDecoder(request.Body).Decode(&chat)
+	if err != nil {
+		return chat, fmt.Errorf("failed to decode chat completion request: %w", err)
+	}
+
+	if chat.Stream {
+		return chat, fmt.Errorf("streaming chat completions are not supported by this provider")
+	}
+
+	return chat, nil
+}
+
+// send posts payload to url with the original request's context.
+func send(next http.RoundTripper, original *http.Request, url string, headers map[string]string, payload any) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(original.Context(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	return next.RoundTrip(request)
+}
+
+// succeeded reports whether response has a 2xx status.
+func succeeded(response *http.Response) bool {
+	return response.StatusCode >= 200 && response.StatusCode < 300
+}
+
+// decodeResponse reads a native JSON response into payload. Non-2xx
+// responses are returned as OpenAI style errors, preserving the status code,
+// using message to extract the provider's error message.
+func decodeResponse(original *http.Request, response *http.Response, payload any, message func([]byte) string) (*http.Response, error) {
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if !succeeded(response) {
+		text := message(body)
+		if text == "" {
+			text = strings.TrimSpace(string(body))
+		}
+
+		return jsonResponse(original, response.StatusCode, map[string]any{
+			"error": map[string]any{
+				"message": text,
+				"type":    http.StatusText(response.StatusCode),
+			},
+		})
+	}
+
+	err = json.Unmarshal(body, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil, nil
+}
+
+// jsonResponse builds an HTTP response with payload encoded as JSON.
+func jsonResponse(request *http.Request, status int, payload any) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+// completion wraps a single assistant message as an OpenAI chat completion.
+func completion(id, model string, created int64, message openai.ChatCompletionMessage, finishReason openai.FinishReason, usage openai.Usage) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: finishReason,
+		}},
+		Usage: usage,
+	}
+}
+
+// toolArguments returns the tool call arguments as a JSON object.
+func toolArguments(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+
+	return json.RawMessage(arguments)
+}
+
+// messageText returns the text of a message, joining multi-part content.
+func messageText(message openai.ChatCompletionMessage) string {
+	if len(message.MultiContent) == 0 {
+		return message.Content
+	}
+
+	parts := []string{}
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
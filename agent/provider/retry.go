@@ -0,0 +1,353 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/telemetry"
+	"github.com/jtarchie/agent/agent/usage"
+	"github.com/jtarchie/outrageous/client"
+	openai "github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrAllProvidersFailed is returned when every provider in a chain failed.
+	ErrAllProvidersFailed = errors.New("all providers failed")
+	// ErrRequestRejected is returned when a provider rejects a request as
+	// invalid or unauthorized, which falling back would not fix, and could
+	// send the request to a paid provider unnoticed.
+	ErrRequestRejected = errors.New("request rejected")
+)
+
+// RetryPolicy controls how failed requests to a single provider are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of requests per provider, at least one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubling each retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration
+	// Timeout limits each attempt, zero means no limit.
+	Timeout time.Duration
+	// StatusCodes are the HTTP statuses that are retried. Network errors and
+	// timeouts are always retried.
+	StatusCodes []int
+}
+
+// backoff returns the wait before retrying after the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff
+	for range attempt - 1 {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return wait
+}
+
+// NewChain creates a client that sends each request to the providers in
+// order, retrying each according to policy before falling back to the next.
+// The first config is the primary, and its model is reported by the client.
+func NewChain(configs []Config, policy RetryPolicy) (*client.Client, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one provider is required")
+	}
+
+	chain := &chainTransport{
+		policy:  policy,
+		base:    strings.TrimSuffix(configs[0].Endpoint, "/"),
+		targets: make([]target, 0, len(configs)),
+	}
+
+	for _, cfg := range configs {
+		if cfg.Provider == "" {
+			cfg.Provider = OpenAI
+		}
+
+		transport, err := NewTransport(cfg.Provider, cfg.Endpoint, cfg.Token, cfg.Transport)
+		if err != nil {
+			return nil, err
+		}
+
+		chain.targets = append(chain.targets, target{Config: cfg, transport: transport})
+	}
+
+	primary := configs[0]
+	llm := client.New(primary.Endpoint, primary.Token, primary.Model)
+
+	config := openai.DefaultConfig(primary.Token)
+	config.BaseURL = primary.Endpoint
+	config.HTTPClient = &http.Client{Transport: chain}
+	llm.Client = openai.NewClientWithConfig(config)
+
+	return llm, nil
+}
+
+type target struct {
+	Config
+	transport http.RoundTripper
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("%s %s at %s", t.Provider, t.Model, t.Endpoint)
+}
+
+// chainTransport retries and falls back between providers. Requests are
+// built by the client for the primary endpoint and rewritten per target.
+type chainTransport struct {
+	targets []target
+	policy  RetryPolicy
+	base    string
+}
+
+func (c *chainTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, span := telemetry.Start(request.Context(), "model.request",
+		attribute.String("gen_ai.request.model", c.targets[0].Model),
+	)
+
+	response, err := c.roundTrip(request.WithContext(ctx))
+	telemetry.End(span, err)
+
+	return response, err
+}
+
+func (c *chainTransport) roundTrip(request *http.Request) (*http.Response, error) {
+	// Send nothing new once the run is stopping or over budget
+	err := interrupt.Check(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	err = usage.Check(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if request.Body != nil {
+		body, err = io.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request: %w", err)
+		}
+	}
+
+	ctx := request.Context()
+	attempts := max(c.policy.MaxAttempts, 1)
+	failures := []string{}
+
+	for index, target := range c.targets {
+		if index > 0 {
+			slog.Warn("provider.fallback", "provider", target.Provider, "endpoint", target.Endpoint, "model", target.Model)
+		}
+
+		var (
+			failure  string
+			rejected bool
+		)
+
+		for attempt := 1; attempt <= attempts; attempt++ {
+			slog.Debug("provider.attempt", "provider", target.Provider, "endpoint", target.Endpoint, "model", target.Model, "attempt", attempt, "max_attempts", attempts)
+
+			response, err := c.attempt(request, body, target)
+			if err == nil && response.StatusCode < 300 {
+				trace.SpanFromContext(ctx).SetAttributes(
+					attribute.String("gen_ai.system", target.Provider),
+					attribute.String("gen_ai.response.model", target.Model),
+					attribute.String("server.address", target.Endpoint),
+					attribute.Int("attempt", attempt),
+					attribute.Int("fallback", index),
+				)
+				return meter(request, response, target.Model)
+			}
+
+			if ctx.Err() != nil {
+				if response != nil {
+					_ = response.Body.Close()
+				}
+				return nil, ctx.Err()
+			}
+
+			retryable := true
+			var wait time.Duration
+
+			if err != nil {
+				failure = err.Error()
+			} else {
+				failure = describeResponse(response)
+				retryable = slices.Contains(c.policy.StatusCodes, response.StatusCode)
+				rejected = !retryable && isRejection(response.StatusCode)
+				wait = retryAfter(response)
+				if c.policy.MaxBackoff > 0 {
+					wait = min(wait, c.policy.MaxBackoff)
+				}
+			}
+
+			slog.Warn("provider.attempt_failed", "provider", target.Provider, "endpoint", target.Endpoint, "model", target.Model, "attempt", attempt, "max_attempts", attempts, "retryable", retryable, "error", failure)
+			trace.SpanFromContext(ctx).AddEvent("attempt_failed", trace.WithAttributes(
+				attribute.String("gen_ai.system", target.Provider),
+				attribute.String("gen_ai.request.model", target.Model),
+				attribute.Int("attempt", attempt),
+				attribute.String("error", failure),
+			))
+
+			if !retryable || attempt == attempts {
+				break
+			}
+
+			err = sleep(ctx, max(wait, c.policy.backoff(attempt)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if rejected {
+			return nil, fmt.Errorf("%w by %s: %s", ErrRequestRejected, target, failure)
+		}
+
+		failures = append(failures, fmt.Sprintf("%s (%s)", target, failure))
+	}
+
+	return nil, fmt.Errorf("%w, tried: %s", ErrAllProvidersFailed, strings.Join(failures, "; "))
+}
+
+// isRejection reports whether status means the request itself is invalid or
+// unauthorized, rather than the provider being unable to serve it. Other
+// client errors, such as a 404 for a model a local server has not pulled,
+// still fall back.
+func isRejection(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
+
+// attempt sends the request to target with its endpoint, token and model.
+func (c *chainTransport) attempt(original *http.Request, body []byte, target target) (*http.Response, error) {
+	ctx := original.Context()
+	cancel := context.CancelFunc(func() {})
+	if c.policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.policy.Timeout)
+	}
+
+	request := original.Clone(ctx)
+
+	url := strings.TrimSuffix(target.Endpoint, "/") + strings.TrimPrefix(original.URL.String(), c.base)
+	parsed, err := request.URL.Parse(url)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to parse endpoint %s: %w", target.Endpoint, err)
+	}
+	request.URL = parsed
+	request.Host = parsed.Host
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	request.Header.Del("Authorization")
+	if target.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+target.Token)
+	}
+
+	if body != nil {
+		payload := withModel(body, target.Model)
+		request.Body = io.NopCloser(bytes.NewReader(payload))
+		request.ContentLength = int64(len(payload))
+		request.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(payload)), nil
+		}
+	}
+
+	response, err := target.transport.RoundTrip(request)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The attempt's timeout covers reading the body, so it ends on close
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+
+	return response, nil
+}
+
+// withModel replaces the model in a JSON request body.
+func withModel(body []byte, model string) []byte {
+	var payload map[string]json.RawMessage
+
+	err := json.Unmarshal(body, &payload)
+	if err != nil || payload["model"] == nil || model == "" {
+		return body
+	}
+
+	payload["model"], _ = json.Marshal(model)
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+
+	return rewritten
+}
+
+// describeResponse summarizes a failed response and closes its body.
+func describeResponse(response *http.Response) string {
+	defer func() { _ = response.Body.Close() }()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return fmt.Sprintf("status %d: %s", response.StatusCode, message)
+	}
+
+	return fmt.Sprintf("status %d", response.StatusCode)
+}
+
+// retryAfter returns the wait requested by a Retry-After header in seconds.
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// sleep waits for duration or until ctx is done.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,215 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/usage"
+	. "github.com/onsi/gomega"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var testPolicy = provider.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	StatusCodes:    []int{429, 500, 503},
+}
+
+func chat(model string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	}
+}
+
+// completionServer answers chat completions with the requested model and
+// records the authorization header of each request.
+func completionServer(calls *int32, authorizations *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		*authorizations = append(*authorizations, r.Header.Get("Authorization"))
+
+		var request map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "ok",
+			"model":   request["model"],
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "hello from " + request["model"].(string)}}},
+		})
+	}))
+}
+
+func TestChainRetriesRetryableStatuses(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"ok","choices":[{"message":{"role":"assistant","content":"hello"}}]}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.NewChain([]provider.Config{{Endpoint: server.URL + "/v1", Model: "local"}}, testPolicy)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, err := llm.CreateChatCompletion(context.Background(), chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(response.Choices[0].Message.Content).To(Equal("hello"))
+	assert.Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(3))
+}
+
+func TestChainFallsBack(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"boom"}}`))
+	}))
+	defer primary.Close()
+
+	var fallbackCalls int32
+	authorizations := []string{}
+	fallback := completionServer(&fallbackCalls, &authorizations)
+	defer fallback.Close()
+
+	llm, err := provider.NewChain([]provider.Config{
+		{Endpoint: primary.URL + "/v1", Model: "qwen3", Token: "local"},
+		{Endpoint: fallback.URL + "/api/v1", Model: "qwen3-235b", Token: "remote"},
+	}, testPolicy)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(llm.ModelName()).To(Equal("qwen3"))
+
+	response, err := llm.CreateChatCompletion(context.Background(), chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(response.Choices[0].Message.Content).To(Equal("hello from qwen3-235b"))
+	assert.Expect(atomic.LoadInt32(&primaryCalls)).To(BeEquivalentTo(3))
+	assert.Expect(authorizations).To(Equal([]string{"Bearer remote"}))
+}
+
+func TestChainDoesNotRetryClientErrors(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"bad token"}}`))
+	}))
+	defer primary.Close()
+
+	llm, err := provider.NewChain([]provider.Config{
+		{Endpoint: primary.URL + "/v1", Model: "qwen3"},
+		{Endpoint: "http://127.0.0.1:1/v1", Model: "unreachable"},
+	}, testPolicy)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// Nor fall back, since another provider would not fix the request
+	_, err = llm.CreateChatCompletion(context.Background(), chat(llm.ModelName()))
+	assert.Expect(errors.Is(err, provider.ErrRequestRejected)).To(BeTrue())
+	assert.Expect(err.Error()).To(ContainSubstring("by openai qwen3 at " + primary.URL + "/v1: status 401: "))
+	assert.Expect(err.Error()).To(ContainSubstring("bad token"))
+	assert.Expect(err.Error()).NotTo(ContainSubstring("unreachable"))
+	assert.Expect(atomic.LoadInt32(&primaryCalls)).To(BeEquivalentTo(1))
+}
+
+func TestChainFallsBackWhenModelIsMissing(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"message":"model \"qwen3\" not found, try pulling it first"}}`))
+	}))
+	defer primary.Close()
+
+	var fallbackCalls int32
+	authorizations := []string{}
+	fallback := completionServer(&fallbackCalls, &authorizations)
+	defer fallback.Close()
+
+	llm, err := provider.NewChain([]provider.Config{
+		{Endpoint: primary.URL + "/v1", Model: "qwen3"},
+		{Endpoint: fallback.URL + "/api/v1", Model: "qwen3-235b", Token: "remote"},
+	}, testPolicy)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, err := llm.CreateChatCompletion(context.Background(), chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(response.Choices[0].Message.Content).To(Equal("hello from qwen3-235b"))
+	assert.Expect(atomic.LoadInt32(&primaryCalls)).To(BeEquivalentTo(1))
+}
+
+func TestChainStopsWhenCancelled(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	llm, err := provider.NewChain([]provider.Config{{Endpoint: server.URL + "/v1", Model: "local"}}, provider.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Hour,
+		StatusCodes:    []int{503},
+	})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = llm.CreateChatCompletion(ctx, chat(llm.ModelName()))
+	assert.Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+}
+
+func TestChainRecordsUsage(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"ok","model":"served-name","choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120,"prompt_tokens_details":{"cached_tokens":40}}}`))
+	}))
+	defer server.Close()
+
+	llm, err := provider.NewChain([]provider.Config{{Endpoint: server.URL + "/v1", Model: "paid"}}, testPolicy)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	tracker := usage.NewTracker(map[string]usage.Price{"paid": {Input: 1, Output: 2}}, usage.Limits{})
+	ctx := progress.WithAgent(usage.WithTracker(context.Background(), tracker), "executing")
+
+	response, err := llm.CreateChatCompletion(ctx, chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(response.Choices[0].Message.Content).To(Equal("hello"))
+
+	summary := tracker.Summary()
+	assert.Expect(summary.Session).To(Equal(usage.Tokens{
+		Requests:   1,
+		Prompt:     100,
+		Completion: 20,
+		Cached:     40,
+		Cost:       140.0 / 1_000_000,
+	}))
+	assert.Expect(summary.Agents).To(HaveKey("executing"))
+	assert.Expect(summary.Models).To(HaveKey("paid"))
+}
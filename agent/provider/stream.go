@@ -0,0 +1,330 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jtarchie/agent/agent/progress"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// The agent requests whole completions. When progress is being reported,
+// the transports stream the completion from the provider instead, emitting
+// tokens as they arrive, and hand the assembled completion to the agent.
+
+// maxStreamLine bounds a single line of a streamed response.
+const maxStreamLine = 4 * 1024 * 1024
+
+// readLines calls handle with each non-empty line of body.
+func readLines(body io.Reader, handle func(line []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		err := handle(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	return nil
+}
+
+// readEvents calls handle with the data of each server-sent event.
+func readEvents(body io.Reader, handle func(data []byte) error) error {
+	return readLines(body, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+
+		return handle(bytes.TrimSpace(data))
+	})
+}
+
+// openaiTransport streams OpenAI compatible chat completions.
+type openaiTransport struct {
+	next http.RoundTripper
+}
+
+func (t *openaiTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !isChatCompletion(request) || !progress.Enabled(request.Context()) || request.Body == nil {
+		return t.next.RoundTrip(request)
+	}
+
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+
+	var payload map[string]json.RawMessage
+
+	err = json.Unmarshal(body, &payload)
+	if err != nil || string(payload["stream"]) == "true" {
+		// Leave requests that already stream, or that cannot be parsed, alone
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		return t.next.RoundTrip(request)
+	}
+
+	payload["stream"] = json.RawMessage("true")
+	payload["stream_options"] = json.RawMessage(`{"include_usage":true}`)
+
+	body, err = json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	streaming := request.Clone(request.Context())
+	streaming.Body = io.NopCloser(bytes.NewReader(body))
+	streaming.ContentLength = int64(len(body))
+	streaming.Header.Set("Accept", "text/event-stream")
+
+	response, err := t.next.RoundTrip(streaming)
+	if err != nil {
+		return nil, err
+	}
+
+	if !succeeded(response) {
+		return response, nil
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	completion, err := readOpenAIStream(request.Context(), response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonResponse(request, http.StatusOK, completion)
+}
+
+// readOpenAIStream assembles streamed chunks into a single completion.
+func readOpenAIStream(ctx context.Context, body io.Reader) (openai.ChatCompletionResponse, error) {
+	completion := openai.ChatCompletionResponse{Object: "chat.completion"}
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	finishReason := openai.FinishReasonStop
+
+	var content strings.Builder
+
+	err := readEvents(body, func(data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+
+		var chunk openai.ChatCompletionStreamResponse
+
+		err := json.Unmarshal(data, &chunk)
+		if err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+
+		completion.ID = chunk.ID
+		completion.Model = chunk.Model
+		completion.Created = chunk.Created
+
+		if chunk.Usage != nil {
+			completion.Usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				progress.Emit(ctx, progress.Event{Kind: progress.Token, Text: choice.Delta.Content})
+			}
+
+			for _, delta := range choice.Delta.ToolCalls {
+				message.ToolCalls = mergeToolCall(message.ToolCalls, delta)
+			}
+
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return completion, err
+	}
+
+	message.Content = content.String()
+	for index := range message.ToolCalls {
+		message.ToolCalls[index].Index = nil
+	}
+
+	completion.Choices = []openai.ChatCompletionChoice{{
+		Message:      message,
+		FinishReason: finishReason,
+	}}
+
+	return completion, nil
+}
+
+// mergeToolCall adds a streamed tool call fragment to the calls so far.
+// Fragments of the same call share an index, or omit it after the first.
+func mergeToolCall(calls []openai.ToolCall, delta openai.ToolCall) []openai.ToolCall {
+	position := -1
+
+	for index, call := range calls {
+		if delta.Index != nil && call.Index != nil && *call.Index == *delta.Index {
+			position = index
+		}
+	}
+
+	if position == -1 && delta.Index == nil && delta.ID == "" && len(calls) > 0 {
+		position = len(calls) - 1
+	}
+
+	if position == -1 {
+		if delta.Type == "" {
+			delta.Type = openai.ToolTypeFunction
+		}
+		return append(calls, delta)
+	}
+
+	call := &calls[position]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Function.Name != "" {
+		call.Function.Name += delta.Function.Name
+	}
+	call.Function.Arguments += delta.Function.Arguments
+
+	return calls
+}
+
+// readOllamaStream assembles Ollama's newline-delimited chunks.
+func readOllamaStream(ctx context.Context, body io.Reader) (ollamaResponse, error) {
+	var payload ollamaResponse
+
+	var content strings.Builder
+	toolCalls := []ollamaToolCall{}
+
+	err := readLines(body, func(line []byte) error {
+		var chunk struct {
+			ollamaResponse
+			Error string `json:"error"`
+		}
+
+		err := json.Unmarshal(line, &chunk)
+		if err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+
+		if chunk.Error != "" {
+			return fmt.Errorf("stream failed: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			progress.Emit(ctx, progress.Event{Kind: progress.Token, Text: chunk.Message.Content})
+		}
+
+		toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
+		payload = chunk.ollamaResponse
+
+		return nil
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	payload.Message.Content = content.String()
+	payload.Message.ToolCalls = toolCalls
+
+	return payload, nil
+}
+
+// readAnthropicStream assembles Messages API stream events.
+func readAnthropicStream(ctx context.Context, body io.Reader) (anthropicResponse, error) {
+	var payload anthropicResponse
+
+	inputs := map[int]*strings.Builder{}
+
+	err := readEvents(body, func(data []byte) error {
+		var event struct {
+			Type         string            `json:"type"`
+			Index        int               `json:"index"`
+			Message      anthropicResponse `json:"message"`
+			ContentBlock anthropicBlock    `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+
+		err := json.Unmarshal(data, &event)
+		if err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			payload = event.Message
+			payload.Content = []anthropicBlock{}
+		case "content_block_start":
+			for len(payload.Content) <= event.Index {
+				payload.Content = append(payload.Content, anthropicBlock{})
+			}
+			block := event.ContentBlock
+			block.Input = nil
+			payload.Content[event.Index] = block
+			inputs[event.Index] = &strings.Builder{}
+		case "content_block_delta":
+			if event.Index >= len(payload.Content) {
+				return fmt.Errorf("stream delta for unknown content block %d", event.Index)
+			}
+
+			switch event.Delta.Type {
+			case "text_delta":
+				payload.Content[event.Index].Text += event.Delta.Text
+				progress.Emit(ctx, progress.Event{Kind: progress.Token, Text: event.Delta.Text})
+			case "input_json_delta":
+				inputs[event.Index].WriteString(event.Delta.PartialJSON)
+			}
+		case "message_delta":
+			payload.StopReason = event.Delta.StopReason
+			payload.Usage.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("stream failed: %s", event.Error.Message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return payload, err
+	}
+
+	for index, input := range inputs {
+		if payload.Content[index].Type == "tool_use" {
+			payload.Content[index].Input = toolArguments(input.String())
+		}
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,159 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/provider"
+	. "github.com/onsi/gomega"
+)
+
+// recorder collects streamed tokens.
+type recorder struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (r *recorder) Report(event progress.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Kind == progress.Token {
+		r.tokens = append(r.tokens, event.Text)
+	}
+}
+
+func streamingServer(path, contentType string, lines []string, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, path) {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, string(body))
+
+		w.Header().Set("Content-Type", contentType)
+		for _, line := range lines {
+			_, _ = fmt.Fprintln(w, line)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestStreamingOpenAI(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	requests := []string{}
+	server := streamingServer("/chat/completions", "text/event-stream", []string{
+		`data: {"id":"1","model":"qwen3","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		``,
+		`data: {"id":"1","model":"qwen3","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		``,
+		`data: {"id":"1","model":"qwen3","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		``,
+		`data: {"id":"1","model":"qwen3","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		``,
+		`data: {"id":"1","model":"qwen3","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		``,
+		`data: {"id":"1","model":"qwen3","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":4,"total_tokens":16}}`,
+		``,
+		`data: [DONE]`,
+	}, &requests)
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{Endpoint: server.URL + "/v1", Model: "qwen3"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	reporter := &recorder{}
+	ctx := progress.WithReporter(context.Background(), reporter)
+
+	response, err := llm.CreateChatCompletion(ctx, chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(requests[0]).To(ContainSubstring(`"stream":true`))
+	assert.Expect(reporter.tokens).To(Equal([]string{"Hel", "lo"}))
+
+	message := response.Choices[0].Message
+	assert.Expect(message.Content).To(Equal("Hello"))
+	assert.Expect(message.ToolCalls).To(HaveLen(1))
+	assert.Expect(message.ToolCalls[0].ID).To(Equal("call_1"))
+	assert.Expect(message.ToolCalls[0].Function.Name).To(Equal("get_weather"))
+	assert.Expect(message.ToolCalls[0].Function.Arguments).To(Equal(`{"city":"Paris"}`))
+	assert.Expect(response.Usage.TotalTokens).To(Equal(16))
+}
+
+func TestStreamingOllama(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	requests := []string{}
+	server := streamingServer("/api/chat", "application/x-ndjson", []string{
+		`{"model":"qwen3","created_at":"2025-01-01T00:00:00Z","message":{"role":"assistant","content":"Sun"},"done":false}`,
+		`{"model":"qwen3","created_at":"2025-01-01T00:00:00Z","message":{"role":"assistant","content":"ny"},"done":false}`,
+		`{"model":"qwen3","created_at":"2025-01-01T00:00:01Z","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":2}`,
+	}, &requests)
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{Provider: provider.Ollama, Endpoint: server.URL, Model: "qwen3"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	reporter := &recorder{}
+	ctx := progress.WithReporter(context.Background(), reporter)
+
+	response, err := llm.CreateChatCompletion(ctx, chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(requests[0]).To(ContainSubstring(`"stream":true`))
+	assert.Expect(reporter.tokens).To(Equal([]string{"Sun", "ny"}))
+	assert.Expect(response.Choices[0].Message.Content).To(Equal("Sunny"))
+	assert.Expect(response.Usage.TotalTokens).To(Equal(12))
+}
+
+func TestStreamingAnthropic(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	requests := []string{}
+	server := streamingServer("/v1/messages", "text/event-stream", []string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking"}}`,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\": \"Pa"}}`,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"ris\"}"}}`,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+	}, &requests)
+	defer server.Close()
+
+	llm, err := provider.New(provider.Config{Provider: provider.Anthropic, Endpoint: server.URL, Model: "claude-sonnet-4"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	reporter := &recorder{}
+	ctx := progress.WithReporter(context.Background(), reporter)
+
+	response, err := llm.CreateChatCompletion(ctx, chat(llm.ModelName()))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(requests[0]).To(ContainSubstring(`"stream":true`))
+	assert.Expect(reporter.tokens).To(Equal([]string{"Checking"}))
+
+	message := response.Choices[0].Message
+	assert.Expect(message.Content).To(Equal("Checking"))
+	assert.Expect(message.ToolCalls).To(HaveLen(1))
+	assert.Expect(message.ToolCalls[0].ID).To(Equal("toolu_1"))
+	assert.Expect(message.ToolCalls[0].Function.Arguments).To(Equal(`{"city": "Paris"}`))
+	assert.Expect(response.Usage.PromptTokens).To(Equal(10))
+	assert.Expect(response.Usage.CompletionTokens).To(Equal(15))
+}
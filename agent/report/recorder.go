@@ -0,0 +1,151 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jtarchie/agent/agent/verify"
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// Command is a command run by the executing agent.
+type Command struct {
+	Tool     string `json:"tool"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Recorder collects the commands and verification results of a run. It is
+// safe for concurrent use.
+type Recorder struct {
+	mu           sync.Mutex
+	commands     []Command
+	verification []verify.Report
+}
+
+// NewRecorder creates an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		commands:     []Command{},
+		verification: []verify.Report{},
+	}
+}
+
+// Commands returns the recorded commands in the order they were run.
+func (r *Recorder) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.commands)
+}
+
+// Verification returns the recorded verification rounds in order.
+func (r *Recorder) Verification() []verify.Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.verification)
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context whose commands and verification results are
+// collected by recorder.
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, recorder)
+}
+
+// FromContext returns the context's recorder, or nil.
+func FromContext(ctx context.Context) *Recorder {
+	recorder, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return recorder
+}
+
+// Verified adds a verification round to the context's recorder.
+func Verified(ctx context.Context, report verify.Report) {
+	recorder := FromContext(ctx)
+	if recorder == nil {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.verification = append(recorder.verification, report)
+}
+
+// Track wraps tools so commands they run, identified by a command parameter
+// or a command in the result, are added to the recorder in the call's context with their exit code.
+func Track(tools []agent.Tool) []agent.Tool {
+	tracked := make([]agent.Tool, 0, len(tools))
+
+	for _, tool := range tools {
+		next := tool.Func
+		name := tool.Name
+
+		tool.Func = func(ctx context.Context, params map[string]any) (any, error) {
+			value, err := next(ctx, params)
+
+			recorder := FromContext(ctx)
+			line, ok := commandLine(params, value)
+			if recorder == nil || !ok {
+				return value, err
+			}
+
+			command := Command{
+				Tool:     name,
+				Command:  line,
+				ExitCode: -1,
+			}
+
+			if result, ok := value.(map[string]any); ok {
+				if exitCode, ok := result["exit_code"].(int); ok {
+					command.ExitCode = exitCode
+				}
+			}
+
+			if err != nil {
+				command.Error = err.Error()
+			}
+
+			recorder.mu.Lock()
+			recorder.commands = append(recorder.commands, command)
+			recorder.mu.Unlock()
+
+			return value, err
+		}
+
+		tracked = append(tracked, tool)
+	}
+
+	return tracked
+}
+
+// commandLine returns the command a tool was asked to run, or, for tools
+// that render their command from other parameters, the command it ran.
+func commandLine(params map[string]any, value any) (string, bool) {
+	if args, ok := params["command"].([]any); ok {
+		return joinArgs(args), true
+	}
+
+	if result, ok := value.(map[string]any); ok {
+		if args, ok := result["command"].([]string); ok {
+			return strings.Join(args, " "), true
+		}
+	}
+
+	return "", false
+}
+
+func joinArgs(args []any) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,156 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/agent/agent/history"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/limits"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/review"
+	"github.com/jtarchie/agent/agent/usage"
+	"github.com/jtarchie/agent/agent/verify"
+)
+
+// ErrNoChanges is returned when a run finished without modifying any file.
+var ErrNoChanges = errors.New("no files were changed")
+
+// Outcome is how a run ended.
+type Outcome string
+
+const (
+	Success            Outcome = "success"
+	NoChanges          Outcome = "no_changes"
+	VerificationFailed Outcome = "verification_failed"
+	LimitExceeded      Outcome = "limit_exceeded"
+	ProviderError      Outcome = "provider_error"
+	Interrupted        Outcome = "interrupted"
+	Failed             Outcome = "error"
+)
+
+// exitCodes are the process exit codes of each outcome, so CI pipelines can
+// branch on them.
+var exitCodes = map[Outcome]int{
+	Success:            0,
+	Failed:             1,
+	NoChanges:          2,
+	VerificationFailed: 3,
+	LimitExceeded:      4,
+	ProviderError:      5,
+	Interrupted:        130,
+}
+
+// ExitCode returns the process exit code of the outcome.
+func (o Outcome) ExitCode() int {
+	code, ok := exitCodes[o]
+	if !ok {
+		return exitCodes[Failed]
+	}
+
+	return code
+}
+
+// Classify determines the outcome of a run from the error it ended with.
+func Classify(err error) Outcome {
+	switch {
+	case err == nil:
+		return Success
+	case errors.Is(err, ErrNoChanges):
+		return NoChanges
+	case errors.Is(err, limits.ErrExceeded), errors.Is(err, usage.ErrBudgetExceeded):
+		return LimitExceeded
+	case errors.Is(err, interrupt.ErrInterrupted), errors.Is(err, context.Canceled):
+		return Interrupted
+	case errors.Is(err, verify.ErrFailed):
+		return VerificationFailed
+	case errors.Is(err, provider.ErrAllProvidersFailed), errors.Is(err, provider.ErrRequestRejected):
+		return ProviderError
+	default:
+		return Failed
+	}
+}
+
+// Error carries the exit code of a failed run's outcome to the process.
+type Error struct {
+	Outcome Outcome
+	Err     error
+}
+
+// Exit wraps err with the exit code of its outcome, or returns nil.
+func Exit(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Outcome: Classify(err), Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is the process exit code for the error's outcome.
+func (e *Error) ExitCode() int {
+	return e.Outcome.ExitCode()
+}
+
+// Report is the machine-readable summary of a run.
+type Report struct {
+	SessionID  string            `json:"session_id"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Outcome    Outcome           `json:"outcome"`
+	ExitCode   int               `json:"exit_code"`
+	Reason     string            `json:"reason,omitempty"`
+	Plan       string            `json:"plan,omitempty"`
+	Critiques  []review.Critique `json:"critiques,omitempty"`
+	Files      []history.Change  `json:"files"`
+	Commands   []Command         `json:"commands"`
+	// Verification holds the report of each verification round in order.
+	Verification []verify.Report `json:"verification"`
+	Usage        usage.Summary   `json:"usage"`
+}
+
+// Finish stamps the end of the run with its outcome and the termination
+// reason, which is the error it ended with.
+func (r *Report) Finish(err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.Outcome = Classify(err)
+	r.ExitCode = r.Outcome.ExitCode()
+
+	if err != nil {
+		r.Reason = err.Error()
+	}
+}
+
+// Write saves the report as JSON to path.
+func (r *Report) Write(path string) error {
+	contents, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	err = os.WriteFile(path, append(contents, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package report_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/limits"
+	"github.com/jtarchie/agent/agent/provider"
+	"github.com/jtarchie/agent/agent/report"
+	"github.com/jtarchie/agent/agent/review"
+	"github.com/jtarchie/agent/agent/usage"
+	"github.com/jtarchie/agent/agent/verify"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+)
+
+func TestClassify(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	outcomes := map[error]report.Outcome{
+		nil:                       report.Success,
+		report.ErrNoChanges:       report.NoChanges,
+		verify.ErrFailed:          report.VerificationFailed,
+		usage.ErrBudgetExceeded:   report.LimitExceeded,
+		interrupt.ErrInterrupted:  report.Interrupted,
+		context.Canceled:          report.Interrupted,
+		errors.New("bad request"): report.Failed,
+		&limits.Error{Reason: "max steps of 1 reached"}:                             report.LimitExceeded,
+		fmt.Errorf("could not chat completion: %w", provider.ErrAllProvidersFailed): report.ProviderError,
+		fmt.Errorf("could not chat completion: %w", provider.ErrRequestRejected):    report.ProviderError,
+	}
+
+	for err, outcome := range outcomes {
+		assert.Expect(report.Classify(err)).To(Equal(outcome), fmt.Sprint(err))
+	}
+
+	codes := map[int]bool{}
+	for _, outcome := range outcomes {
+		codes[outcome.ExitCode()] = true
+	}
+	assert.Expect(codes).To(HaveLen(7))
+	assert.Expect(report.Success.ExitCode()).To(Equal(0))
+	assert.Expect(report.Failed.ExitCode()).To(Equal(1))
+}
+
+func TestExit(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(report.Exit(nil)).To(Succeed())
+
+	err := report.Exit(fmt.Errorf("execution failed: %w", verify.ErrFailed))
+	assert.Expect(err).To(MatchError("execution failed: verification failed"))
+	assert.Expect(err).To(MatchError(verify.ErrFailed))
+
+	var exitCoder kong.ExitCoder
+	assert.Expect(errors.As(err, &exitCoder)).To(BeTrue())
+	assert.Expect(exitCoder.ExitCode()).To(Equal(report.VerificationFailed.ExitCode()))
+}
+
+func TestRecorder(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	recorder := report.NewRecorder()
+	ctx := report.WithRecorder(context.Background(), recorder)
+
+	tools := report.Track([]agent.Tool{
+		{
+			Name: "run_in_terminal",
+			Func: func(context.Context, map[string]any) (any, error) {
+				return map[string]any{"exit_code": 2}, nil
+			},
+		},
+		{
+			Name: "read_file",
+			Func: func(context.Context, map[string]any) (any, error) {
+				return "contents", nil
+			},
+		},
+		{
+			Name: "run_migrations",
+			Func: func(context.Context, map[string]any) (any, error) {
+				return map[string]any{"command": []string{"migrate", "up"}, "exit_code": 0}, nil
+			},
+		},
+	})
+
+	_, _ = tools[0].Func(ctx, map[string]any{"command": []any{"go", "test", "./..."}})
+	_, _ = tools[1].Func(ctx, map[string]any{"filePath": "main.go"})
+	_, _ = tools[2].Func(ctx, map[string]any{"direction": "up"})
+
+	// Calls without a recorder are not recorded
+	_, _ = tools[0].Func(context.Background(), map[string]any{"command": []any{"ls"}})
+
+	report.Verified(ctx, verify.Report{Passed: true, Results: []verify.Result{}})
+	report.Verified(context.Background(), verify.Report{})
+
+	assert.Expect(recorder.Commands()).To(Equal([]report.Command{
+		{Tool: "run_in_terminal", Command: "go test ./...", ExitCode: 2},
+		{Tool: "run_migrations", Command: "migrate up", ExitCode: 0},
+	}))
+	assert.Expect(recorder.Verification()).To(HaveLen(1))
+}
+
+func TestWrite(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "out", "report.json")
+
+	runReport := &report.Report{
+		SessionID:    "session",
+		Plan:         "Do the thing",
+		Critiques:    []review.Critique{{Round: 1, Score: 8, Approved: true, Issues: []string{}}},
+		Commands:     []report.Command{},
+		Verification: []verify.Report{},
+	}
+	runReport.Finish(&limits.Error{Reason: "timeout of 1m0s reached"})
+
+	assert.Expect(runReport.Write(path)).To(Succeed())
+
+	contents, err := os.ReadFile(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	var written map[string]any
+	assert.Expect(json.Unmarshal(contents, &written)).To(Succeed())
+	assert.Expect(written).To(HaveKeyWithValue("outcome", "limit_exceeded"))
+	assert.Expect(written).To(HaveKeyWithValue("exit_code", BeNumerically("==", 4)))
+	assert.Expect(written).To(HaveKeyWithValue("reason", "limit exceeded: timeout of 1m0s reached"))
+	assert.Expect(written).To(HaveKeyWithValue("plan", "Do the thing"))
+	assert.Expect(written).To(HaveKeyWithValue("critiques", ConsistOf(HaveKeyWithValue("score", BeNumerically("==", 8)))))
+}
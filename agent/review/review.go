@@ -0,0 +1,120 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Critique is a reviewer's assessment of a plan.
+type Critique struct {
+	Round        int      `json:"round"`
+	Score        int      `json:"score"` // 1 (unusable) to 10 (excellent)
+	Approved     bool     `json:"approved"`
+	Issues       []string `json:"issues"`
+	MissingFiles []string `json:"missing_files,omitempty"`
+}
+
+// Passes reports whether the plan is good enough to execute.
+func (c Critique) Passes(minScore int) bool {
+	return c.Approved && c.Score >= minScore
+}
+
+// String renders the critique as feedback for the planner.
+func (c Critique) String() string {
+	var feedback strings.Builder
+
+	fmt.Fprintf(&feedback, "Score: %d/10\n", c.Score)
+
+	if len(c.Issues) > 0 {
+		feedback.WriteString("\nIssues:\n")
+		for _, issue := range c.Issues {
+			feedback.WriteString("- " + issue + "\n")
+		}
+	}
+
+	if len(c.MissingFiles) > 0 {
+		feedback.WriteString("\nReferenced files that do not exist in the workspace (fine only if the plan creates them):\n")
+		for _, file := range c.MissingFiles {
+			feedback.WriteString("- " + file + "\n")
+		}
+	}
+
+	return feedback.String()
+}
+
+// referencePattern matches backticked tokens that look like file paths: a
+// path with a directory separator or a name with an extension.
+var referencePattern = regexp.MustCompile("`([^`\\s]+)`")
+
+// fileLikePattern accepts tokens that resemble paths
+var fileLikePattern = regexp.MustCompile(`^(?:\.{0,2}/)?[\w.@-]+(?:/[\w.@-]+)*\.[A-Za-z0-9]+$|^(?:\.{0,2}/)?[\w.@-]+(?:/[\w.@-]+)+/?$`)
+
+// ReferencedFiles extracts the file paths a plan mentions in backticks.
+func ReferencedFiles(plan string) []string {
+	var files []string
+	seen := map[string]bool{}
+
+	for _, match := range referencePattern.FindAllStringSubmatch(plan, -1) {
+		token := strings.TrimRight(match[1], ".,:;")
+
+		if strings.Contains(token, "://") || strings.Contains(token, "...") || strings.Contains(token, "*") {
+			continue
+		}
+
+		if !fileLikePattern.MatchString(token) || seen[token] {
+			continue
+		}
+
+		seen[token] = true
+		files = append(files, token)
+	}
+
+	return files
+}
+
+// MissingFiles returns the files that do not exist under root, ignoring
+// any that would resolve outside of it.
+func MissingFiles(root string, files []string) []string {
+	var missing []string
+
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		if filepath.IsAbs(file) {
+			path = filepath.Clean(file)
+		}
+
+		if relative, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(relative, "..") {
+			missing = append(missing, file)
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, file)
+		}
+	}
+
+	return missing
+}
+
+// jsonObjectPattern finds the outermost JSON object in a response
+var jsonObjectPattern = regexp.MustCompile(`(?s)\{.*\}`)
+
+// ParseCritique reads the reviewer's JSON response. A response that cannot
+// be parsed is treated as an unapproved critique with the text as its issue.
+func ParseCritique(response string) Critique {
+	var critique Critique
+
+	if match := jsonObjectPattern.FindString(response); match != "" {
+		if err := json.Unmarshal([]byte(match), &critique); err == nil {
+			return critique
+		}
+	}
+
+	return Critique{
+		Issues: []string{strings.TrimSpace(response)},
+	}
+}
@@ -0,0 +1,66 @@
+package review_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/review"
+	. "github.com/onsi/gomega"
+)
+
+func TestReferencedFiles(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	plan := "1. Open `agent/main.go` and `README.md`.\n" +
+		"2. Run `go test ./...` and `npm test`.\n" +
+		"3. Check `agent/tools/` and `https://example.com/x.js`, `**/*.go`.\n" +
+		"4. Update `agent/main.go`, then `expandPatterns`."
+
+	assert.Expect(review.ReferencedFiles(plan)).To(Equal([]string{
+		"agent/main.go",
+		"README.md",
+		"agent/tools/",
+	}))
+}
+
+func TestMissingFiles(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "lib"), 0755)
+	assert.Expect(err).NotTo(HaveOccurred())
+	err = os.WriteFile(filepath.Join(root, "lib", "util.go"), []byte("package lib"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	missing := review.MissingFiles(root, []string{"lib/util.go", "lib/", "lib/missing.go", "../outside.go"})
+	assert.Expect(missing).To(Equal([]string{"lib/missing.go", "../outside.go"}))
+}
+
+func TestParseCritique(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	critique := review.ParseCritique("<think>hmm</think>\n```json\n{\"score\": 6, \"approved\": false, \"issues\": [\"Step 2 is vague\"]}\n```")
+	assert.Expect(critique).To(Equal(review.Critique{Score: 6, Issues: []string{"Step 2 is vague"}}))
+	assert.Expect(critique.Passes(7)).To(BeFalse())
+
+	critique = review.ParseCritique(`{"score": 8, "approved": true, "issues": []}`)
+	assert.Expect(critique.Passes(7)).To(BeTrue())
+	assert.Expect(critique.Passes(9)).To(BeFalse())
+
+	critique = review.ParseCritique("The plan looks incomplete.")
+	assert.Expect(critique.Approved).To(BeFalse())
+	assert.Expect(critique.Issues).To(Equal([]string{"The plan looks incomplete."}))
+}
+
+func TestCritiqueString(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	critique := review.Critique{
+		Score:        5,
+		Issues:       []string{"Step 2 is vague"},
+		MissingFiles: []string{"lib/missing.go"},
+	}
+
+	assert.Expect(critique.String()).To(Equal("Score: 5/10\n\nIssues:\n- Step 2 is vague\n\nReferenced files that do not exist in the workspace (fine only if the plan creates them):\n- lib/missing.go\n"))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jtarchie/agent/agent/config"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/server"
+	"github.com/jtarchie/agent/agent/workspace"
+	"github.com/samber/lo"
+)
+
+// Serve defines the HTTP API server command
+type Serve struct {
+	Listen      string `help:"Address to serve the HTTP API on." default:"127.0.0.1:8080" env:"AGENT_LISTEN"`
+	Root        string `help:"Workspace root that jobs plan and execute in. Job patterns are relative to it." default:"." env:"AGENT_ROOT"`
+	Concurrency int    `help:"Number of jobs to run at once, each in its own copy of the workspace." default:"1" env:"AGENT_CONCURRENCY"`
+	QueueSize   int    `help:"Maximum number of jobs waiting to run before new jobs are rejected." default:"100" env:"AGENT_QUEUE_SIZE"`
+	Retain      int    `help:"Number of finished jobs kept for the API, the oldest are forgotten first." default:"100" env:"AGENT_RETAIN"`
+
+	Settings `embed:""`
+}
+
+// Run serves the HTTP API until interrupted. The first Ctrl-C stops
+// accepting jobs and lets running jobs finish their current step, the second
+// aborts them.
+func (s *Serve) Run() error {
+	root, err := filepath.Abs(s.Root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+
+	// Relative config files are found in the workspace root
+	configFiles := lo.Map(expandHome(s.ConfigFiles), func(path string, _ int) string {
+		return inDir(root, path)
+	})
+
+	cfg, err := config.Load(configFiles...)
+	if err != nil {
+		return err
+	}
+
+	teardown, err := s.setup(cfg)
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	ctx, stopper := interrupt.New(context.Background())
+	defer stopper.Notify(os.Stderr, os.Interrupt, syscall.SIGTERM)()
+
+	jobs := server.New(ctx, s.runner(root, cfg), server.Options{
+		Concurrency: s.Concurrency,
+		QueueSize:   s.QueueSize,
+		Retain:      s.Retain,
+	})
+
+	httpServer := &http.Server{
+		Addr:              s.Listen,
+		Handler:           jobs.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving agent jobs for %s on http://%s\n", root, s.Listen)
+
+	select {
+	case err := <-serveErr:
+		jobs.Close()
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-stopper.Stopping():
+	}
+
+	// Finish the jobs first, so event streams end before the server stops
+	jobs.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	return nil
+}
+
+// runner runs each job as a CLI run in its own copy of root with the
+// server's settings.
+func (s *Serve) runner(root string, cfg *config.Config) server.Runner {
+	return func(ctx context.Context, request server.Request, reporter progress.Reporter) (server.Result, error) {
+		dir, remove, err := jobWorkspace(ctx, root)
+		if err != nil {
+			return server.Result{}, err
+		}
+		defer remove()
+
+		cli := &CLI{
+			Patterns: request.Patterns,
+			Message:  request.Message,
+			Batch:    request.Batch,
+			Tools:    request.Tools,
+			Profile:  cmp.Or(request.Profile, "default"),
+			Settings: s.Settings,
+		}
+
+		result, err := cli.execute(ctx, dir, cfg, reporter)
+		if result == nil {
+			return server.Result{}, err
+		}
+
+		return server.Result{
+			Plan:   result.report.Plan,
+			Diff:   result.diff,
+			Report: result.report,
+		}, err
+	}
+}
+
+// jobWorkspace gives a job its own copy of root, so concurrent jobs do not
+// edit, verify or diff each other's changes. Repositories get a worktree of
+// HEAD, anything else a full copy. The changes reach the client as the diff.
+func jobWorkspace(ctx context.Context, root string) (string, func(), error) {
+	dir, remove, err := workspace.Worktree(ctx, root)
+	if err == nil {
+		return dir, remove, nil
+	}
+
+	slog.Debug("serve.worktree_unavailable", "root", root, "error", err)
+
+	return workspace.Copy(root)
+}
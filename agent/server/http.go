@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxRequestSize bounds the size of a submitted job request.
+const maxRequestSize = 1 << 20
+
+// Handler returns the JSON HTTP API:
+//
+//	POST /jobs               submit a job, returning its snapshot
+//	GET  /jobs               list every job
+//	GET  /jobs/{id}          get a job's snapshot
+//	GET  /jobs/{id}/events   stream the job's progress as Server-Sent Events
+//	GET  /jobs/{id}/plan     get the job's plan as markdown
+//	GET  /jobs/{id}/diff     get the job's changes as a unified diff
+//	GET  /jobs/{id}/report   get the job's report
+//	POST /jobs/{id}/cancel   cancel the job, aborting it when repeated
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /jobs", s.submit)
+	mux.HandleFunc("GET /jobs", s.list)
+	mux.HandleFunc("GET /jobs/{id}", s.withJob(s.get))
+	mux.HandleFunc("GET /jobs/{id}/events", s.withJob(s.events))
+	mux.HandleFunc("GET /jobs/{id}/plan", s.withJob(s.plan))
+	mux.HandleFunc("GET /jobs/{id}/diff", s.withJob(s.diff))
+	mux.HandleFunc("GET /jobs/{id}/report", s.withJob(s.report))
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.withJob(s.cancel))
+
+	return mux
+}
+
+func (s *Server) withJob(handler func(http.ResponseWriter, *http.Request, *Job)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := s.Job(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+
+		handler(w, r, job)
+	}
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var request Request
+
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid job request: %s", err))
+		return
+	}
+
+	job, err := s.Submit(request)
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID())
+	writeJSON(w, http.StatusAccepted, job.Snapshot())
+}
+
+func (s *Server) list(w http.ResponseWriter, _ *http.Request) {
+	snapshots := []Snapshot{}
+	for _, job := range s.Jobs() {
+		snapshots = append(snapshots, job.Snapshot())
+	}
+
+	writeJSON(w, http.StatusOK, snapshots)
+}
+
+func (s *Server) get(w http.ResponseWriter, _ *http.Request, job *Job) {
+	writeJSON(w, http.StatusOK, job.Snapshot())
+}
+
+// events streams the job's progress events, starting with those already
+// recorded, followed by a final "done" event with the job's snapshot. Tokens
+// streamed from the models are only sent while connected.
+func (s *Server) events(w http.ResponseWriter, r *http.Request, job *Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	events, live, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	for _, event := range events {
+		writeEvent(w, string(event.Kind), event)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-live:
+			if !ok {
+				// A subscriber that fell behind is dropped before the job
+				// finishes, and can reconnect to start over
+				if job.Finished() {
+					writeEvent(w, "done", job.Snapshot())
+					flusher.Flush()
+				}
+
+				return
+			}
+
+			writeEvent(w, string(event.Kind), event)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) plan(w http.ResponseWriter, _ *http.Request, job *Job) {
+	plan := job.Plan()
+	if plan == "" {
+		writeError(w, http.StatusConflict, "job has no plan yet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	_, _ = io.WriteString(w, plan)
+}
+
+func (s *Server) diff(w http.ResponseWriter, _ *http.Request, job *Job) {
+	result, finished := job.Result()
+	if !finished {
+		writeError(w, http.StatusConflict, "job has not finished")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	_, _ = io.WriteString(w, result.Diff)
+}
+
+func (s *Server) report(w http.ResponseWriter, _ *http.Request, job *Job) {
+	result, finished := job.Result()
+	switch {
+	case !finished:
+		writeError(w, http.StatusConflict, "job has not finished")
+	case result.Report == nil:
+		writeError(w, http.StatusNotFound, "job finished without a report")
+	default:
+		writeJSON(w, http.StatusOK, result.Report)
+	}
+}
+
+func (s *Server) cancel(w http.ResponseWriter, _ *http.Request, job *Job) {
+	if !s.Cancel(job.ID()) {
+		writeError(w, http.StatusConflict, "job has already finished")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job.Snapshot())
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeEvent(w io.Writer, name string, value any) {
+	data, _ := json.Marshal(value)
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/report"
+)
+
+// Status is where a job is in its lifecycle.
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// Request is what a job should do, as submitted to the API.
+type Request struct {
+	Message  string   `json:"message"`
+	Patterns []string `json:"patterns,omitempty"`
+	Batch    bool     `json:"batch,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	Profile  string   `json:"profile,omitempty"`
+}
+
+// Result is what a finished job produced.
+type Result struct {
+	Plan   string
+	Diff   string
+	Report *report.Report
+}
+
+// Snapshot is the state of a job at a point in time.
+type Snapshot struct {
+	ID         string         `json:"id"`
+	Status     Status         `json:"status"`
+	Request    Request        `json:"request"`
+	CreatedAt  time.Time      `json:"created_at"`
+	StartedAt  *time.Time     `json:"started_at,omitempty"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Outcome    report.Outcome `json:"outcome,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// streamed tokens are dropped for it.
+const subscriberBuffer = 1024
+
+// Job is a request queued or run by the server. It records the progress
+// events of its run, so it is the run's progress.Reporter. Streamed tokens
+// are only sent to subscribers, so the record stays small.
+type Job struct {
+	mu sync.Mutex
+
+	id        string
+	request   Request
+	status    Status
+	createdAt time.Time
+	started   time.Time
+	finished  time.Time
+	err       error
+	plan      string
+	result    Result
+	events    []progress.Event
+
+	subscribers map[chan progress.Event]struct{}
+	stopper     *interrupt.Stopper
+}
+
+func newJob(request Request) *Job {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return &Job{
+		id:        hex.EncodeToString(id),
+		request:   request,
+		status:    Queued,
+		createdAt: time.Now().UTC(),
+
+		subscribers: map[chan progress.Event]struct{}{},
+	}
+}
+
+// ID returns the job's identifier.
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Report records a progress event of the job's run, keeping the latest plan,
+// and sends it to the job's subscribers.
+func (j *Job) Report(event progress.Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if event.Kind != progress.Token {
+		j.events = append(j.events, event)
+	}
+
+	if event.Kind == progress.PlanReady {
+		j.plan = event.Text
+	}
+
+	for subscriber := range j.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// Tokens can be missed, but a subscriber that misses a recorded
+			// event is dropped, so it can start over
+			if event.Kind != progress.Token {
+				delete(j.subscribers, subscriber)
+				close(subscriber)
+			}
+		}
+	}
+}
+
+// Snapshot returns the job's current state.
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snapshot := Snapshot{
+		ID:        j.id,
+		Status:    j.status,
+		Request:   j.request,
+		CreatedAt: j.createdAt,
+	}
+
+	if !j.started.IsZero() {
+		started := j.started
+		snapshot.StartedAt = &started
+	}
+
+	if j.finished.IsZero() {
+		return snapshot
+	}
+
+	finished := j.finished
+	snapshot.FinishedAt = &finished
+	snapshot.Outcome = report.Classify(j.err)
+	if j.err != nil {
+		snapshot.Error = j.err.Error()
+	}
+
+	return snapshot
+}
+
+// Plan returns the job's latest plan, or an empty string before planning
+// has finished.
+func (j *Job) Plan() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.plan
+}
+
+// Result returns what the job produced and whether it has finished.
+func (j *Job) Result() (Result, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.result, !j.finished.IsZero()
+}
+
+// Subscribe returns the events recorded so far and a channel of the events
+// that follow, including streamed tokens. The channel is closed when the job
+// finishes, or when the subscriber falls too far behind. Unsubscribe with the
+// returned function.
+func (j *Job) Subscribe() ([]progress.Event, <-chan progress.Event, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	subscriber := make(chan progress.Event, subscriberBuffer)
+	if j.finished.IsZero() {
+		j.subscribers[subscriber] = struct{}{}
+	} else {
+		close(subscriber)
+	}
+
+	unsubscribe := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		if _, ok := j.subscribers[subscriber]; ok {
+			delete(j.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return slices.Clone(j.events), subscriber, unsubscribe
+}
+
+// Finished reports whether the job has finished.
+func (j *Job) Finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.finished.IsZero()
+}
+
+// start marks the job as running, stopped by stopper when cancelled. It
+// returns false when the job was cancelled while queued.
+func (j *Job) start(stopper *interrupt.Stopper) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status != Queued {
+		return false
+	}
+
+	j.status = Running
+	j.started = time.Now().UTC()
+	j.stopper = stopper
+
+	return true
+}
+
+// finish records the outcome of the job's run.
+func (j *Job) finish(result Result, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finished = time.Now().UTC()
+	j.result = result
+	j.err = err
+
+	if result.Plan != "" {
+		j.plan = result.Plan
+	}
+
+	switch {
+	case err == nil:
+		j.status = Succeeded
+	case j.status == Cancelled:
+		// Cancelled while running
+	default:
+		j.status = Failed
+	}
+
+	j.closeSubscribers()
+}
+
+// cancel stops a queued job from running. A running job is asked to stop
+// after its current step, and aborted when cancelled again. It returns false
+// when the job has already finished.
+func (j *Job) cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.finished.IsZero() {
+		return false
+	}
+
+	switch j.status {
+	case Queued:
+		j.status = Cancelled
+		j.finished = time.Now().UTC()
+		j.err = interrupt.ErrInterrupted
+		j.closeSubscribers()
+	case Cancelled:
+		j.stopper.Abort()
+	default:
+		j.status = Cancelled
+		j.stopper.Stop()
+	}
+
+	return true
+}
+
+// closeSubscribers ends the subscriptions once the job has finished. The
+// caller must hold the lock.
+func (j *Job) closeSubscribers() {
+	for subscriber := range maps.Keys(j.subscribers) {
+		delete(j.subscribers, subscriber)
+		close(subscriber)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/progress"
+)
+
+var (
+	// ErrQueueFull is returned when a job is submitted while the queue is full.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed is returned when a job is submitted after the server closed.
+	ErrClosed = errors.New("server is closed")
+	// ErrInvalidRequest is returned for a job request that cannot be run.
+	ErrInvalidRequest = errors.New("invalid job request")
+)
+
+// Runner runs a job's request, sending the run's progress to reporter. The
+// run stops gracefully once interrupt.Requested reports true for ctx.
+type Runner func(ctx context.Context, request Request, reporter progress.Reporter) (Result, error)
+
+// Options configure how jobs are queued and run.
+type Options struct {
+	// Concurrency is how many jobs run at once. Defaults to one.
+	Concurrency int
+	// QueueSize is how many jobs may wait to run. Defaults to 100.
+	QueueSize int
+	// Retain is how many finished jobs are kept, the oldest are forgotten
+	// first. Defaults to 100.
+	Retain int
+}
+
+// Server queues job requests and runs them with a limited concurrency.
+type Server struct {
+	ctx    context.Context
+	runner Runner
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []*Job
+	queue  chan *Job
+	retain int
+	closed bool
+
+	workers sync.WaitGroup
+}
+
+// New creates a server running jobs with runner. Jobs run in contexts
+// derived from ctx, so cancelling it aborts them.
+func New(ctx context.Context, runner Runner, options Options) *Server {
+	concurrency := max(options.Concurrency, 1)
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+
+	retain := options.Retain
+	if retain <= 0 {
+		retain = 100
+	}
+
+	server := &Server{
+		ctx:    ctx,
+		runner: runner,
+		jobs:   map[string]*Job{},
+		queue:  make(chan *Job, queueSize),
+		retain: retain,
+	}
+
+	for range concurrency {
+		server.workers.Add(1)
+		go server.work()
+	}
+
+	return server
+}
+
+// Submit queues a job for request.
+func (s *Server) Submit(request Request) (*Job, error) {
+	if strings.TrimSpace(request.Message) == "" {
+		return nil, fmt.Errorf("%w: message is required", ErrInvalidRequest)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	job := newJob(request)
+
+	select {
+	case s.queue <- job:
+	default:
+		return nil, ErrQueueFull
+	}
+
+	s.jobs[job.id] = job
+	s.order = append(s.order, job)
+	s.prune()
+
+	slog.Info("server.job_queued", "job", job.id, "queued", len(s.queue))
+
+	return job, nil
+}
+
+// Job returns the job with id.
+func (s *Server) Job(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// Jobs returns every job in the order they were submitted.
+func (s *Server) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.order)
+}
+
+// Cancel cancels the job with id. It returns false when there is no such
+// job or it has already finished.
+func (s *Server) Cancel(id string) bool {
+	job, ok := s.Job(id)
+	if !ok {
+		return false
+	}
+
+	cancelled := job.cancel()
+	if cancelled {
+		slog.Info("server.job_cancelled", "job", id)
+
+		s.mu.Lock()
+		s.prune()
+		s.mu.Unlock()
+	}
+
+	return cancelled
+}
+
+// Close stops accepting jobs, cancels queued jobs, asks running jobs to
+// stop after their current step and waits for them to finish.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.workers.Wait()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	jobs := slices.Clone(s.order)
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		job.cancel()
+	}
+
+	s.workers.Wait()
+}
+
+func (s *Server) work() {
+	defer s.workers.Done()
+
+	for job := range s.queue {
+		s.run(job)
+	}
+}
+
+func (s *Server) run(job *Job) {
+	ctx, stopper := interrupt.New(s.ctx)
+	// Release the job's context once it is done
+	defer stopper.Abort()
+
+	if !job.start(stopper) {
+		return
+	}
+
+	slog.Info("server.job_started", "job", job.id)
+
+	result, err := s.runner(ctx, job.request, job)
+	job.finish(result, err)
+
+	slog.Info("server.job_finished", "job", job.id, "status", job.Snapshot().Status, "error", err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+}
+
+// prune forgets the oldest finished jobs beyond those retained. The caller
+// must hold the lock.
+func (s *Server) prune() {
+	finished := 0
+	for _, job := range s.order {
+		if job.Finished() {
+			finished++
+		}
+	}
+
+	s.order = slices.DeleteFunc(s.order, func(job *Job) bool {
+		if finished <= s.retain || !job.Finished() {
+			return false
+		}
+
+		finished--
+		delete(s.jobs, job.id)
+
+		return true
+	})
+}
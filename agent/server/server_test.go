@@ -0,0 +1,412 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/interrupt"
+	"github.com/jtarchie/agent/agent/progress"
+	"github.com/jtarchie/agent/agent/report"
+	"github.com/jtarchie/agent/agent/server"
+	"github.com/jtarchie/agent/agent/workspace"
+	. "github.com/onsi/gomega"
+)
+
+// blockingRunner plans, then waits for release or a stop before finishing.
+type blockingRunner struct {
+	release chan struct{}
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func newBlockingRunner() *blockingRunner {
+	return &blockingRunner{release: make(chan struct{})}
+}
+
+func (b *blockingRunner) run(ctx context.Context, request server.Request, reporter progress.Reporter) (server.Result, error) {
+	running := b.running.Add(1)
+	defer b.running.Add(-1)
+
+	for {
+		peak := b.peak.Load()
+		if running <= peak || b.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+
+	plan := "1. " + request.Message
+	reporter.Report(progress.Event{Kind: progress.PhaseStarted, Phase: "planning"})
+	reporter.Report(progress.Event{Kind: progress.PlanReady, Text: plan})
+
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return server.Result{}, ctx.Err()
+	}
+
+	err := interrupt.Check(ctx)
+	if err != nil {
+		return server.Result{Plan: plan}, err
+	}
+
+	runReport := &report.Report{Plan: plan}
+	runReport.Finish(nil)
+
+	return server.Result{Plan: plan, Diff: "--- a/main.go\n+++ b/main.go\n", Report: runReport}, nil
+}
+
+func submit(assert *WithT, url string, body string) (int, server.Snapshot) {
+	response, err := http.Post(url+"/jobs", "application/json", strings.NewReader(body))
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = response.Body.Close() }()
+
+	var snapshot server.Snapshot
+	_ = json.NewDecoder(response.Body).Decode(&snapshot)
+
+	return response.StatusCode, snapshot
+}
+
+func get(assert *WithT, url string) (int, string) {
+	response, err := http.Get(url)
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := io.ReadAll(response.Body)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	return response.StatusCode, string(body)
+}
+
+func status(assert *WithT, url, id string) func() server.Status {
+	return func() server.Status {
+		_, body := get(assert, url+"/jobs/"+id)
+
+		var snapshot server.Snapshot
+		assert.Expect(json.Unmarshal([]byte(body), &snapshot)).To(Succeed())
+		return snapshot.Status
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	runner := newBlockingRunner()
+	jobs := server.New(context.Background(), runner.run, server.Options{})
+	defer jobs.Close()
+
+	api := httptest.NewServer(jobs.Handler())
+	defer api.Close()
+
+	code, snapshot := submit(assert, api.URL, `{"message": "add a test", "patterns": ["*.go"]}`)
+	assert.Expect(code).To(Equal(http.StatusAccepted))
+	assert.Expect(snapshot.Request.Patterns).To(Equal([]string{"*.go"}))
+
+	assert.Eventually(status(assert, api.URL, snapshot.ID)).Should(Equal(server.Running))
+
+	// The plan is available while the job runs, the diff and report once it finishes
+	assert.Eventually(func() string {
+		_, body := get(assert, api.URL+"/jobs/"+snapshot.ID+"/plan")
+		return body
+	}).Should(Equal("1. add a test"))
+
+	code, _ = get(assert, api.URL+"/jobs/"+snapshot.ID+"/diff")
+	assert.Expect(code).To(Equal(http.StatusConflict))
+
+	close(runner.release)
+	assert.Eventually(status(assert, api.URL, snapshot.ID)).Should(Equal(server.Succeeded))
+
+	code, body := get(assert, api.URL+"/jobs/"+snapshot.ID+"/diff")
+	assert.Expect(code).To(Equal(http.StatusOK))
+	assert.Expect(body).To(HavePrefix("--- a/main.go"))
+
+	code, body = get(assert, api.URL+"/jobs/"+snapshot.ID+"/report")
+	assert.Expect(code).To(Equal(http.StatusOK))
+	assert.Expect(body).To(ContainSubstring(`"outcome":"success"`))
+
+	code, body = get(assert, api.URL+"/jobs")
+	assert.Expect(code).To(Equal(http.StatusOK))
+	assert.Expect(body).To(ContainSubstring(snapshot.ID))
+
+	code, _ = get(assert, api.URL+"/jobs/missing")
+	assert.Expect(code).To(Equal(http.StatusNotFound))
+}
+
+func TestEvents(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	runner := newBlockingRunner()
+	jobs := server.New(context.Background(), runner.run, server.Options{})
+	defer jobs.Close()
+
+	api := httptest.NewServer(jobs.Handler())
+	defer api.Close()
+
+	_, snapshot := submit(assert, api.URL, `{"message": "stream"}`)
+
+	response, err := http.Get(api.URL + "/jobs/" + snapshot.ID + "/events")
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = response.Body.Close() }()
+	assert.Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+	names := make(chan string, 10)
+	go func() {
+		defer close(names)
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				names <- name
+			}
+		}
+	}()
+
+	assert.Eventually(names).Should(Receive(Equal("phase")))
+	assert.Eventually(names).Should(Receive(Equal("plan")))
+
+	close(runner.release)
+
+	assert.Eventually(names).Should(Receive(Equal("done")))
+	assert.Eventually(names).Should(BeClosed())
+}
+
+func TestConcurrencyAndQueue(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	runner := newBlockingRunner()
+	jobs := server.New(context.Background(), runner.run, server.Options{Concurrency: 2, QueueSize: 2})
+	defer jobs.Close()
+
+	var submitted []*server.Job
+	for range 2 {
+		job, err := jobs.Submit(server.Request{Message: "work"})
+		assert.Expect(err).NotTo(HaveOccurred())
+		submitted = append(submitted, job)
+	}
+	assert.Eventually(runner.running.Load).Should(BeEquivalentTo(2))
+
+	for range 2 {
+		job, err := jobs.Submit(server.Request{Message: "wait"})
+		assert.Expect(err).NotTo(HaveOccurred())
+		submitted = append(submitted, job)
+	}
+
+	_, err := jobs.Submit(server.Request{Message: "overflow"})
+	assert.Expect(err).To(MatchError(server.ErrQueueFull))
+
+	_, err = jobs.Submit(server.Request{})
+	assert.Expect(err).To(MatchError(server.ErrInvalidRequest))
+
+	assert.Consistently(runner.running.Load).Should(BeEquivalentTo(2))
+	assert.Expect(submitted[3].Snapshot().Status).To(Equal(server.Queued))
+
+	close(runner.release)
+	for _, job := range submitted {
+		assert.Eventually(func() server.Status { return job.Snapshot().Status }).Should(Equal(server.Succeeded))
+	}
+	assert.Expect(runner.peak.Load()).To(BeEquivalentTo(2))
+}
+
+func TestOverlappingJobsInOwnWorktrees(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n"})
+
+	// Each job edits its own worktree and only waits for the other to start
+	// before finishing, so they overlap
+	var started sync.WaitGroup
+	started.Add(2)
+
+	runner := func(ctx context.Context, request server.Request, reporter progress.Reporter) (server.Result, error) {
+		dir, remove, err := workspace.Worktree(ctx, repo)
+		if err != nil {
+			return server.Result{}, err
+		}
+		defer remove()
+
+		err = os.WriteFile(filepath.Join(dir, request.Message+".go"), []byte("package main\n"), 0o644)
+		if err != nil {
+			return server.Result{}, err
+		}
+
+		overlapped := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(overlapped)
+		}()
+
+		started.Done()
+		select {
+		case <-overlapped:
+		case <-time.After(5 * time.Second):
+			return server.Result{}, errors.New("jobs did not overlap")
+		}
+
+		changed, err := workspace.ChangedFiles(ctx, dir)
+		if err != nil {
+			return server.Result{}, err
+		}
+
+		return server.Result{Diff: strings.Join(changed, "\n")}, nil
+	}
+
+	jobs := server.New(context.Background(), runner, server.Options{Concurrency: 2})
+	defer jobs.Close()
+
+	var submitted []*server.Job
+	for _, message := range []string{"first", "second"} {
+		job, err := jobs.Submit(server.Request{Message: message})
+		assert.Expect(err).NotTo(HaveOccurred())
+		submitted = append(submitted, job)
+	}
+
+	for index, message := range []string{"first", "second"} {
+		job := submitted[index]
+		assert.Eventually(func() server.Status { return job.Snapshot().Status }, 10*time.Second).Should(Equal(server.Succeeded))
+
+		result, ok := job.Result()
+		assert.Expect(ok).To(BeTrue())
+		assert.Expect(result.Diff).To(Equal(message + ".go"))
+	}
+
+	// The workspace itself is left untouched
+	changed, err := workspace.ChangedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(BeEmpty())
+}
+
+func TestCancel(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	runner := newBlockingRunner()
+	jobs := server.New(context.Background(), runner.run, server.Options{})
+	defer jobs.Close()
+
+	api := httptest.NewServer(jobs.Handler())
+	defer api.Close()
+
+	_, running := submit(assert, api.URL, `{"message": "first"}`)
+	_, queued := submit(assert, api.URL, `{"message": "second"}`)
+	assert.Eventually(status(assert, api.URL, running.ID)).Should(Equal(server.Running))
+
+	cancel := func(id string) int {
+		response, err := http.Post(api.URL+"/jobs/"+id+"/cancel", "application/json", nil)
+		assert.Expect(err).NotTo(HaveOccurred())
+		_ = response.Body.Close()
+		return response.StatusCode
+	}
+
+	// A queued job never runs
+	assert.Expect(cancel(queued.ID)).To(Equal(http.StatusAccepted))
+	assert.Expect(status(assert, api.URL, queued.ID)()).To(Equal(server.Cancelled))
+
+	// A running job stops after its current step, and is aborted when
+	// cancelled again
+	assert.Expect(cancel(running.ID)).To(Equal(http.StatusAccepted))
+	assert.Consistently(status(assert, api.URL, running.ID)).Should(Equal(server.Cancelled))
+	assert.Expect(cancel(running.ID)).To(Equal(http.StatusAccepted))
+
+	job, _ := jobs.Job(running.ID)
+	assert.Eventually(func() report.Outcome { return job.Snapshot().Outcome }).Should(Equal(report.Interrupted))
+
+	assert.Expect(cancel(running.ID)).To(Equal(http.StatusConflict))
+	assert.Expect(runner.peak.Load()).To(BeEquivalentTo(1))
+
+	code, body := get(assert, api.URL+"/jobs/"+queued.ID)
+	assert.Expect(code).To(Equal(http.StatusOK))
+	assert.Expect(body).To(ContainSubstring(`"outcome":"interrupted"`))
+}
+
+func TestClose(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	runner := newBlockingRunner()
+	jobs := server.New(context.Background(), runner.run, server.Options{})
+
+	job, err := jobs.Submit(server.Request{Message: "work"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Eventually(runner.running.Load).Should(BeEquivalentTo(1))
+
+	closed := make(chan struct{})
+	go func() {
+		jobs.Close()
+		close(closed)
+	}()
+
+	// Running jobs finish their current step before the server closes
+	assert.Consistently(closed, 100*time.Millisecond).ShouldNot(BeClosed())
+	close(runner.release)
+	assert.Eventually(closed).Should(BeClosed())
+	assert.Expect(job.Snapshot().Status).To(Equal(server.Cancelled))
+
+	_, err = jobs.Submit(server.Request{Message: "late"})
+	assert.Expect(err).To(MatchError(server.ErrClosed))
+}
+
+func TestTokensAreOnlyStreamed(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	start, release := make(chan struct{}), make(chan struct{})
+	jobs := server.New(context.Background(), func(ctx context.Context, request server.Request, reporter progress.Reporter) (server.Result, error) {
+		<-start
+		reporter.Report(progress.Event{Kind: progress.Token, Text: "Hel"})
+		reporter.Report(progress.Event{Kind: progress.Token, Text: "lo"})
+		reporter.Report(progress.Event{Kind: progress.PlanReady, Text: "Hello"})
+		<-release
+
+		return server.Result{}, nil
+	}, server.Options{})
+	defer jobs.Close()
+
+	job, err := jobs.Submit(server.Request{Message: "stream"})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, live, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+	close(start)
+
+	assert.Eventually(live).Should(Receive(HaveField("Text", "Hel")))
+	assert.Eventually(live).Should(Receive(HaveField("Text", "lo")))
+	assert.Eventually(live).Should(Receive(HaveField("Kind", progress.PlanReady)))
+
+	close(release)
+	assert.Eventually(live).Should(BeClosed())
+
+	events, live, _ := job.Subscribe()
+	assert.Expect(events).To(ConsistOf(HaveField("Kind", progress.PlanReady)))
+	assert.Expect(live).To(BeClosed())
+}
+
+func TestRetain(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	jobs := server.New(context.Background(), func(context.Context, server.Request, progress.Reporter) (server.Result, error) {
+		return server.Result{}, nil
+	}, server.Options{Retain: 2})
+	defer jobs.Close()
+
+	var submitted []*server.Job
+	for range 3 {
+		job, err := jobs.Submit(server.Request{Message: "work"})
+		assert.Expect(err).NotTo(HaveOccurred())
+		assert.Eventually(job.Finished).Should(BeTrue())
+		submitted = append(submitted, job)
+	}
+
+	assert.Eventually(jobs.Jobs).Should(Equal(submitted[1:]))
+
+	_, ok := jobs.Job(submitted[0].ID())
+	assert.Expect(ok).To(BeFalse())
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/agent/agent/review"
+	"github.com/jtarchie/agent/agent/usage"
+)
+
+// Model identifies the model an agent used.
+type Model struct {
+	Provider string `json:"provider"`
+	Endpoint string `json:"endpoint"`
+	Model    string `json:"model"`
+}
+
+// Record describes a run: what was asked, what was planned, what it used
+// and how it ended.
+type Record struct {
+	ID               string            `json:"id"`
+	StartedAt        time.Time         `json:"started_at"`
+	FinishedAt       time.Time         `json:"finished_at"`
+	WorkingDirectory string            `json:"working_directory"`
+	Message          string            `json:"message"`
+	Files            []string          `json:"files,omitempty"`
+	Planning         Model             `json:"planning"`
+	Executing        Model             `json:"executing"`
+	Plan             string            `json:"plan,omitempty"`
+	Critiques        []review.Critique `json:"critiques,omitempty"`
+	Usage            usage.Summary     `json:"usage"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// New starts a record for a run in pwd.
+func New(pwd, message string) *Record {
+	started := time.Now().UTC()
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return &Record{
+		ID:               started.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		StartedAt:        started,
+		WorkingDirectory: pwd,
+		Message:          message,
+	}
+}
+
+// Finish stamps the end of the run with its usage and error, if any.
+func (r *Record) Finish(summary usage.Summary, err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.Usage = summary
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Write saves the record as <id>.json in dir, returning its path.
+func (r *Record) Write(dir string) (string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	contents, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session record: %w", err)
+	}
+
+	path := filepath.Join(dir, r.ID+".json")
+
+	err = os.WriteFile(path, contents, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write session record: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,46 @@
+package session_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/review"
+	"github.com/jtarchie/agent/agent/session"
+	"github.com/jtarchie/agent/agent/usage"
+	. "github.com/onsi/gomega"
+)
+
+func TestRecord(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	record := session.New("/work", "Add tests")
+	record.Files = []string{"main.go"}
+	record.Executing = session.Model{Provider: "openai", Endpoint: "http://localhost:11434/v1", Model: "qwen3:32b"}
+	record.Plan = "1. Add tests"
+	record.Critiques = []review.Critique{{Round: 1, Score: 6, Issues: []string{"Name the test file."}}}
+
+	tracker := usage.NewTracker(nil, usage.Limits{})
+	tracker.Record("executing", "main.go", "qwen3:32b", usage.Tokens{Requests: 1, Prompt: 10, Completion: 5})
+	record.Finish(tracker.Summary(), errors.New("verification failed"))
+
+	dir := filepath.Join(t.TempDir(), "sessions")
+	path, err := record.Write(dir)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(path).To(Equal(filepath.Join(dir, record.ID+".json")))
+
+	contents, err := os.ReadFile(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	var written session.Record
+	assert.Expect(json.Unmarshal(contents, &written)).To(Succeed())
+	assert.Expect(written.Message).To(Equal("Add tests"))
+	assert.Expect(written.Executing.Model).To(Equal("qwen3:32b"))
+	assert.Expect(written.Usage.Session.Total()).To(Equal(15))
+	assert.Expect(written.Usage.Files).To(HaveKey("main.go"))
+	assert.Expect(written.Critiques).To(Equal(record.Critiques))
+	assert.Expect(written.Error).To(Equal("verification failed"))
+	assert.Expect(written.FinishedAt).NotTo(BeTemporally("<", written.StartedAt))
+}
@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name identifies the spans created by the agent.
+const Name = "github.com/jtarchie/agent"
+
+// Options selects where spans are exported. Tracing is disabled when no
+// exporter is configured.
+type Options struct {
+	// Endpoint is an OTLP/HTTP collector URL, such as http://localhost:4318.
+	// The standard OTEL_EXPORTER_OTLP_* variables are used when it is empty.
+	Endpoint string
+	// File receives spans as JSON, one per line, for offline inspection.
+	File string
+}
+
+// otlpConfigured reports whether the environment configures an OTLP exporter.
+func otlpConfigured() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs the global tracer provider and trace context propagator.
+// The returned function flushes and stops the exporters.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	providerOptions := []sdktrace.TracerProviderOption{}
+	closers := []func() error{}
+
+	if options.Endpoint != "" || otlpConfigured() {
+		exporterOptions := []otlptracehttp.Option{}
+		if options.Endpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+
+		exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+	}
+
+	if options.File != "" {
+		file, err := os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+
+		// Spans are written as they end, so a crash keeps what came before
+		providerOptions = append(providerOptions, sdktrace.WithSyncer(exporter))
+		closers = append(closers, file.Close)
+	}
+
+	if len(providerOptions) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	serviceResource, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "agent"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(append(providerOptions, sdktrace.WithResource(serviceResource))...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, closer := range closers {
+			err = errors.Join(err, closer())
+		}
+
+		return err
+	}, nil
+}
+
+// Start begins a span as a child of any span in ctx.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End finishes span, recording err as its status.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Environ returns environment variables carrying the trace context in ctx,
+// such as TRACEPARENT, for child processes to continue the trace.
+func Environ(ctx context.Context) []string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	environ := make([]string, 0, len(carrier))
+	for key, value := range carrier {
+		environ = append(environ, strings.ToUpper(key)+"="+value)
+	}
+
+	return environ
+}
@@ -0,0 +1,89 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/telemetry"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetupFile(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	shutdown, err := telemetry.Setup(context.Background(), telemetry.Options{File: path})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	ctx, parent := telemetry.Start(context.Background(), "executor.run")
+	_, child := telemetry.Start(ctx, "batch.file", attribute.String("file", "main.go"))
+	telemetry.End(child, errors.New("boom"))
+	telemetry.End(parent, nil)
+
+	assert.Expect(shutdown(context.Background())).To(Succeed())
+
+	contents, err := os.ReadFile(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(ContainSubstring(`"Name":"batch.file"`))
+	assert.Expect(string(contents)).To(ContainSubstring(`"Name":"executor.run"`))
+	assert.Expect(string(contents)).To(ContainSubstring(`"Description":"boom"`))
+}
+
+func TestTrackAndEnviron(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	_, err := telemetry.Setup(context.Background(), telemetry.Options{})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var environ []string
+
+	tools := telemetry.Track([]agent.Tool{
+		{
+			Name: "run_in_terminal",
+			Func: func(ctx context.Context, params map[string]any) (any, error) {
+				environ = telemetry.Environ(ctx)
+				return map[string]any{"exit_code": 2}, nil
+			},
+		},
+		{
+			Name: "read_file",
+			Func: func(ctx context.Context, params map[string]any) (any, error) {
+				return nil, errors.New("file not found")
+			},
+		},
+	})
+
+	_, err = tools[0].Func(context.Background(), map[string]any{"command": []string{"go", "test"}})
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools[1].Func(context.Background(), map[string]any{})
+	assert.Expect(err).To(HaveOccurred())
+
+	spans := recorder.Ended()
+	assert.Expect(spans).To(HaveLen(2))
+
+	assert.Expect(spans[0].Name()).To(Equal("tool run_in_terminal"))
+	assert.Expect(spans[0].Attributes()).To(ContainElements(
+		attribute.String("tool.name", "run_in_terminal"),
+		attribute.Int("tool.args_size", len(`{"command":["go","test"]}`)),
+		attribute.Int("process.exit.code", 2),
+	))
+	assert.Expect(environ).To(ContainElement("TRACEPARENT=00-" +
+		spans[0].SpanContext().TraceID().String() + "-" +
+		spans[0].SpanContext().SpanID().String() + "-01"))
+
+	assert.Expect(spans[1].Status().Code).To(Equal(codes.Error))
+	assert.Expect(spans[1].Status().Description).To(Equal("file not found"))
+}
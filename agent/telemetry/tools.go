@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jtarchie/outrageous/agent"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Track wraps tools so each call is traced with its name, the size of its
+// arguments, its duration and, for commands, the exit code.
+func Track(tools []agent.Tool) []agent.Tool {
+	tracked := make([]agent.Tool, 0, len(tools))
+
+	for _, tool := range tools {
+		next := tool.Func
+		name := tool.Name
+
+		tool.Func = func(ctx context.Context, params map[string]any) (any, error) {
+			arguments, _ := json.Marshal(params)
+
+			ctx, span := Start(ctx, "tool "+name,
+				attribute.String("tool.name", name),
+				attribute.Int("tool.args_size", len(arguments)),
+			)
+
+			value, err := next(ctx, params)
+
+			if result, ok := value.(map[string]any); ok {
+				if exitCode, ok := result["exit_code"].(int); ok {
+					span.SetAttributes(attribute.Int("process.exit.code", exitCode))
+				}
+			}
+
+			End(span, err)
+
+			return value, err
+		}
+
+		tracked = append(tracked, tool)
+	}
+
+	return tracked
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory and renaming it over path, so an interrupted write never
+// leaves a partial file. An existing file keeps its permissions.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	// Clean up unless the rename succeeds
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(temp.Name())
+		}
+	}()
+
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	err = os.Chmod(temp.Name(), perm)
+	if err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	renamed = true
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/jtarchie/outrageous/agent"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// Custom is a project-specific tool declared in .agent/tools.yaml, such as
+// running migrations or regenerating code.
+type Custom struct {
+	// Name is the tool's name, in snake_case so it can be given to --tools.
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Parameters is a JSON schema of the tool's parameters.
+	Parameters map[string]any `yaml:"parameters"`
+	// Command is the command with args to run. Each is a template rendered
+	// with the parameters, e.g. "{{ .direction }}", and is passed as is,
+	// without a shell.
+	Command []string `yaml:"command"`
+	// Timeout stops the command if it runs longer.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+var customName = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// LoadCustom reads the custom tools declared in path. A missing file
+// declares no tools.
+func LoadCustom(path string) ([]Custom, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools %s: %w", path, err)
+	}
+
+	var file struct {
+		Tools []Custom `yaml:"tools"`
+	}
+
+	err = yaml.Unmarshal(contents, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tools %s: %w", path, err)
+	}
+
+	for _, custom := range file.Tools {
+		if !customName.MatchString(custom.Name) {
+			return nil, fmt.Errorf("tool %q in %s must be a snake_case name", custom.Name, path)
+		}
+
+		if custom.Description == "" || len(custom.Command) == 0 {
+			return nil, fmt.Errorf("tool %s in %s needs a description and a command", custom.Name, path)
+		}
+	}
+
+	return file.Tools, nil
+}
+
+// Tool creates the agent tool, running the command in rootPath.
+func (c Custom) Tool(rootPath string) (agent.Tool, error) {
+	parameters := &jsonschema.Definition{Type: jsonschema.Object}
+	if c.Parameters != nil {
+		contents, err := json.Marshal(c.Parameters)
+		if err != nil {
+			return agent.Tool{}, fmt.Errorf("invalid parameters for tool %s: %w", c.Name, err)
+		}
+
+		err = json.Unmarshal(contents, parameters)
+		if err != nil {
+			return agent.Tool{}, fmt.Errorf("invalid parameters for tool %s: %w", c.Name, err)
+		}
+	}
+
+	templates := make([]*template.Template, 0, len(c.Command))
+	for _, arg := range c.Command {
+		tmpl, err := template.New(c.Name).Funcs(sprig.FuncMap()).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return agent.Tool{}, fmt.Errorf("invalid command for tool %s: %w", c.Name, err)
+		}
+
+		templates = append(templates, tmpl)
+	}
+
+	return agent.Tool{
+		Name:        c.Name,
+		Description: c.Description,
+		Parameters:  parameters,
+		Func: func(ctx context.Context, params map[string]any) (any, error) {
+			args := make([]string, 0, len(templates))
+			for _, tmpl := range templates {
+				var arg strings.Builder
+
+				err := tmpl.Execute(&arg, params)
+				if err != nil {
+					return nil, fmt.Errorf("failed to render command for tool %s: %w", c.Name, err)
+				}
+
+				args = append(args, arg.String())
+			}
+
+			commandCtx := ctx
+			if c.Timeout > 0 {
+				var cancel context.CancelFunc
+				commandCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+				defer cancel()
+			}
+
+			result, err := runCommand(commandCtx, rootPath, args)
+			if err != nil && ctx.Err() == nil && errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+				// The model sees a slow command, the run carries on
+				return map[string]any{
+					"status":  "timed_out",
+					"command": args,
+					"error":   fmt.Sprintf("command did not finish within %s", c.Timeout),
+				}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			result["command"] = args
+
+			return result, nil
+		},
+	}, nil
+}
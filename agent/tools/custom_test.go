@@ -0,0 +1,89 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestCustom(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	path := filepath.Join(root, "tools.yaml")
+	err := os.WriteFile(path, []byte(`tools:
+  - name: greet
+    description: Greets someone from the workspace.
+    parameters:
+      type: object
+      properties:
+        name:
+          type: string
+      required: [name]
+    command: [sh, -c, 'echo "$1 from $(basename "$PWD")"', greet, '{{ .name | upper }}']
+  - name: slow
+    description: Takes too long.
+    command: [sleep, "5"]
+    timeout: 50ms
+`), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	declared, err := tools.LoadCustom(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(declared).To(HaveLen(2))
+
+	greet, err := declared[0].Tool(root)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(greet.Parameters.Required).To(Equal([]string{"name"}))
+
+	// Parameters are rendered into args, not interpreted by a shell
+	value, err := greet.Func(context.Background(), map[string]any{"name": "ada; rm -rf /"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(HaveKeyWithValue("stdout", "ADA; RM -RF / from "+filepath.Base(root)+"\n"))
+	assert.Expect(value).To(HaveKeyWithValue("exit_code", 0))
+	assert.Expect(value).To(HaveKey("command"))
+
+	_, err = greet.Func(context.Background(), map[string]any{})
+	assert.Expect(err).To(MatchError(ContainSubstring("failed to render command")))
+
+	slow, err := declared[1].Tool(root)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	started := time.Now()
+	value, err = slow.Func(context.Background(), map[string]any{})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(value).To(HaveKeyWithValue("status", "timed_out"))
+	assert.Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+
+	assert.Expect(toolNames(tools.Select(root, []string{"greet"}, greet, slow))).To(ConsistOf("greet"))
+	assert.Expect(toolNames(tools.Select(root, nil, greet))).To(ContainElements("greet", "read_file"))
+	assert.Expect(tools.SelectReadOnly(root, []string{"greet"})).To(BeEmpty())
+}
+
+func TestLoadCustomInvalid(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+
+	declared, err := tools.LoadCustom(filepath.Join(dir, "missing.yaml"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(declared).To(BeEmpty())
+
+	path := filepath.Join(dir, "tools.yaml")
+	err = os.WriteFile(path, []byte("tools:\n  - name: Run Migrations\n    description: Migrates.\n    command: [migrate]\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools.LoadCustom(path)
+	assert.Expect(err).To(MatchError(ContainSubstring("snake_case")))
+
+	err = os.WriteFile(path, []byte("tools:\n  - name: migrate\n    description: Migrates.\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools.LoadCustom(path)
+	assert.Expect(err).To(MatchError(ContainSubstring("needs a description and a command")))
+}
@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jtarchie/agent/agent/process"
+)
+
+// runGit runs a read-only git command inside rootPath and returns its stdout.
+func runGit(ctx context.Context, rootPath string, args ...string) (string, error) {
+	command := exec.CommandContext(ctx, "git", append([]string{"--no-pager"}, args...)...)
+	command.Dir = rootPath
+	process.Isolate(command)
+
+	stdout, stderr := &strings.Builder{}, &strings.Builder{}
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	err := command.Run()
+	if err != nil {
+		return "", fmt.Errorf("error running git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// resolveGitPath converts path to an absolute path and ensures it is inside rootPath if provided
+func resolveGitPath(rootPath, path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	if rootPath != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(rootPath, path)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path for %s: %w", path, err)
+	}
+
+	if rootPath != "" {
+		absRootPath, err := filepath.Abs(rootPath)
+		if err != nil {
+			return "", fmt.Errorf("error getting absolute path for rootPath %s: %w", rootPath, err)
+		}
+
+		if absPath != absRootPath && !strings.HasPrefix(absPath, ensureTrailingSlash(absRootPath)) {
+			return "", fmt.Errorf("security error: cannot inspect %s outside of root path %s", absPath, absRootPath)
+		}
+	}
+
+	return absPath, nil
+}
+
+// validateGitRef rejects refs that git would interpret as options
+func validateGitRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+
+	return nil
+}
+
+// asJSON renders structured tool output so the model sees JSON rather than Go formatting
+func asJSON(value any) string {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+
+	return string(contents)
+}
@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitBlame represents a tool for finding who last changed a range of lines
+type GitBlame struct {
+	FilePath        string `json:"filePath" description:"Path to the file to blame."`
+	StartLineNumber int    `json:"startLineNumber" description:"First line (1-based) of the range to blame."`
+	EndLineNumber   int    `json:"endLineNumber" description:"Last line (1-based) of the range to blame. Defaults to the start line."`
+
+	RootPath string `json:"-"`
+}
+
+// GitBlameLine represents the last commit that touched a single line
+type GitBlameLine struct {
+	LineNumber int    `json:"lineNumber"`
+	Hash       string `json:"hash"`
+	Author     string `json:"author"`
+	Email      string `json:"email"`
+	Date       string `json:"date"`
+	Summary    string `json:"summary"`
+	Content    string `json:"content"`
+}
+
+// GitBlameResponse represents the complete response from a blame operation
+type GitBlameResponse struct {
+	FilePath string         `json:"filePath"`
+	Lines    []GitBlameLine `json:"lines"`
+}
+
+func (r GitBlameResponse) String() string {
+	return asJSON(r)
+}
+
+func (g GitBlame) Call(ctx context.Context) (any, error) {
+	if g.FilePath == "" {
+		return nil, fmt.Errorf("filePath is required")
+	}
+
+	if g.StartLineNumber < 1 {
+		return nil, fmt.Errorf("start line must be 1 or greater")
+	}
+
+	end := g.EndLineNumber
+	if end == 0 {
+		end = g.StartLineNumber
+	}
+
+	if end < g.StartLineNumber {
+		return nil, fmt.Errorf("end line %d is before start line %d", end, g.StartLineNumber)
+	}
+
+	filePath, err := resolveGitPath(g.RootPath, g.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := runGit(ctx, g.RootPath,
+		"blame",
+		"--porcelain",
+		fmt.Sprintf("-L%d,%d", g.StartLineNumber, end),
+		"--",
+		filePath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting blame: %w", err)
+	}
+
+	response := parseGitBlame(output)
+	response.FilePath = g.FilePath
+
+	return response, nil
+}
+
+// parseGitBlame parses `git blame --porcelain` output, where commit details
+// are only printed the first time a commit appears.
+func parseGitBlame(output string) GitBlameResponse {
+	response := GitBlameResponse{
+		Lines: []GitBlameLine{},
+	}
+
+	commits := map[string]*GitBlameLine{}
+	var current *GitBlameLine
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if current != nil {
+				current.Content = strings.TrimPrefix(line, "\t")
+				response.Lines = append(response.Lines, *current)
+				current = nil
+			}
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) < 2 {
+			continue
+		}
+
+		key, value := fields[0], fields[1]
+
+		if current == nil {
+			// <hash> <original line> <final line> [<group size>]
+			header := strings.Fields(value)
+			if len(key) < 40 || len(header) < 2 {
+				continue
+			}
+
+			lineNumber, _ := strconv.Atoi(header[1])
+			commit, ok := commits[key]
+			if !ok {
+				commit = &GitBlameLine{Hash: key}
+				commits[key] = commit
+			}
+
+			current = &GitBlameLine{}
+			*current = *commit
+			current.LineNumber = lineNumber
+			continue
+		}
+
+		commit := commits[current.Hash]
+
+		switch key {
+		case "author":
+			commit.Author = value
+		case "author-mail":
+			commit.Email = strings.Trim(value, "<>")
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				commit.Date = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+			}
+		case "summary":
+			commit.Summary = value
+		default:
+			continue
+		}
+
+		lineNumber := current.LineNumber
+		*current = *commit
+		current.LineNumber = lineNumber
+	}
+
+	return response
+}
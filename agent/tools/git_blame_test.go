@@ -0,0 +1,63 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestGitBlame(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	testutil.Git(t, repo, "commit", "--quiet", "-am", "say hi")
+
+	payload, err := tools.GitBlame{
+		RootPath:        repo,
+		FilePath:        "main.go",
+		StartLineNumber: 1,
+		EndLineNumber:   4,
+	}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, ok := payload.(tools.GitBlameResponse)
+	assert.Expect(ok).To(BeTrue())
+	assert.Expect(response.FilePath).To(Equal("main.go"))
+	assert.Expect(response.Lines).To(HaveLen(4))
+
+	assert.Expect(response.Lines[0].LineNumber).To(Equal(1))
+	assert.Expect(response.Lines[0].Content).To(Equal("package main"))
+	assert.Expect(response.Lines[0].Summary).To(Equal("initial commit"))
+	assert.Expect(response.Lines[0].Author).To(Equal("Test User"))
+	assert.Expect(response.Lines[0].Email).To(Equal("test@example.com"))
+
+	assert.Expect(response.Lines[1].Summary).To(Equal("initial commit"))
+	assert.Expect(response.Lines[2].Summary).To(Equal("say hi"))
+	assert.Expect(response.Lines[3].LineNumber).To(Equal(4))
+	assert.Expect(response.Lines[3].Content).To(Equal("\tprintln(\"hi\")"))
+	assert.Expect(response.Lines[3].Summary).To(Equal("say hi"))
+	assert.Expect(response.Lines[3].Hash).NotTo(Equal(response.Lines[0].Hash))
+}
+
+func TestGitBlameInvalidRange(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	_, err := tools.GitBlame{RootPath: repo, FilePath: "main.go"}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+
+	_, err = tools.GitBlame{RootPath: repo, FilePath: "main.go", StartLineNumber: 3, EndLineNumber: 1}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+
+	_, err = tools.GitBlame{RootPath: repo, FilePath: "main.go", StartLineNumber: 100}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GitDiff represents a tool for inspecting uncommitted or historical changes
+type GitDiff struct {
+	Path   string `json:"path,omitempty" description:"Optional file or directory to limit the diff to. Defaults to the whole repository."`
+	Staged bool   `json:"staged,omitempty" description:"Show changes staged in the index instead of unstaged working tree changes."`
+	Ref    string `json:"ref,omitempty" description:"Optional commit, branch or tag to compare the working tree against (e.g. 'HEAD~1', 'origin/main')."`
+
+	RootPath string `json:"-"`
+}
+
+// GitDiffFile represents the changes made to a single file
+type GitDiffFile struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"oldPath,omitempty"` // Set when the file was renamed
+	Status    string `json:"status"`            // added, deleted, renamed or modified
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+	Patch     string `json:"patch,omitempty"`
+}
+
+// GitDiffResponse represents the complete response from a diff operation
+type GitDiffResponse struct {
+	Files     []GitDiffFile `json:"files"`
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+}
+
+func (r GitDiffResponse) String() string {
+	return asJSON(r)
+}
+
+func (g GitDiff) Call(ctx context.Context) (any, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--find-renames"}
+
+	if g.Staged {
+		args = append(args, "--cached")
+	}
+
+	if g.Ref != "" {
+		if err := validateGitRef(g.Ref); err != nil {
+			return nil, err
+		}
+		args = append(args, g.Ref)
+	}
+
+	args = append(args, "--")
+
+	path, err := resolveGitPath(g.RootPath, g.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		args = append(args, path)
+	}
+
+	output, err := runGit(ctx, g.RootPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting diff: %w", err)
+	}
+
+	return parseGitDiff(output), nil
+}
+
+// parseGitDiff splits unified diff output into per file patches with line counts
+func parseGitDiff(output string) GitDiffResponse {
+	response := GitDiffResponse{
+		Files: []GitDiffFile{},
+	}
+
+	var current *GitDiffFile
+	var patch strings.Builder
+	inHunk := false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Patch = patch.String()
+		response.Additions += current.Additions
+		response.Deletions += current.Deletions
+		response.Files = append(response.Files, *current)
+		patch.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		trimmed := strings.TrimRight(line, "\n")
+
+		if strings.HasPrefix(trimmed, "diff --git ") {
+			flush()
+			current = &GitDiffFile{Status: "modified"}
+			inHunk = false
+
+			// diff --git a/old b/new
+			if index := strings.LastIndex(trimmed, " b/"); index != -1 {
+				current.Path = trimmed[index+3:]
+			}
+		}
+
+		if current == nil {
+			continue
+		}
+
+		patch.WriteString(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "@@"):
+			inHunk = true
+		case !inHunk && strings.HasPrefix(trimmed, "new file mode"):
+			current.Status = "added"
+		case !inHunk && strings.HasPrefix(trimmed, "deleted file mode"):
+			current.Status = "deleted"
+		case !inHunk && strings.HasPrefix(trimmed, "rename from "):
+			current.Status = "renamed"
+			current.OldPath = strings.TrimPrefix(trimmed, "rename from ")
+		case !inHunk && strings.HasPrefix(trimmed, "rename to "):
+			current.Path = strings.TrimPrefix(trimmed, "rename to ")
+		case !inHunk && strings.HasPrefix(trimmed, "Binary files "):
+			current.Binary = true
+		case inHunk && strings.HasPrefix(trimmed, "+"):
+			current.Additions++
+		case inHunk && strings.HasPrefix(trimmed, "-"):
+			current.Deletions++
+		}
+	}
+
+	flush()
+
+	return response
+}
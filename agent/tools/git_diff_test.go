@@ -0,0 +1,87 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestGitDiff(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	diff := tools.GitDiff{RootPath: repo}
+
+	payload, err := diff.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, ok := payload.(tools.GitDiffResponse)
+	assert.Expect(ok).To(BeTrue())
+	assert.Expect(response.Files).To(HaveLen(1))
+
+	file := response.Files[0]
+	assert.Expect(file.Path).To(Equal("main.go"))
+	assert.Expect(file.Status).To(Equal("modified"))
+	assert.Expect(file.Additions).To(Equal(3))
+	assert.Expect(file.Deletions).To(Equal(1))
+	assert.Expect(file.Patch).To(ContainSubstring(`+	println("hi")`))
+	assert.Expect(response.Additions).To(Equal(3))
+	assert.Expect(response.Deletions).To(Equal(1))
+
+	// Nothing has been staged yet
+	payload, err = tools.GitDiff{RootPath: repo, Staged: true}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(payload.(tools.GitDiffResponse).Files).To(BeEmpty())
+}
+
+func TestGitDiffStagedAndRef(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	err := os.WriteFile(filepath.Join(repo, "other.go"), []byte("package main\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	testutil.Git(t, repo, "add", "other.go")
+
+	payload, err := tools.GitDiff{RootPath: repo, Staged: true}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response := payload.(tools.GitDiffResponse)
+	assert.Expect(response.Files).To(HaveLen(1))
+	assert.Expect(response.Files[0].Path).To(Equal("other.go"))
+	assert.Expect(response.Files[0].Status).To(Equal("added"))
+
+	testutil.Git(t, repo, "commit", "--quiet", "-m", "add other")
+	testutil.Git(t, repo, "rm", "--quiet", "main.go")
+	testutil.Git(t, repo, "commit", "--quiet", "-m", "remove main")
+
+	payload, err = tools.GitDiff{RootPath: repo, Ref: "HEAD~2", Path: "main.go"}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response = payload.(tools.GitDiffResponse)
+	assert.Expect(response.Files).To(HaveLen(1))
+	assert.Expect(response.Files[0].Status).To(Equal("deleted"))
+	assert.Expect(response.Files[0].Deletions).To(Equal(3))
+}
+
+func TestGitDiffRejectsOptionsAndOutsidePaths(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	_, err := tools.GitDiff{RootPath: repo, Ref: "--output=/tmp/pwned"}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+
+	_, err = tools.GitDiff{RootPath: repo, Path: "../../etc/passwd"}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+	assert.Expect(err.Error()).To(ContainSubstring("security error"))
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultGitLogMaxCount = 10
+
+// GitLog represents a tool for listing the commit history of a path
+type GitLog struct {
+	Path     string `json:"path,omitempty" description:"Optional file or directory to show history for. Defaults to the whole repository."`
+	MaxCount int    `json:"maxCount,omitempty" description:"Maximum number of commits to return. Defaults to 10."`
+
+	RootPath string `json:"-"`
+}
+
+// GitCommit represents a single commit in the history
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+// GitLogResponse represents the complete response from a log operation
+type GitLogResponse struct {
+	Commits []GitCommit `json:"commits"`
+}
+
+func (r GitLogResponse) String() string {
+	return asJSON(r)
+}
+
+func (g GitLog) Call(ctx context.Context) (any, error) {
+	maxCount := g.MaxCount
+	if maxCount <= 0 {
+		maxCount = defaultGitLogMaxCount
+	}
+
+	args := []string{
+		"log",
+		"--max-count=" + strconv.Itoa(maxCount),
+		"--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e",
+		"--",
+	}
+
+	path, err := resolveGitPath(g.RootPath, g.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		args = append(args, path)
+	}
+
+	output, err := runGit(ctx, g.RootPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting log: %w", err)
+	}
+
+	return parseGitLog(output), nil
+}
+
+// parseGitLog parses records separated by the ASCII record (0x1e) and unit (0x1f) separators
+func parseGitLog(output string) GitLogResponse {
+	response := GitLogResponse{
+		Commits: []GitCommit{},
+	}
+
+	for _, record := range strings.Split(output, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+
+		fields := strings.Split(record, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+
+		response.Commits = append(response.Commits, GitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,55 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestGitLog(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("# readme\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	testutil.Git(t, repo, "add", "README.md")
+	testutil.Git(t, repo, "commit", "--quiet", "-m", "add readme")
+
+	payload, err := tools.GitLog{RootPath: repo}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, ok := payload.(tools.GitLogResponse)
+	assert.Expect(ok).To(BeTrue())
+	assert.Expect(response.Commits).To(HaveLen(2))
+	assert.Expect(response.Commits[0].Subject).To(Equal("add readme"))
+	assert.Expect(response.Commits[0].Author).To(Equal("Test User"))
+	assert.Expect(response.Commits[0].Email).To(Equal("test@example.com"))
+	assert.Expect(response.Commits[0].Hash).To(HaveLen(40))
+	assert.Expect(response.Commits[1].Subject).To(Equal("initial commit"))
+
+	// Limit to a path
+	payload, err = tools.GitLog{RootPath: repo, Path: "main.go"}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(payload.(tools.GitLogResponse).Commits).To(HaveLen(1))
+
+	// Limit the count
+	payload, err = tools.GitLog{RootPath: repo, MaxCount: 1}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(payload.(tools.GitLogResponse).Commits).To(HaveLen(1))
+}
+
+func TestGitLogOutsideRootPath(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	_, err := tools.GitLog{RootPath: repo, Path: "/etc"}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+	assert.Expect(err.Error()).To(ContainSubstring("security error"))
+}
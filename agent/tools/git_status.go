@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// GitStatus represents a tool for inspecting the working tree status of the repository
+type GitStatus struct {
+	RootPath string `json:"-"`
+}
+
+// GitStatusEntry represents a single changed path in the working tree
+type GitStatusEntry struct {
+	Path      string `json:"path"`
+	OrigPath  string `json:"origPath,omitempty"` // Set for renames and copies
+	Staged    string `json:"staged"`             // Index status, e.g. "modified", "added"
+	Unstaged  string `json:"unstaged"`           // Working tree status
+	Untracked bool   `json:"untracked"`
+	Conflict  bool   `json:"conflict"`
+}
+
+// GitStatusResponse represents the complete response from a status operation
+type GitStatusResponse struct {
+	Branch   string           `json:"branch"`
+	Upstream string           `json:"upstream,omitempty"`
+	Ahead    int              `json:"ahead"`
+	Behind   int              `json:"behind"`
+	Clean    bool             `json:"clean"`
+	Entries  []GitStatusEntry `json:"entries"`
+}
+
+func (r GitStatusResponse) String() string {
+	return asJSON(r)
+}
+
+func (g GitStatus) Call(ctx context.Context) (any, error) {
+	output, err := runGit(ctx, g.RootPath, "status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitStatus(output), nil
+}
+
+// parseGitStatus parses the NUL separated output of `git status --porcelain=v2 --branch -z`
+func parseGitStatus(output string) GitStatusResponse {
+	response := GitStatusResponse{
+		Entries: []GitStatusEntry{},
+	}
+
+	records := strings.Split(output, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" {
+			continue
+		}
+
+		switch record[0] {
+		case '#':
+			parseGitStatusHeader(record, &response)
+		case '1':
+			// 1 XY sub mH mI mW hH hI path
+			fields := strings.SplitN(record, " ", 9)
+			if len(fields) == 9 {
+				response.Entries = append(response.Entries, newGitStatusEntry(fields[1], fields[8]))
+			}
+		case '2':
+			// 2 XY sub mH mI mW hH hI Xscore path, followed by the original path as its own record
+			fields := strings.SplitN(record, " ", 10)
+			if len(fields) == 10 {
+				entry := newGitStatusEntry(fields[1], fields[9])
+				if i+1 < len(records) {
+					entry.OrigPath = records[i+1]
+					i++
+				}
+				response.Entries = append(response.Entries, entry)
+			}
+		case 'u':
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			fields := strings.SplitN(record, " ", 11)
+			if len(fields) == 11 {
+				entry := newGitStatusEntry(fields[1], fields[10])
+				entry.Conflict = true
+				response.Entries = append(response.Entries, entry)
+			}
+		case '?':
+			response.Entries = append(response.Entries, GitStatusEntry{
+				Path:      strings.TrimPrefix(record, "? "),
+				Untracked: true,
+			})
+		}
+	}
+
+	response.Clean = len(response.Entries) == 0
+
+	return response
+}
+
+// parseGitStatusHeader handles the branch headers emitted with --branch
+func parseGitStatusHeader(record string, response *GitStatusResponse) {
+	fields := strings.Fields(record)
+	if len(fields) < 3 {
+		return
+	}
+
+	switch fields[1] {
+	case "branch.head":
+		response.Branch = fields[2]
+	case "branch.upstream":
+		response.Upstream = fields[2]
+	case "branch.ab":
+		if len(fields) == 4 {
+			response.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+			response.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+		}
+	}
+}
+
+func newGitStatusEntry(xy, path string) GitStatusEntry {
+	entry := GitStatusEntry{Path: path}
+	if len(xy) == 2 {
+		entry.Staged = gitStatusName(xy[0])
+		entry.Unstaged = gitStatusName(xy[1])
+	}
+
+	return entry
+}
+
+// gitStatusName converts a porcelain status letter into a readable name
+func gitStatusName(code byte) string {
+	switch code {
+	case 'M':
+		return "modified"
+	case 'T':
+		return "type-changed"
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	case 'U':
+		return "unmerged"
+	default:
+		return "unmodified"
+	}
+}
@@ -0,0 +1,78 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestGitStatus(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	status := tools.GitStatus{RootPath: repo}
+
+	payload, err := status.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, ok := payload.(tools.GitStatusResponse)
+	assert.Expect(ok).To(BeTrue())
+	assert.Expect(response.Branch).To(Equal("main"))
+	assert.Expect(response.Clean).To(BeTrue())
+	assert.Expect(response.Entries).To(BeEmpty())
+
+	// Modify, stage and add files
+	err = os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	err = os.WriteFile(filepath.Join(repo, "staged.go"), []byte("package main\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	testutil.Git(t, repo, "add", "staged.go")
+
+	err = os.WriteFile(filepath.Join(repo, "new file.txt"), []byte("hello\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	payload, err = status.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response = payload.(tools.GitStatusResponse)
+	assert.Expect(response.Clean).To(BeFalse())
+	assert.Expect(response.Entries).To(ConsistOf(
+		tools.GitStatusEntry{Path: "main.go", Staged: "unmodified", Unstaged: "modified"},
+		tools.GitStatusEntry{Path: "staged.go", Staged: "added", Unstaged: "unmodified"},
+		tools.GitStatusEntry{Path: "new file.txt", Untracked: true},
+	))
+	assert.Expect(response.String()).To(ContainSubstring(`"path":"new file.txt"`))
+}
+
+func TestGitStatusRename(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	testutil.Git(t, repo, "mv", "main.go", "app.go")
+
+	payload, err := tools.GitStatus{RootPath: repo}.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response := payload.(tools.GitStatusResponse)
+	assert.Expect(response.Entries).To(ConsistOf(
+		tools.GitStatusEntry{Path: "app.go", OrigPath: "main.go", Staged: "renamed", Unstaged: "unmodified"},
+	))
+}
+
+func TestGitStatusOutsideRepository(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tmpDir, err := os.MkdirTemp("", "notrepo")
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	_, err = tools.GitStatus{RootPath: tmpDir}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,7 +18,13 @@ type InsertEditIntoFile struct {
 }
 
 func (i InsertEditIntoFile) Call(ctx context.Context) (any, error) {
-	filePath, err := filepath.Abs(i.FilePath)
+	// Relative paths are inside the root, not the process's directory
+	filePath := i.FilePath
+	if i.RootPath != "" && !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(i.RootPath, filePath)
+	}
+
+	filePath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error getting absolute path for %s: %w", i.FilePath, err)
 	}
@@ -38,12 +45,17 @@ func (i InsertEditIntoFile) Call(ctx context.Context) (any, error) {
 		}
 	}
 
+	filePath, err = resolveSymlink(filePath, i.RootPath)
+	if err != nil {
+		return nil, err
+	}
+
 	err = os.MkdirAll(filepath.Dir(filePath), 0755) // Ensure the directory exists
 	if err != nil {
 		return nil, fmt.Errorf("error creating directories for %s: %w", i.FilePath, err)
 	}
 
-	err = os.WriteFile(filePath, []byte(i.Content), 0644)
+	err = writeFileAtomic(filePath, []byte(i.Content), 0644)
 	if err != nil {
 		return nil, fmt.Errorf("error writing to file %s: %w", i.FilePath, err)
 	}
@@ -52,3 +64,34 @@ func (i InsertEditIntoFile) Call(ctx context.Context) (any, error) {
 		"status": "completed",
 	}, nil
 }
+
+// resolveSymlink returns the file a symlink at filePath points at, so the edit
+// replaces the target instead of the link. The target must stay inside
+// rootPath when one is given.
+func resolveSymlink(filePath, rootPath string) (string, error) {
+	info, err := os.Lstat(filePath)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return filePath, nil
+	}
+
+	target, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving symlink %s: %w", filePath, err)
+	}
+
+	if rootPath != "" {
+		root, err := filepath.Abs(rootPath)
+		if err == nil {
+			root, err = filepath.EvalSymlinks(root)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error resolving rootPath %s: %w", rootPath, err)
+		}
+
+		if !strings.HasPrefix(target, ensureTrailingSlash(root)) {
+			return "", fmt.Errorf("security error: cannot write to %s through %s outside of root path %s", target, filePath, root)
+		}
+	}
+
+	return target, nil
+}
@@ -107,3 +107,83 @@ func TestRootPathSecurity(t *testing.T) {
 	assert.Expect(err).To(HaveOccurred())
 	assert.Expect(os.IsNotExist(err)).To(BeTrue())
 }
+
+func TestInsertEditIntoFileReplacesAtomically(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.sh")
+	err := os.WriteFile(path, []byte("#!/bin/sh\necho old\n"), 0755)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	inserter := tools.InsertEditIntoFile{
+		FilePath: path,
+		Content:  "#!/bin/sh\necho new\n",
+		RootPath: dir,
+	}
+
+	_, err = inserter.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	contents, err := os.ReadFile(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("#!/bin/sh\necho new\n"))
+
+	info, err := os.Stat(path)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(entries).To(HaveLen(1))
+}
+
+func TestInsertEditIntoFileThroughSymlink(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "config", "settings.yml")
+	link := filepath.Join(dir, "settings.yml")
+
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	assert.Expect(err).NotTo(HaveOccurred())
+	err = os.WriteFile(target, []byte("old: true\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	err = os.Symlink(filepath.Join("config", "settings.yml"), link)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	inserter := tools.InsertEditIntoFile{
+		FilePath: link,
+		Content:  "new: true\n",
+		RootPath: dir,
+	}
+
+	_, err = inserter.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// The link is kept and its target has the new contents
+	info, err := os.Lstat(link)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+
+	contents, err := os.ReadFile(target)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("new: true\n"))
+
+	// A link cannot be used to write outside the root
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	err = os.WriteFile(outside, []byte("outside\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+	err = os.Symlink(outside, filepath.Join(dir, "escape.txt"))
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	inserter.FilePath = filepath.Join(dir, "escape.txt")
+
+	_, err = inserter.Call(context.Background())
+	assert.Expect(err).To(MatchError(ContainSubstring("security error")))
+
+	contents, err = os.ReadFile(outside)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("outside\n"))
+}
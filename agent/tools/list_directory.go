@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultListDirectoryDepth = 1
+	maxListDirectoryDepth     = 5
+	maxListDirectoryEntries   = 500
+)
+
+// ListDirectory represents a tool for listing the contents of a directory
+type ListDirectory struct {
+	Directory string `json:"directory" description:"The directory to list. Defaults to current directory if not specified."`
+	Depth     int    `json:"depth,omitempty" description:"How many levels of subdirectories to include, from 1 to 5. Defaults to 1."`
+
+	RootPath string `json:"-"`
+}
+
+// DirectoryEntry represents a single file or directory in a listing
+type DirectoryEntry struct {
+	Path string `json:"path"` // Relative to the listed directory
+	Type string `json:"type"` // "file" or "directory"
+	Size int64  `json:"size,omitempty"`
+}
+
+// ListDirectoryResponse represents the complete response from a listing
+type ListDirectoryResponse struct {
+	Directory string           `json:"directory"`
+	Entries   []DirectoryEntry `json:"entries"`
+	Truncated bool             `json:"truncated"`
+}
+
+func (r ListDirectoryResponse) String() string {
+	return asJSON(r)
+}
+
+func (l ListDirectory) Call(ctx context.Context) (any, error) {
+	directory := l.Directory
+	if directory == "" {
+		directory = "."
+	}
+
+	// Relative directories are inside the root, not the process's directory
+	dirPath := directory
+	if l.RootPath != "" && !filepath.IsAbs(dirPath) {
+		dirPath = filepath.Join(l.RootPath, dirPath)
+	}
+
+	dirPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting absolute path for directory %s: %w", directory, err)
+	}
+
+	// Security check - ensure directory is inside rootPath if provided
+	if l.RootPath != "" {
+		rootPath, err := filepath.Abs(l.RootPath)
+		if err != nil {
+			return nil, fmt.Errorf("error getting absolute path for rootPath %s: %w", l.RootPath, err)
+		}
+
+		// Make sure paths have trailing slashes for proper prefix checking
+		rootPathWithSlash := ensureTrailingSlash(rootPath)
+		dirPathWithSlash := ensureTrailingSlash(dirPath)
+
+		if !strings.HasPrefix(dirPathWithSlash, rootPathWithSlash) {
+			return nil, fmt.Errorf("security error: cannot list %s outside of root path %s", dirPath, rootPath)
+		}
+	}
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", directory)
+	}
+
+	depth := l.Depth
+	if depth <= 0 {
+		depth = defaultListDirectoryDepth
+	}
+	if depth > maxListDirectoryDepth {
+		depth = maxListDirectoryDepth
+	}
+
+	response := ListDirectoryResponse{
+		Directory: directory,
+		Entries:   []DirectoryEntry{},
+	}
+
+	err = filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if path == dirPath {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if len(response.Entries) == maxListDirectoryEntries {
+			response.Truncated = true
+			return filepath.SkipAll
+		}
+
+		level := strings.Count(relativePath, string(filepath.Separator)) + 1
+
+		if entry.IsDir() {
+			response.Entries = append(response.Entries, DirectoryEntry{
+				Path: relativePath + "/",
+				Type: "directory",
+			})
+
+			if level >= depth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return nil // Skip files that disappeared while listing
+		}
+
+		response.Entries = append(response.Entries, DirectoryEntry{
+			Path: relativePath,
+			Type: "file",
+			Size: fileInfo.Size(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing directory: %w", err)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,94 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestListDirectory(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tmpDir, err := os.MkdirTemp("", "list_test")
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	for _, name := range []string{"main.go", "lib/util.go", "lib/deep/nested.go", ".hidden/secret.txt", ".env"} {
+		path := filepath.Join(tmpDir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		assert.Expect(err).NotTo(HaveOccurred())
+		err = os.WriteFile(path, []byte("content"), 0644)
+		assert.Expect(err).NotTo(HaveOccurred())
+	}
+
+	lister := tools.ListDirectory{
+		Directory: tmpDir,
+		RootPath:  tmpDir,
+	}
+
+	payload, err := lister.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response, ok := payload.(tools.ListDirectoryResponse)
+	assert.Expect(ok).To(BeTrue())
+	assert.Expect(response.Truncated).To(BeFalse())
+	assert.Expect(response.Entries).To(ConsistOf(
+		tools.DirectoryEntry{Path: "lib/", Type: "directory"},
+		tools.DirectoryEntry{Path: "main.go", Type: "file", Size: 7},
+	))
+
+	lister.Depth = 3
+	payload, err = lister.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response = payload.(tools.ListDirectoryResponse)
+	assert.Expect(response.Entries).To(ConsistOf(
+		tools.DirectoryEntry{Path: "lib/", Type: "directory"},
+		tools.DirectoryEntry{Path: "lib/deep/", Type: "directory"},
+		tools.DirectoryEntry{Path: "lib/deep/nested.go", Type: "file", Size: 7},
+		tools.DirectoryEntry{Path: "lib/util.go", Type: "file", Size: 7},
+		tools.DirectoryEntry{Path: "main.go", Type: "file", Size: 7},
+	))
+
+	// Relative directories are resolved inside the root
+	lister = tools.ListDirectory{
+		Directory: "lib",
+		RootPath:  tmpDir,
+	}
+
+	payload, err = lister.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	response = payload.(tools.ListDirectoryResponse)
+	assert.Expect(response.Directory).To(Equal("lib"))
+	assert.Expect(response.Entries).To(ConsistOf(
+		tools.DirectoryEntry{Path: "deep/", Type: "directory"},
+		tools.DirectoryEntry{Path: "util.go", Type: "file", Size: 7},
+	))
+}
+
+func TestListDirectoryErrors(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tmpDir, err := os.MkdirTemp("", "list_test")
+	assert.Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	_, err = tools.ListDirectory{Directory: filepath.Join(tmpDir, ".."), RootPath: tmpDir}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+	assert.Expect(err.Error()).To(ContainSubstring("security error"))
+
+	_, err = tools.ListDirectory{Directory: filepath.Join(tmpDir, "missing")}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+
+	file := filepath.Join(tmpDir, "file.txt")
+	err = os.WriteFile(file, []byte("content"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	_, err = tools.ListDirectory{Directory: file}.Call(context.Background())
+	assert.Expect(err).To(HaveOccurred())
+}
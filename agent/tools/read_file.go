@@ -17,7 +17,13 @@ type ReadFile struct {
 }
 
 func (r ReadFile) Call(ctx context.Context) (any, error) {
-	filePath, err := filepath.Abs(r.FilePath)
+	// Relative paths are inside the root, not the process's directory
+	filePath := r.FilePath
+	if r.RootPath != "" && !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(r.RootPath, filePath)
+	}
+
+	filePath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error getting absolute path for %s: %w", r.FilePath, err)
 	}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jtarchie/outrageous/agent"
+)
+
+// ReportPlanInvalid represents a tool for stopping execution when the plan
+// cannot be followed, so it can be revised
+type ReportPlanInvalid struct {
+	Step     string `json:"step" description:"The plan step that cannot be completed, e.g. 'Step 3: Run the integration tests'."`
+	Reason   string `json:"reason" description:"Why the step cannot be completed as written, e.g. a file, function or command the plan assumes does not exist."`
+	Findings string `json:"findings,omitempty" description:"What you learned that the revised plan should take into account."`
+}
+
+// PlanInvalidError is returned by ReportPlanInvalid to stop the executing agent
+type PlanInvalidError struct {
+	Step     string
+	Reason   string
+	Findings string
+}
+
+func (e *PlanInvalidError) Error() string {
+	message := "plan invalid"
+	if e.Step != "" {
+		message += " at " + e.Step
+	}
+
+	return message + ": " + e.Reason
+}
+
+// String renders the report for the planning agent.
+func (e *PlanInvalidError) String() string {
+	var report strings.Builder
+
+	if e.Step != "" {
+		fmt.Fprintf(&report, "Step: %s\n", e.Step)
+	}
+
+	fmt.Fprintf(&report, "Reason: %s\n", e.Reason)
+
+	if e.Findings != "" {
+		fmt.Fprintf(&report, "Findings: %s\n", e.Findings)
+	}
+
+	return report.String()
+}
+
+func (r ReportPlanInvalid) Call(ctx context.Context) (any, error) {
+	if strings.TrimSpace(r.Reason) == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	return nil, &PlanInvalidError{
+		Step:     r.Step,
+		Reason:   r.Reason,
+		Findings: r.Findings,
+	}
+}
+
+// MustReportPlanInvalid creates the tool the executing agent uses to hand
+// control back to the planner.
+func MustReportPlanInvalid() agent.Tool {
+	return agent.MustWrapStruct(
+		"Report that the plan cannot be followed and stop executing it. Only use this when a step's assumptions are wrong and cannot be worked around, such as a file, function or command the plan relies on not existing. Work already done is kept, and the plan is revised for the remaining work.",
+		ReportPlanInvalid{},
+	)
+}
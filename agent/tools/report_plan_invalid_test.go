@@ -0,0 +1,34 @@
+package tools_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/tools"
+	. "github.com/onsi/gomega"
+)
+
+func TestReportPlanInvalid(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tool := tools.MustReportPlanInvalid()
+	assert.Expect(tool.Name).To(Equal("report_plan_invalid"))
+
+	_, err := tool.Func(context.Background(), map[string]any{
+		"step":     "Step 2: Update config/settings.yaml",
+		"reason":   "config/settings.yaml does not exist",
+		"findings": "Settings live in config.toml",
+	})
+	assert.Expect(err).To(HaveOccurred())
+
+	var invalid *tools.PlanInvalidError
+	assert.Expect(errors.As(err, &invalid)).To(BeTrue())
+	assert.Expect(invalid.Reason).To(Equal("config/settings.yaml does not exist"))
+	assert.Expect(invalid.String()).To(ContainSubstring("Findings: Settings live in config.toml"))
+	assert.Expect(invalid.Error()).To(Equal("plan invalid at Step 2: Update config/settings.yaml: config/settings.yaml does not exist"))
+
+	_, err = tool.Func(context.Background(), map[string]any{"step": "Step 1"})
+	assert.Expect(err).To(MatchError(ContainSubstring("reason is required")))
+	assert.Expect(errors.As(err, &invalid)).To(BeFalse())
+}
@@ -3,13 +3,19 @@ package tools
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/jtarchie/agent/agent/process"
+	"github.com/jtarchie/agent/agent/telemetry"
 )
 
 type RunInTerminal struct {
 	Command     []string `json:"command" description:"Command with args to run in the terminal."`
 	Explanation string   `json:"explanation" description:"Please provide a brief explanation of why this command needs to run."`
+
+	RootPath string `json:"-"`
 }
 
 func (r RunInTerminal) Call(ctx context.Context) (any, error) {
@@ -17,17 +23,32 @@ func (r RunInTerminal) Call(ctx context.Context) (any, error) {
 		return nil, fmt.Errorf("command is required")
 	}
 
-	command := exec.CommandContext(ctx, r.Command[0])
+	return runCommand(ctx, r.RootPath, r.Command)
+}
+
+// runCommand runs args in dir, or the working directory when empty. The
+// command runs in its own process group, which is killed when ctx is done.
+func runCommand(ctx context.Context, dir string, args []string) (map[string]any, error) {
+	command := exec.CommandContext(ctx, args[0])
 
-	if len(r.Command) > 1 {
-		command = exec.CommandContext(ctx, r.Command[0], r.Command[1:]...)
+	if len(args) > 1 {
+		command = exec.CommandContext(ctx, args[0], args[1:]...)
 	}
 
+	process.Isolate(command)
+	command.Dir = dir
+
+	// Let commands that are traced continue the agent's trace
+	command.Env = append(os.Environ(), telemetry.Environ(ctx)...)
+
 	stdout, stderr := &strings.Builder{}, &strings.Builder{}
 	command.Stdout = stdout
 	command.Stderr = stderr
 
 	err := command.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("command stopped: %w", ctx.Err())
+	}
 	if err != nil {
 		if _, ok := err.(*exec.ExitError); !ok {
 			return nil, fmt.Errorf("error running command: %w", err)
@@ -3,7 +3,12 @@ package tools_test
 import (
 	"context"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jtarchie/agent/agent/tools"
 	. "github.com/onsi/gomega"
@@ -35,6 +40,22 @@ func TestRunInTerminal(t *testing.T) {
 	}))
 }
 
+func TestRunInTerminalRunsInRootPath(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	rootPath, err := filepath.EvalSymlinks(t.TempDir())
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	runner := tools.RunInTerminal{
+		Command:  []string{"pwd"},
+		RootPath: rootPath,
+	}
+
+	payload, err := runner.Call(context.Background())
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(payload).To(HaveKeyWithValue("stdout", rootPath+"\n"))
+}
+
 func TestRunInTerminalErroredCommand(t *testing.T) {
 	assert := NewGomegaWithT(t)
 
@@ -56,3 +77,34 @@ func TestRunInTerminalMissingCommand(t *testing.T) {
 	_, err := runner.Call(context.Background())
 	assert.Expect(err).To(HaveOccurred())
 }
+
+func TestRunInTerminalCancelKillsChildren(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	runner := tools.RunInTerminal{
+		Command: []string{"sh", "-c", "sleep 30 & echo $! > " + pidFile + "; wait"},
+	}
+
+	started := time.Now()
+	_, err := runner.Call(ctx)
+	assert.Expect(err).To(MatchError(context.Canceled))
+	assert.Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+
+	contents, err := os.ReadFile(pidFile)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	// The background sleep was killed with its parent's process group. It
+	// is either gone or a zombie waiting for init to reap it.
+	assert.Eventually(func() string {
+		output, _ := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+		return strings.TrimSpace(string(output))
+	}).Should(Or(BeEmpty(), HavePrefix("Z")))
+}
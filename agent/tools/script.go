@@ -14,7 +14,9 @@ type RuntimeInfo struct {
 	Version string
 }
 
-func MustScript() agent.Tool {
+// MustScript creates the tool running source code with an available
+// runtime, in rootPath.
+func MustScript(rootPath string) agent.Tool {
 	availableRuntimes := detectAvailableRuntimes()
 
 	description := "This tool lets you execute source code directly by providing both the code and the command to run it. It's useful when precise control over execution is needed. Only features from the language's standard library (for the specified version) should be used—external dependencies are not installed or supported."
@@ -31,7 +33,9 @@ func MustScript() agent.Tool {
 
 	return agent.MustWrapStruct(
 		description,
-		RunInTerminal{},
+		RunInTerminal{
+			RootPath: rootPath,
+		},
 	)
 }
 
@@ -53,6 +53,11 @@ func (s SearchFiles) Call(ctx context.Context) (any, error) {
 		directory = "."
 	}
 
+	// Relative directories are inside the root, not the process's directory
+	if s.RootPath != "" && !filepath.IsAbs(directory) {
+		directory = filepath.Join(s.RootPath, directory)
+	}
+
 	// Security check - ensure directory is inside rootPath if provided
 	if s.RootPath != "" {
 		dirPath, err := filepath.Abs(directory)
@@ -1,13 +1,36 @@
 package tools
 
 import (
+	"log/slog"
+
 	"github.com/iancoleman/strcase"
 	"github.com/jtarchie/outrageous/agent"
 	"github.com/samber/lo"
 )
 
-// selectTools determines which tools to include based on CLI input
-func Select(rootPath string, requestedTools []string) []agent.Tool {
+// readOnlyTools are the tools that can inspect the workspace without
+// modifying it or running arbitrary commands
+var readOnlyTools = []string{
+	"read_file",
+	"search_files",
+	"list_directory",
+	"git_status",
+	"git_diff",
+	"git_log",
+	"git_blame",
+}
+
+// SelectReadOnly determines which read-only tools to include based on CLI
+// input. Requested tools that could modify the workspace are never included.
+func SelectReadOnly(rootPath string, requestedTools []string) []agent.Tool {
+	return lo.Filter(Select(rootPath, requestedTools), func(tool agent.Tool, _ int) bool {
+		return lo.Contains(readOnlyTools, tool.Name)
+	})
+}
+
+// Select determines which tools to include based on CLI input. Custom tools
+// are included like the built-in ones, except those whose names are taken.
+func Select(rootPath string, requestedTools []string, custom ...agent.Tool) []agent.Tool {
 	availableTools := []agent.Tool{
 		agent.MustWrapStruct(
 			"Read specific lines from a file in the codebase. Use this tool when you know the file path and want to inspect only a section of the file to avoid loading large files in full. This is useful for reviewing implementations, extracting function or class definitions, or confirming assumptions about code structure.",
@@ -17,7 +40,9 @@ func Select(rootPath string, requestedTools []string) []agent.Tool {
 		),
 		agent.MustWrapStruct(
 			"Run a command in the terminal. Use this tool when you need to execute a command that is not directly related to the codebase, such as running tests, building the project, or executing scripts.",
-			RunInTerminal{},
+			RunInTerminal{
+				RootPath: rootPath,
+			},
 		),
 		agent.MustWrapStruct(
 			"Insert or edit a file in the codebase. Use this tool when you need to apply changes to a file based on the provided unified diff. This is useful for making code modifications, applying patches, or updating configurations.",
@@ -31,7 +56,46 @@ func Select(rootPath string, requestedTools []string) []agent.Tool {
 				RootPath: rootPath,
 			},
 		),
-		MustScript(),
+		agent.MustWrapStruct(
+			"List the files and subdirectories of a directory in the codebase, with file sizes. Use this tool to explore the project structure before reading or searching specific files. Hidden files and directories are skipped.",
+			ListDirectory{
+				RootPath: rootPath,
+			},
+		),
+		agent.MustWrapStruct(
+			"Show the git status of the working tree. Returns the current branch, its upstream tracking state, and every staged, unstaged, untracked or conflicted path as structured data. Use this to learn what has already changed before making edits.",
+			GitStatus{
+				RootPath: rootPath,
+			},
+		),
+		agent.MustWrapStruct(
+			"Show changes as a structured git diff. Returns each changed file with its status, added and deleted line counts, and the unified patch. Can show unstaged changes, staged changes, or changes relative to a commit, branch or tag, optionally limited to a path.",
+			GitDiff{
+				RootPath: rootPath,
+			},
+		),
+		agent.MustWrapStruct(
+			"Show the recent commit history for the repository or a specific file or directory. Returns hash, author, date and subject for each commit. Use this to understand why and when code changed.",
+			GitLog{
+				RootPath: rootPath,
+			},
+		),
+		agent.MustWrapStruct(
+			"Show who last changed each line in a range of a file. Returns the commit hash, author, date, commit summary and content for every line. Use this to understand the ownership and history of specific code.",
+			GitBlame{
+				RootPath: rootPath,
+			},
+		),
+		MustScript(rootPath),
+	}
+
+	for _, tool := range custom {
+		if lo.ContainsBy(availableTools, func(available agent.Tool) bool { return available.Name == tool.Name }) {
+			slog.Warn("tools.custom_name_taken", "tool", tool.Name)
+			continue
+		}
+
+		availableTools = append(availableTools, tool)
 	}
 
 	// If no specific tools requested, include all available tools
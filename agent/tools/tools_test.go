@@ -0,0 +1,37 @@
+package tools_test
+
+import (
+	"testing"
+
+	"github.com/jtarchie/agent/agent/tools"
+	"github.com/jtarchie/outrageous/agent"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+)
+
+func toolNames(selected []agent.Tool) []string {
+	return lo.Map(selected, func(tool agent.Tool, _ int) string { return tool.Name })
+}
+
+func TestSelect(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(toolNames(tools.Select("", []string{"ReadFile", "git_status"}))).To(ConsistOf("read_file", "git_status"))
+	assert.Expect(toolNames(tools.Select("", nil))).To(ContainElements("insert_edit_into_file", "run_in_terminal", "list_directory"))
+}
+
+func TestSelectReadOnly(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	assert.Expect(toolNames(tools.SelectReadOnly("", nil))).To(ConsistOf(
+		"read_file",
+		"search_files",
+		"list_directory",
+		"git_status",
+		"git_diff",
+		"git_log",
+		"git_blame",
+	))
+
+	assert.Expect(toolNames(tools.SelectReadOnly("", []string{"read_file", "insert_edit_into_file", "run_in_terminal"}))).To(ConsistOf("read_file"))
+}
@@ -0,0 +1,230 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned once a run has used more than its cost or
+// token budget.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Tokens counts the tokens used by model requests and what they cost.
+type Tokens struct {
+	Requests   int `json:"requests"`
+	Prompt     int `json:"prompt_tokens"`
+	Completion int `json:"completion_tokens"`
+	// Cached is the part of Prompt read from the provider's prompt cache.
+	Cached int     `json:"cached_tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// Total returns the number of prompt and completion tokens.
+func (t Tokens) Total() int {
+	return t.Prompt + t.Completion
+}
+
+func (t Tokens) add(other Tokens) Tokens {
+	return Tokens{
+		Requests:   t.Requests + other.Requests,
+		Prompt:     t.Prompt + other.Prompt,
+		Completion: t.Completion + other.Completion,
+		Cached:     t.Cached + other.Cached,
+		Cost:       t.Cost + other.Cost,
+	}
+}
+
+func (t Tokens) String() string {
+	text := fmt.Sprintf("%d requests, %d prompt (%d cached) + %d completion tokens", t.Requests, t.Prompt, t.Cached, t.Completion)
+	if t.Cost > 0 {
+		text += fmt.Sprintf(", $%.4f", t.Cost)
+	}
+
+	return text
+}
+
+// Price is what a model costs in dollars per million tokens.
+type Price struct {
+	Input       float64
+	Output      float64
+	CachedInput float64
+}
+
+// Cost returns the price of tokens. Cached tokens are charged at the input
+// price when no cached price is set.
+func (p Price) Cost(tokens Tokens) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+
+	uncached := tokens.Prompt - tokens.Cached
+
+	return (float64(uncached)*p.Input +
+		float64(tokens.Cached)*cachedPrice +
+		float64(tokens.Completion)*p.Output) / 1_000_000
+}
+
+// Limits stop a run once it has used too much. Zero means no limit.
+type Limits struct {
+	// MaxCost is the most a session may cost, in dollars.
+	MaxCost float64
+	// MaxTokens is the most prompt and completion tokens a session may use.
+	MaxTokens int
+}
+
+// Summary is the usage of a session, broken down by agent, batch file and
+// model.
+type Summary struct {
+	Session Tokens            `json:"session"`
+	Agents  map[string]Tokens `json:"agents,omitempty"`
+	Files   map[string]Tokens `json:"files,omitempty"`
+	Models  map[string]Tokens `json:"models,omitempty"`
+	// Unpriced lists models used without a configured price, so the cost
+	// is incomplete.
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+func (s Summary) String() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "usage: %s\n", s.Session)
+
+	for _, name := range slices.Sorted(maps.Keys(s.Agents)) {
+		fmt.Fprintf(&builder, "  agent %s: %s\n", name, s.Agents[name])
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.Files)) {
+		fmt.Fprintf(&builder, "  file %s: %s\n", name, s.Files[name])
+	}
+
+	if len(s.Unpriced) > 0 {
+		fmt.Fprintf(&builder, "  no price configured for %s\n", strings.Join(s.Unpriced, ", "))
+	}
+
+	return builder.String()
+}
+
+// Tracker aggregates the usage of a session. It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	prices  map[string]Price
+	limits  Limits
+	summary Summary
+}
+
+// NewTracker creates a tracker pricing each model from prices.
+func NewTracker(prices map[string]Price, limits Limits) *Tracker {
+	return &Tracker{
+		prices: prices,
+		limits: limits,
+		summary: Summary{
+			Agents: map[string]Tokens{},
+			Files:  map[string]Tokens{},
+			Models: map[string]Tokens{},
+		},
+	}
+}
+
+// Record adds a model response's usage, attributed to agent and file.
+func (t *Tracker) Record(agent, file, model string, tokens Tokens) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if price, ok := t.prices[model]; ok {
+		tokens.Cost = price.Cost(tokens)
+	} else if !slices.Contains(t.summary.Unpriced, model) {
+		t.summary.Unpriced = append(t.summary.Unpriced, model)
+	}
+
+	t.summary.Session = t.summary.Session.add(tokens)
+	t.summary.Models[model] = t.summary.Models[model].add(tokens)
+
+	if agent != "" {
+		t.summary.Agents[agent] = t.summary.Agents[agent].add(tokens)
+	}
+
+	if file != "" {
+		t.summary.Files[file] = t.summary.Files[file].add(tokens)
+	}
+}
+
+// Summary returns a copy of the usage so far.
+func (t *Tracker) Summary() Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Summary{
+		Session:  t.summary.Session,
+		Agents:   maps.Clone(t.summary.Agents),
+		Files:    maps.Clone(t.summary.Files),
+		Models:   maps.Clone(t.summary.Models),
+		Unpriced: slices.Clone(t.summary.Unpriced),
+	}
+}
+
+// Check returns ErrBudgetExceeded when the session is over its limits.
+func (t *Tracker) Check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	session := t.summary.Session
+
+	if t.limits.MaxCost > 0 && session.Cost > t.limits.MaxCost {
+		return fmt.Errorf("%w: spent $%.4f of $%.4f", ErrBudgetExceeded, session.Cost, t.limits.MaxCost)
+	}
+
+	if t.limits.MaxTokens > 0 && session.Total() > t.limits.MaxTokens {
+		return fmt.Errorf("%w: used %d of %d tokens", ErrBudgetExceeded, session.Total(), t.limits.MaxTokens)
+	}
+
+	return nil
+}
+
+type trackerKey struct{}
+
+type fileKey struct{}
+
+// WithTracker returns a context whose model usage is recorded by tracker.
+func WithTracker(ctx context.Context, tracker *Tracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, tracker)
+}
+
+// WithFile returns a context whose usage is attributed to the batch file.
+func WithFile(ctx context.Context, file string) context.Context {
+	return context.WithValue(ctx, fileKey{}, file)
+}
+
+// FromContext returns the context's tracker, or nil.
+func FromContext(ctx context.Context) *Tracker {
+	tracker, _ := ctx.Value(trackerKey{}).(*Tracker)
+	return tracker
+}
+
+// Record adds usage to the context's tracker, attributed to the context's
+// batch file.
+func Record(ctx context.Context, agent, model string, tokens Tokens) {
+	tracker := FromContext(ctx)
+	if tracker == nil {
+		return
+	}
+
+	file, _ := ctx.Value(fileKey{}).(string)
+	tracker.Record(agent, file, model, tokens)
+}
+
+// Check returns ErrBudgetExceeded when the context's tracker is over its
+// limits.
+func Check(ctx context.Context) error {
+	tracker := FromContext(ctx)
+	if tracker == nil {
+		return nil
+	}
+
+	return tracker.Check()
+}
@@ -0,0 +1,76 @@
+package usage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/usage"
+	. "github.com/onsi/gomega"
+)
+
+func TestPriceCost(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	price := usage.Price{Input: 3, Output: 15, CachedInput: 0.3}
+	tokens := usage.Tokens{Prompt: 1_000_000, Cached: 500_000, Completion: 100_000}
+	assert.Expect(price.Cost(tokens)).To(BeNumerically("~", 1.5+0.15+1.5, 1e-9))
+
+	// Without a cached price, cached tokens cost the same as input
+	price = usage.Price{Input: 2, Output: 8}
+	assert.Expect(price.Cost(tokens)).To(BeNumerically("~", 2+0.8, 1e-9))
+}
+
+func TestTracker(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tracker := usage.NewTracker(map[string]usage.Price{
+		"paid": {Input: 10, Output: 30},
+	}, usage.Limits{})
+
+	ctx := usage.WithTracker(context.Background(), tracker)
+
+	usage.Record(ctx, "planning", "local", usage.Tokens{Requests: 1, Prompt: 1000, Completion: 100})
+	usage.Record(usage.WithFile(ctx, "a.go"), "executing", "paid", usage.Tokens{Requests: 1, Prompt: 2000, Cached: 500, Completion: 200})
+	usage.Record(usage.WithFile(ctx, "a.go"), "executing", "paid", usage.Tokens{Requests: 1, Prompt: 1000, Completion: 100})
+	usage.Record(usage.WithFile(ctx, "b.go"), "executing", "paid", usage.Tokens{Requests: 1, Prompt: 1000, Completion: 100})
+
+	summary := tracker.Summary()
+	assert.Expect(summary.Session.Requests).To(Equal(4))
+	assert.Expect(summary.Session.Total()).To(Equal(5500))
+	assert.Expect(summary.Session.Cached).To(Equal(500))
+	assert.Expect(summary.Session.Cost).To(BeNumerically("~", (4000*10+400*30)/1_000_000.0, 1e-9))
+
+	assert.Expect(summary.Agents["planning"].Cost).To(BeZero())
+	assert.Expect(summary.Agents["executing"].Requests).To(Equal(3))
+	assert.Expect(summary.Files["a.go"].Prompt).To(Equal(3000))
+	assert.Expect(summary.Files["b.go"].Completion).To(Equal(100))
+	assert.Expect(summary.Models["local"].Requests).To(Equal(1))
+	assert.Expect(summary.Unpriced).To(Equal([]string{"local"}))
+
+	assert.Expect(summary.String()).To(ContainSubstring("usage: 4 requests, 5000 prompt (500 cached) + 500 completion tokens, $0.0520"))
+	assert.Expect(summary.String()).To(ContainSubstring("  file a.go: 2 requests"))
+	assert.Expect(summary.String()).To(ContainSubstring("no price configured for local"))
+
+	// Recording without a tracker is a no-op
+	usage.Record(context.Background(), "planning", "local", usage.Tokens{Prompt: 1})
+	assert.Expect(usage.Check(context.Background())).To(Succeed())
+}
+
+func TestTrackerLimits(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	tracker := usage.NewTracker(map[string]usage.Price{
+		"paid": {Input: 10, Output: 10},
+	}, usage.Limits{MaxCost: 0.01})
+
+	tracker.Record("executing", "", "paid", usage.Tokens{Prompt: 900})
+	assert.Expect(tracker.Check()).To(Succeed())
+
+	tracker.Record("executing", "", "paid", usage.Tokens{Prompt: 200})
+	assert.Expect(tracker.Check()).To(MatchError(usage.ErrBudgetExceeded))
+	assert.Expect(tracker.Check()).To(MatchError(ContainSubstring("spent $0.0110 of $0.0100")))
+
+	tracker = usage.NewTracker(nil, usage.Limits{MaxTokens: 100})
+	tracker.Record("planning", "", "local", usage.Tokens{Prompt: 80, Completion: 30})
+	assert.Expect(usage.Check(usage.WithTracker(context.Background(), tracker))).To(MatchError(ContainSubstring("used 110 of 100 tokens")))
+}
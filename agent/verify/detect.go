@@ -0,0 +1,27 @@
+package verify
+
+import (
+	"log/slog"
+
+	"github.com/jtarchie/agent/agent/contextbuilder"
+)
+
+// Detect finds the command that runs the tests of the project in dirs, most
+// specific first, from the repository's conventions. Task runners are preferred since they capture
+// how the project expects tests to run, followed by the conventions of each
+// language's tooling. It returns an empty slice when nothing is recognized.
+func Detect(dirs []string) []string {
+	conventions, err := contextbuilder.DiscoverConventions(dirs, 0)
+	if err != nil {
+		slog.Debug("verify.detect_failed", "error", err)
+		return []string{}
+	}
+
+	for _, fact := range conventions.Facts {
+		if fact.Kind == "test" {
+			return []string{fact.Value}
+		}
+	}
+
+	return []string{}
+}
@@ -0,0 +1,55 @@
+package verify_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/verify"
+	. "github.com/onsi/gomega"
+)
+
+func TestDetect(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	cases := []struct {
+		files    map[string]string
+		expected []string
+	}{
+		{map[string]string{}, []string{}},
+		{map[string]string{"go.mod": "module example\n"}, []string{"go test ./..."}},
+		{map[string]string{"go.mod": "module example\n", "Taskfile.yml": "version: 3\ntasks:\n  test:\n    cmds: [go test ./...]\n"}, []string{"task test"}},
+		{map[string]string{"go.mod": "module example\n", "Taskfile.yml": "version: 3\ntasks:\n  default:\n    cmds: [go test ./...]\n"}, []string{"go test ./..."}},
+		{map[string]string{"Makefile": "build:\n\tgo build\n\ntest: build\n\tgo test\n"}, []string{"make test"}},
+		{map[string]string{"package.json": `{"scripts": {"test": "jest"}}`}, []string{"npm run test"}},
+		{map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "pnpm-lock.yaml": ""}, []string{"pnpm run test"}},
+		{map[string]string{"package.json": `{"scripts": {"test": "echo \"Error: no test specified\" && exit 1"}}`}, []string{}},
+		{map[string]string{"Cargo.toml": "[package]\n"}, []string{"cargo test"}},
+		{map[string]string{"pyproject.toml": "[project]\n"}, []string{"python -m pytest"}},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		for name, content := range c.files {
+			err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			assert.Expect(err).NotTo(HaveOccurred())
+		}
+
+		assert.Expect(verify.Detect([]string{dir})).To(Equal(c.expected), "files: %v", c.files)
+	}
+}
+
+func TestDetectFromSubdirectory(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	root := t.TempDir()
+	err := os.WriteFile(filepath.Join(root, "Makefile"), []byte("test:\n\tgo test ./...\n"), 0644)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	subdir := filepath.Join(root, "docs")
+	err = os.Mkdir(subdir, 0755)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(verify.Detect([]string{subdir})).To(BeEmpty())
+	assert.Expect(verify.Detect([]string{subdir, root})).To(Equal([]string{"make test"}))
+}
@@ -0,0 +1,133 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/agent/agent/process"
+	"github.com/jtarchie/agent/agent/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrFailed is returned when verification commands still fail after all
+// repair rounds.
+var ErrFailed = errors.New("verification failed")
+
+// Result is the outcome of a single verification command.
+type Result struct {
+	Command  string        `json:"command"`
+	ExitCode int           `json:"exit_code"`
+	Output   string        `json:"output"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of running all verification commands.
+type Report struct {
+	Results []Result `json:"results"`
+	Passed  bool     `json:"passed"`
+}
+
+// Run executes each command with the shell inside dir, stopping each one
+// after timeout. Every command is run even when an earlier one fails, so the
+// report covers all failures.
+func Run(ctx context.Context, dir string, commands []string, timeout time.Duration) Report {
+	report := Report{
+		Results: []Result{},
+		Passed:  true,
+	}
+
+	for _, command := range commands {
+		result := runCommand(ctx, dir, command, timeout)
+		report.Results = append(report.Results, result)
+		report.Passed = report.Passed && result.Passed
+
+		slog.Info("verify.command", "command", command, "exit_code", result.ExitCode, "passed", result.Passed, "duration", result.Duration)
+	}
+
+	return report
+}
+
+func runCommand(ctx context.Context, dir, command string, timeout time.Duration) Result {
+	startTime := time.Now()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, span := telemetry.Start(ctx, "verify.command", attribute.String("command", command))
+	defer span.End()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	process.Isolate(cmd)
+	cmd.Env = append(os.Environ(), telemetry.Environ(ctx)...)
+	// Don't wait on grandchildren holding the output open after a timeout
+	cmd.WaitDelay = time.Second
+
+	output := &strings.Builder{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+
+	result := Result{
+		Command:  command,
+		Output:   output.String(),
+		Duration: time.Since(startTime),
+	}
+
+	switch {
+	case err == nil:
+		result.Passed = true
+	case ctx.Err() != nil:
+		result.ExitCode = -1
+		result.Output += fmt.Sprintf("\ncommand stopped after %s: %s", result.Duration.Round(time.Second), ctx.Err())
+	default:
+		result.ExitCode = -1
+		if cmd.ProcessState != nil {
+			result.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			result.Output += "\n" + err.Error()
+		}
+	}
+
+	span.SetAttributes(attribute.Int("process.exit.code", result.ExitCode))
+
+	return result
+}
+
+// Failures returns the failed results.
+func (r Report) Failures() []Result {
+	var failures []Result
+	for _, result := range r.Results {
+		if !result.Passed {
+			failures = append(failures, result)
+		}
+	}
+
+	return failures
+}
+
+// Summary describes which commands failed, for error messages and logs.
+func (r Report) Summary() string {
+	if r.Passed {
+		return "all verification commands passed"
+	}
+
+	failed := make([]string, 0, len(r.Results))
+	for _, result := range r.Failures() {
+		failed = append(failed, fmt.Sprintf("%q exited with %d", result.Command, result.ExitCode))
+	}
+
+	return strings.Join(failed, ", ")
+}
@@ -0,0 +1,47 @@
+package verify_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtarchie/agent/agent/verify"
+	. "github.com/onsi/gomega"
+)
+
+func TestRun(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+
+	report := verify.Run(context.Background(), dir, []string{"echo ok", "pwd"}, time.Minute)
+	assert.Expect(report.Passed).To(BeTrue())
+	assert.Expect(report.Results).To(HaveLen(2))
+	assert.Expect(report.Results[0].Output).To(Equal("ok\n"))
+	assert.Expect(strings.TrimSpace(report.Results[1].Output)).To(HaveSuffix(dir))
+	assert.Expect(report.Failures()).To(BeEmpty())
+	assert.Expect(report.Summary()).To(Equal("all verification commands passed"))
+}
+
+func TestRunFailures(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	report := verify.Run(context.Background(), t.TempDir(), []string{
+		"echo broken >&2; exit 3",
+		"echo fine",
+		"sleep 5",
+	}, 200*time.Millisecond)
+
+	assert.Expect(report.Passed).To(BeFalse())
+	assert.Expect(report.Results).To(HaveLen(3))
+
+	failures := report.Failures()
+	assert.Expect(failures).To(HaveLen(2))
+	assert.Expect(failures[0].ExitCode).To(Equal(3))
+	assert.Expect(failures[0].Output).To(Equal("broken\n"))
+	assert.Expect(failures[1].Command).To(Equal("sleep 5"))
+	assert.Expect(failures[1].Output).To(ContainSubstring("command stopped"))
+
+	assert.Expect(report.Summary()).To(Equal(`"echo broken >&2; exit 3" exited with 3, "sleep 5" exited with -1`))
+}
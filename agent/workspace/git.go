@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ChangedFiles returns the files with uncommitted changes, staged or not,
+// including untracked files that are not ignored. Deleted files are omitted.
+// In a repository without commits, every staged and untracked file counts as
+// changed.
+func ChangedFiles(ctx context.Context, dir string) ([]string, error) {
+	if !hasHead(ctx, dir) {
+		staged, err := StagedFiles(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		untracked, err := gitLines(ctx, dir, "ls-files", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files: %w", err)
+		}
+
+		return unique(append(staged, untracked...)), nil
+	}
+
+	changed, err := gitLines(ctx, dir, "diff", "--name-only", "--relative", "--diff-filter=d", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	untracked, err := gitLines(ctx, dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+
+	return unique(append(changed, untracked...)), nil
+}
+
+// StagedFiles returns the files staged in the index. Deleted files are omitted.
+func StagedFiles(ctx context.Context, dir string) ([]string, error) {
+	staged, err := gitLines(ctx, dir, "diff", "--name-only", "--relative", "--diff-filter=d", "--cached")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged files: %w", err)
+	}
+
+	return staged, nil
+}
+
+// FilesSince returns the files changed on the current branch since it
+// diverged from ref (e.g. "origin/main"). Deleted files are omitted.
+func FilesSince(ctx context.Context, dir string, ref string) ([]string, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+
+	files, err := gitLines(ctx, dir, "diff", "--name-only", "--relative", "--diff-filter=d", ref+"...HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files changed since %s: %w", ref, err)
+	}
+
+	return files, nil
+}
+
+// TrackedFiles returns the files in dir tracked by git.
+func TrackedFiles(ctx context.Context, dir string) ([]string, error) {
+	files, err := gitLines(ctx, dir, "ls-files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	return files, nil
+}
+
+// Root returns the top-level directory of the git repository containing
+// dir.
+func Root(ctx context.Context, dir string) (string, error) {
+	lines, err := gitLines(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("failed to find repository root: %w", err)
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("failed to find repository root of %s", dir)
+	}
+
+	return lines[0], nil
+}
+
+// hasHead reports whether HEAD resolves to a commit, which it does not in a
+// freshly initialized repository.
+func hasHead(ctx context.Context, dir string) bool {
+	_, err := gitLines(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// gitLines runs git inside dir and returns the non-empty lines of its output.
+// Paths are printed relative to dir.
+func gitLines(ctx context.Context, dir string, args ...string) ([]string, error) {
+	command := exec.CommandContext(ctx, "git", append([]string{"--no-pager", "-c", "core.quotePath=false"}, args...)...)
+	command.Dir = dir
+
+	stderr := &strings.Builder{}
+	command.Stderr = stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+func unique(files []string) []string {
+	seen := make(map[string]bool, len(files))
+	result := make([]string, 0, len(files))
+
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,108 @@
+package workspace_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/workspace"
+	. "github.com/onsi/gomega"
+)
+
+func TestChangedAndStagedFiles(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{
+		"main.go":      "package main\n",
+		"lib/util.go":  "package lib\n",
+		"lib/gone.go":  "package lib\n",
+		"docs/READ.md": "# docs\n",
+	})
+
+	testutil.WriteFile(t, repo, "main.go", "package main\n\nfunc main() {}\n")
+	testutil.WriteFile(t, repo, "lib/util.go", "package lib\n\nfunc Util() {}\n")
+	testutil.Git(t, repo, "add", "lib/util.go")
+	testutil.Git(t, repo, "rm", "--quiet", "lib/gone.go")
+	testutil.WriteFile(t, repo, "new.go", "package main\n")
+	testutil.WriteFile(t, repo, ".gitignore", "ignored.txt\n")
+	testutil.WriteFile(t, repo, "ignored.txt", "ignored\n")
+
+	changed, err := workspace.ChangedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(ConsistOf("main.go", "lib/util.go", "new.go", ".gitignore"))
+
+	staged, err := workspace.StagedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(staged).To(ConsistOf("lib/util.go"))
+
+	// Paths are relative to, and limited to, the directory git runs in
+	changed, err = workspace.ChangedFiles(context.Background(), filepath.Join(repo, "lib"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(ConsistOf("util.go"))
+}
+
+func TestChangedFilesWithoutCommits(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := t.TempDir()
+	testutil.Git(t, repo, "init", "--quiet", "--initial-branch=main")
+	testutil.WriteFile(t, repo, "main.go", "package main\n")
+	testutil.WriteFile(t, repo, "lib/util.go", "package lib\n")
+	testutil.Git(t, repo, "add", "main.go")
+
+	changed, err := workspace.ChangedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(ConsistOf("main.go", "lib/util.go"))
+}
+
+func TestFilesSince(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{
+		"main.go": "package main\n",
+	})
+
+	testutil.Git(t, repo, "checkout", "--quiet", "-b", "feature")
+	testutil.WriteFile(t, repo, "feature.go", "package main\n")
+	testutil.WriteFile(t, repo, "main.go", "package main\n\nfunc main() {}\n")
+	testutil.Git(t, repo, "add", ".")
+	testutil.Git(t, repo, "commit", "--quiet", "-m", "feature work")
+
+	// Uncommitted changes are not part of the branch history
+	testutil.WriteFile(t, repo, "wip.go", "package main\n")
+
+	files, err := workspace.FilesSince(context.Background(), repo, "main")
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(files).To(ConsistOf("feature.go", "main.go"))
+
+	_, err = workspace.FilesSince(context.Background(), repo, "does-not-exist")
+	assert.Expect(err).To(HaveOccurred())
+
+	_, err = workspace.FilesSince(context.Background(), repo, "--output=/tmp/file")
+	assert.Expect(err).To(HaveOccurred())
+}
+
+func TestRootAndTrackedFiles(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{
+		"lib/util.go": "package lib\n",
+	})
+
+	expected, err := filepath.EvalSymlinks(repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	root, err := workspace.Root(context.Background(), filepath.Join(repo, "lib"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(filepath.EvalSymlinks(root)).To(Equal(expected))
+
+	_, err = workspace.Root(context.Background(), t.TempDir())
+	assert.Expect(err).To(HaveOccurred())
+
+	testutil.WriteFile(t, repo, "untracked.go", "package main\n")
+
+	files, err := workspace.TrackedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(files).To(ConsistOf("lib/util.go"))
+}
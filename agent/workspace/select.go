@@ -0,0 +1,70 @@
+package workspace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ReadFileList reads a newline separated list of file paths, ignoring blank
+// lines and lines starting with '#'.
+func ReadFileList(reader io.Reader) ([]string, error) {
+	var files []string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, filepath.Clean(line))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+
+	return unique(files), nil
+}
+
+// Filter keeps the files that match at least one pattern. Patterns with glob
+// characters are matched with doublestar, anything else matches the exact
+// file or any file beneath it when it names a directory. With no patterns
+// every file is kept.
+func Filter(files []string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return files, nil
+	}
+
+	var filtered []string
+
+	for _, file := range files {
+		normalized := filepath.ToSlash(filepath.Clean(file))
+
+		for _, pattern := range patterns {
+			pattern = filepath.ToSlash(filepath.Clean(pattern))
+
+			matched := false
+			if strings.ContainsAny(pattern, "*?[{") {
+				var err error
+				matched, err = doublestar.Match(pattern, normalized)
+				if err != nil {
+					return nil, fmt.Errorf("failed to match pattern %s: %w", pattern, err)
+				}
+			} else {
+				matched = normalized == pattern || strings.HasPrefix(normalized, pattern+"/")
+			}
+
+			if matched {
+				filtered = append(filtered, file)
+				break
+			}
+		}
+	}
+
+	return filtered, nil
+}
@@ -0,0 +1,42 @@
+package workspace_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/workspace"
+	. "github.com/onsi/gomega"
+)
+
+func TestReadFileList(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	files, err := workspace.ReadFileList(strings.NewReader("main.go\n\n  ./lib/util.go  \n# comment\nmain.go\n"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(files).To(Equal([]string{"main.go", "lib/util.go"}))
+}
+
+func TestFilter(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	files := []string{"main.go", "lib/util.go", "lib/util_test.go", "docs/README.md", "library.txt"}
+
+	filtered, err := workspace.Filter(files, nil)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(filtered).To(Equal(files))
+
+	filtered, err = workspace.Filter(files, []string{"**/*.go"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(filtered).To(Equal([]string{"main.go", "lib/util.go", "lib/util_test.go"}))
+
+	filtered, err = workspace.Filter(files, []string{"lib", "docs/README.md"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(filtered).To(Equal([]string{"lib/util.go", "lib/util_test.go", "docs/README.md"}))
+
+	filtered, err = workspace.Filter(files, []string{"**/*_test.go", "./main.go"})
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(filtered).To(Equal([]string{"main.go", "lib/util_test.go"}))
+
+	_, err = workspace.Filter(files, []string{"[invalid"})
+	assert.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,140 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Worktree checks out HEAD of the repository containing dir into a new
+// detached worktree, so changes made there leave dir untouched. It returns
+// the directory in the worktree matching dir and a function removing the
+// worktree.
+func Worktree(ctx context.Context, dir string) (string, func(), error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	root, err := Root(ctx, dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	relativePath, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find %s in repository: %w", dir, err)
+	}
+
+	temp, err := makeTemp()
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = gitLines(ctx, root, "worktree", "add", "--detach", "--quiet", temp, "HEAD")
+	if err != nil {
+		_ = os.RemoveAll(temp)
+		return "", nil, fmt.Errorf("failed to create worktree: %w", err)
+	}
+
+	remove := func() {
+		// The worktree is removed even when the job was cancelled
+		_, err := gitLines(context.WithoutCancel(ctx), root, "worktree", "remove", "--force", temp)
+		if err != nil {
+			slog.Warn("workspace.worktree_remove_failed", "path", temp, "error", err)
+			_ = os.RemoveAll(temp)
+		}
+	}
+
+	return filepath.Join(temp, relativePath), remove, nil
+}
+
+// Copy copies the files, directories and symlinks under dir into a new
+// temporary directory, for workspaces that are not git repositories. It
+// returns the copy and a function removing it.
+func Copy(dir string) (string, func(), error) {
+	temp, err := makeTemp()
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(temp, relativePath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case entry.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		_ = os.RemoveAll(temp)
+		return "", nil, fmt.Errorf("failed to copy %s: %w", dir, err)
+	}
+
+	return temp, func() { _ = os.RemoveAll(temp) }, nil
+}
+
+// makeTemp creates an empty temporary directory with symlinks resolved, so
+// paths reported by git match it.
+func makeTemp() (string, error) {
+	temp, err := os.MkdirTemp("", "agent-workspace-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary workspace: %w", err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(temp)
+	if err != nil {
+		_ = os.RemoveAll(temp)
+		return "", fmt.Errorf("failed to resolve temporary workspace: %w", err)
+	}
+
+	return resolved, nil
+}
+
+func copyFile(source, target string, mode fs.FileMode) error {
+	from, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = from.Close() }()
+
+	to, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(to, from)
+	if err != nil {
+		_ = to.Close()
+		return err
+	}
+
+	return to.Close()
+}
@@ -0,0 +1,78 @@
+package workspace_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtarchie/agent/agent/internal/testutil"
+	"github.com/jtarchie/agent/agent/workspace"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorktree(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	repo := testutil.NewGitRepo(t, map[string]string{
+		"main.go":     "package main\n",
+		"lib/util.go": "package lib\n",
+	})
+
+	// Two worktrees open at once do not see each other's changes
+	first, removeFirst, err := workspace.Worktree(context.Background(), filepath.Join(repo, "lib"))
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	second, removeSecond, err := workspace.Worktree(context.Background(), filepath.Join(repo, "lib"))
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	assert.Expect(filepath.Base(first)).To(Equal("lib"))
+	assert.Expect(first).NotTo(Equal(second))
+
+	testutil.WriteFile(t, first, "util.go", "package lib\n\nfunc First() {}\n")
+	testutil.WriteFile(t, second, "new.go", "package lib\n")
+
+	contents, err := os.ReadFile(filepath.Join(second, "util.go"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("package lib\n"))
+	assert.Expect(filepath.Join(first, "new.go")).NotTo(BeAnExistingFile())
+
+	changed, err := workspace.ChangedFiles(context.Background(), first)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(ConsistOf("util.go"))
+
+	// The repository itself is untouched
+	changed, err = workspace.ChangedFiles(context.Background(), repo)
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(changed).To(BeEmpty())
+
+	removeFirst()
+	removeSecond()
+
+	assert.Expect(first).NotTo(BeAnExistingFile())
+	assert.Expect(second).NotTo(BeAnExistingFile())
+}
+
+func TestCopy(t *testing.T) {
+	assert := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	testutil.WriteFile(t, dir, "main.go", "package main\n")
+	testutil.WriteFile(t, dir, "lib/util.go", "package lib\n")
+
+	copied, remove, err := workspace.Copy(dir)
+	assert.Expect(err).NotTo(HaveOccurred())
+
+	contents, err := os.ReadFile(filepath.Join(copied, "lib", "util.go"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("package lib\n"))
+
+	testutil.WriteFile(t, copied, "main.go", "package changed\n")
+
+	contents, err = os.ReadFile(filepath.Join(dir, "main.go"))
+	assert.Expect(err).NotTo(HaveOccurred())
+	assert.Expect(string(contents)).To(Equal("package main\n"))
+
+	remove()
+	assert.Expect(copied).NotTo(BeAnExistingFile())
+}